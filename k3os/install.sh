@@ -35,9 +35,16 @@ get_url()
 cleanup2()
 {
     if [ -n "${TARGET}" ]; then
-        umount ${TARGET}/boot/efi || true
+        umount ${TARGET}/k3os/data/var/log || true
+        umount ${TARGET}/k3os/data/var/lib/rancher || true
+        umount ${BOOT_DIR}/efi || true
+        umount ${TARGET}/k3os/system/kernel || true
         umount ${TARGET} || true
     fi
+    close_encrypted
+    if [ -n "${KEY_MOUNT}" ]; then
+        umount ${KEY_MOUNT} || true
+    fi
 
     losetup -d ${ISO_DEVICE} || losetup -d ${ISO_DEVICE%?} || true
     umount $DISTRO || true
@@ -64,6 +71,139 @@ usage()
     exit 1
 }
 
+# partition_device DEVICE partitions a disk after K3OS_INSTALL_PARTITIONS
+partition_device()
+{
+    dd if=/dev/zero of=$1 bs=1M count=1
+    parted -s $1 mklabel ${PARTTABLE}
+
+    NUM=0
+    START=1
+    for i in $K3OS_INSTALL_PARTITIONS; do
+        NAME=${i%%:*}
+        SIZE=${i#*:}
+        if [ "$NAME" = "boot" ] && [ "$PARTTABLE" != "gpt" ]; then
+            continue
+        fi
+        NUM=$((NUM+1))
+        if [ "$SIZE" = "fill" ]; then
+            END=100%
+        else
+            END=$((START+SIZE))MiB
+        fi
+        if [ "$NAME" = "boot" ]; then
+            parted -s $1 mkpart primary fat32 ${START}MiB ${END}
+        else
+            parted -s $1 mkpart primary ext4 ${START}MiB ${END}
+            if [ -n "${MIRROR_DEVICE}" ]; then
+                parted -s $1 set ${NUM} raid on
+            fi
+        fi
+        case $NAME in
+            boot)
+                BOOT_NUM=$NUM
+                ;;
+            state)
+                STATE_NUM=$NUM
+                ;;
+            rancher)
+                RANCHER_NUM=$NUM
+                ;;
+            log)
+                LOG_NUM=$NUM
+                ;;
+            kernel)
+                KERNEL_NUM=$NUM
+                ;;
+        esac
+        if [ "$SIZE" = "fill" ]; then
+            if [ "$NAME" = "state" ] && [ -z "${MIRROR_DEVICE}" ] && [ -z "${ENCRYPTION}" ]; then
+                GROW_STATE=true
+            fi
+        else
+            START=$((START+SIZE))
+        fi
+    done
+    parted -s $1 set 1 ${BOOTFLAG} on
+    partprobe $1 2>/dev/null || true
+}
+
+# get_partition DEVICE NUM prints the device of a partition, /dev/sda2 or
+# /dev/nvme0n1p2
+get_partition()
+{
+    if [ -e $1$2 ]; then
+        echo $1$2
+    else
+        echo $1p$2
+    fi
+}
+
+# format_partition NAME NUM LABEL formats a partition, or the RAID1 array of
+# the partition on both disks of a mirrored installation, and sets PART to it.
+# The partitions but the kernel partition of encrypted installations are
+# formatted on top of LUKS.
+format_partition()
+{
+    PART=$(get_partition ${DEVICE} $2)
+    if [ ! -e ${PART} ]; then
+        echo Failed to find ${PART} to format
+        exit 1
+    fi
+    if [ -n "${MIRROR_DEVICE}" ]; then
+        MIRROR_PART=$(get_partition ${MIRROR_DEVICE} $2)
+        wipefs -a ${PART} ${MIRROR_PART}
+        # the superblock at the end keeps the members readable as plain
+        # filesystems by grub
+        mdadm --create /dev/md/harvester-$1 --run --level=1 --raid-devices=2 --metadata=1.0 --homehost=any ${PART} ${MIRROR_PART}
+        PART=/dev/md/harvester-$1
+    fi
+    if [ -n "${ENCRYPTION}" ] && [ "$1" != "kernel" ]; then
+        encrypt_partition $1 $3
+    fi
+    mkfs.ext4 -F -L $3 ${PART}
+}
+
+# encrypt_partition NAME LABEL sets up LUKS on PART, labeled LABEL_CRYPT, with
+# the key file and the passphrase, and sets PART to the unlocked device
+encrypt_partition()
+{
+    FIRST_KEY=${KEY:-${PASSPHRASE}}
+    cryptsetup luksFormat --batch-mode --type luks2 --label $2_CRYPT --key-file ${FIRST_KEY} ${PART}
+    if [ -n "${KEY}" ] && [ -n "${PASSPHRASE}" ]; then
+        cryptsetup luksAddKey --key-file ${KEY} ${PART} ${PASSPHRASE}
+    fi
+    cryptsetup open --key-file ${FIRST_KEY} ${PART} harvester-$1
+    PART=/dev/mapper/harvester-$1
+}
+
+# close_encrypted locks the encrypted partitions again
+close_encrypted()
+{
+    for name in log rancher state; do
+        if [ -e /dev/mapper/harvester-${name} ]; then
+            cryptsetup close harvester-${name} || true
+        fi
+    done
+}
+
+# stop_raid stops the arrays left on the disks by a previous installation
+stop_raid()
+{
+    for md in /sys/block/md*; do
+        if [ ! -e ${md}/md ]; then
+            continue
+        fi
+        for member in ${md}/slaves/*; do
+            PARENT=$(basename $(readlink -f ${member}/..))
+            if [ "/dev/${PARENT}" = "${DEVICE}" ] || [ "/dev/${PARENT}" = "${MIRROR_DEVICE}" ]; then
+                mdadm --stop /dev/$(basename ${md}) || true
+                break
+            fi
+        done
+    done
+}
+
 do_format()
 {
     if [ "$K3OS_INSTALL_NO_FORMAT" = "true" ]; then
@@ -76,53 +216,98 @@ do_format()
         return 0
     fi
 
-    dd if=/dev/zero of=${DEVICE} bs=1M count=1
-    parted -s ${DEVICE} mklabel ${PARTTABLE}
-    if [ "$PARTTABLE" = "gpt" ]; then
-        BOOT_NUM=1
-        STATE_NUM=2
-        parted -s ${DEVICE} mkpart primary fat32 0% 50MB
-        parted -s ${DEVICE} mkpart primary ext4 50MB 20480MB
-    else
-        BOOT_NUM=
-        STATE_NUM=1
-        parted -s ${DEVICE} mkpart primary ext4 0% 20430MB
+    # name:size in MiB, the partition sized "fill" takes the rest of the disk
+    if [ -z "$K3OS_INSTALL_PARTITIONS" ]; then
+        K3OS_INSTALL_PARTITIONS="boot:50 state:fill"
+    fi
+    stop_raid
+    partition_device ${DEVICE}
+    if [ -n "${MIRROR_DEVICE}" ]; then
+        partition_device ${MIRROR_DEVICE}
     fi
-    parted -s ${DEVICE} set 1 ${BOOTFLAG} on
-    partprobe ${DEVICE} 2>/dev/null || true
     sleep 2
 
-    PREFIX=${DEVICE}
-    if [ ! -e ${PREFIX}${STATE_NUM} ]; then
-        PREFIX=${DEVICE}p
+    if [ -n "${KERNEL_NUM}" ]; then
+        format_partition kernel ${KERNEL_NUM} HARVESTER_KERNEL
+        KERNEL=${PART}
     fi
-
-    if [ ! -e ${PREFIX}${STATE_NUM} ]; then
-        echo Failed to find ${PREFIX}${STATE_NUM} or ${DEVICE}${STATE_NUM} to format
-        exit 1
+    format_partition state ${STATE_NUM} HARVESTER_STATE
+    STATE=${PART}
+    if [ -n "${RANCHER_NUM}" ]; then
+        format_partition rancher ${RANCHER_NUM} HARVESTER_RANCHER
+        RANCHER=${PART}
     fi
-
-    if [ -n "${BOOT_NUM}" ]; then
-        BOOT=${PREFIX}${BOOT_NUM}
+    if [ -n "${LOG_NUM}" ]; then
+        format_partition log ${LOG_NUM} HARVESTER_LOG
+        LOG=${PART}
     fi
-    STATE=${PREFIX}${STATE_NUM}
-
-    mkfs.ext4 -F -L HARVESTER_STATE ${STATE}
-    if [ -n "${BOOT}" ]; then
+    if [ -n "${BOOT_NUM}" ]; then
+        BOOT=$(get_partition ${DEVICE} ${BOOT_NUM})
         mkfs.vfat -F 32 ${BOOT}
         fatlabel ${BOOT} K3OS_GRUB
+        if [ -n "${MIRROR_DEVICE}" ]; then
+            MIRROR_BOOT=$(get_partition ${MIRROR_DEVICE} ${BOOT_NUM})
+            mkfs.vfat -F 32 ${MIRROR_BOOT}
+            fatlabel ${MIRROR_BOOT} K3OS_GRUB
+        fi
     fi
 }
 
+# format_data partitions and formats the data disk with a partition labeled
+# HARVESTER_DATA, which is mounted by its label on boot. A disk with a
+# partition labeled HARVESTER_DATA is kept as it is, which the installer
+# doesn't ask to confirm either.
+format_data()
+{
+    if [ -z "${DATA_DEVICE}" ]; then
+        return 0
+    fi
+    local sys dev
+    for sys in /sys/class/block/$(basename $(readlink -f ${DATA_DEVICE}))/*/partition; do
+        if [ ! -e ${sys} ]; then
+            continue
+        fi
+        dev=/dev/$(basename $(dirname ${sys}))
+        if [ "$(blkid -p -o value -s LABEL ${dev} 2>/dev/null)" = "HARVESTER_DATA" ]; then
+            echo "Keeping the data partition ${dev}"
+            return 0
+        fi
+    done
+
+    wipefs -a ${DATA_DEVICE}
+    parted -s ${DATA_DEVICE} mklabel gpt
+    parted -s ${DATA_DEVICE} mkpart primary ext4 0% 100%
+    partprobe ${DATA_DEVICE} 2>/dev/null || true
+    sleep 2
+    mkfs.ext4 -F -L HARVESTER_DATA $(get_partition ${DATA_DEVICE} 1)
+}
+
 do_mount()
 {
     TARGET=/run/k3os/target
     mkdir -p ${TARGET}
     mount ${STATE} ${TARGET}
-    mkdir -p ${TARGET}/boot
+    # the bootloader can't read the encrypted state partition, so it loads
+    # the kernel from the kernel partition and lives there
+    BOOT_DIR=${TARGET}/boot
+    if [ -n "${KERNEL}" ]; then
+        BOOT_DIR=${TARGET}/k3os/system/kernel
+        mkdir -p ${BOOT_DIR}
+        mount ${KERNEL} ${BOOT_DIR}
+    fi
+    mkdir -p ${BOOT_DIR}
     if [ -n "${BOOT}" ]; then
-        mkdir -p ${TARGET}/boot/efi
-        mount ${BOOT} ${TARGET}/boot/efi
+        mkdir -p ${BOOT_DIR}/efi
+        mount ${BOOT} ${BOOT_DIR}/efi
+    fi
+    # the offline images are imported into the separate partitions
+    if [ -n "${RANCHER}" ]; then
+        mkdir -p ${TARGET}/k3os/data/var/lib/rancher
+        mount ${RANCHER} ${TARGET}/k3os/data/var/lib/rancher
+    fi
+    if [ -n "${LOG}" ]; then
+        mkdir -p ${TARGET}/k3os/data/var/log
+        mount ${LOG} ${TARGET}/k3os/data/var/log
     fi
 
     mkdir -p ${DISTRO}
@@ -132,7 +317,7 @@ do_mount()
 do_copy()
 {
     tar cf - -C ${DISTRO} k3os | tar xvf - -C ${TARGET}
-    if [ -n "$STATE_NUM" ]; then
+    if [ "$GROW_STATE" = "true" ]; then
         echo $DEVICE $STATE_NUM > $TARGET/k3os/system/growpart
     fi
 
@@ -210,8 +395,22 @@ install_grub()
         GRUB_DEBUG="k3os.debug"
     fi
 
-    mkdir -p ${TARGET}/boot/grub
-    cat > ${TARGET}/boot/grub/grub.cfg << EOF
+    ROOT_LABEL=HARVESTER_STATE
+    KERNEL_DIR=/k3os/system/kernel
+    if [ -n "${KERNEL}" ]; then
+        ROOT_LABEL=HARVESTER_KERNEL
+        KERNEL_DIR=
+    fi
+    # tell the initrd how to unlock the encrypted partitions
+    if [ -n "${KEY}" ]; then
+        ENCRYPTION_CMDLINE="harvester.encryption.key_label=${K3OS_INSTALL_ENCRYPTION_KEY_LABEL} harvester.encryption.key_file=${K3OS_INSTALL_ENCRYPTION_KEY_FILE}"
+    fi
+    if [ -n "${PASSPHRASE}" ]; then
+        ENCRYPTION_CMDLINE="${ENCRYPTION_CMDLINE} harvester.encryption.passphrase=true"
+    fi
+
+    mkdir -p ${BOOT_DIR}/grub
+    cat > ${BOOT_DIR}/grub/grub.cfg << EOF
 set default=0
 set timeout=10
 
@@ -221,12 +420,12 @@ insmod all_video
 insmod gfxterm
 
 menuentry "Start Harvester" {
-  search.fs_label HARVESTER_STATE root
-  set sqfile=/k3os/system/kernel/current/kernel.squashfs
+  search.fs_label ${ROOT_LABEL} root
+  set sqfile=${KERNEL_DIR}/current/kernel.squashfs
   loopback loop0 /\$sqfile
   set root=(\$root)
-  linux (loop0)/vmlinuz printk.devkmsg=on console=tty1 $GRUB_DEBUG
-  initrd /k3os/system/kernel/current/initrd
+  linux (loop0)/vmlinuz printk.devkmsg=on console=tty1 $GRUB_DEBUG $ENCRYPTION_CMDLINE
+  initrd ${KERNEL_DIR}/current/initrd
 }
 EOF
     if [ -z "${K3OS_INSTALL_TTY}" ]; then
@@ -235,7 +434,7 @@ EOF
         TTY=$K3OS_INSTALL_TTY
     fi
     if [ -e "/dev/${TTY%,*}" ] && [ "$TTY" != tty1 ] && [ "$TTY" != console ] && [ -n "$TTY" ]; then
-        sed -i "s!console=tty1!console=tty1 console=${TTY}!g" ${TARGET}/boot/grub/grub.cfg
+        sed -i "s!console=tty1!console=tty1 console=${TTY}!g" ${BOOT_DIR}/grub/grub.cfg
     fi
 
     if [ "$K3OS_INSTALL_NO_FORMAT" = "true" ]; then
@@ -246,7 +445,16 @@ EOF
         GRUB_TARGET="--target=x86_64-efi"
     fi
 
-    grub-install ${GRUB_TARGET} --boot-directory=${TARGET}/boot --removable ${DEVICE}
+    grub-install ${GRUB_TARGET} --boot-directory=${BOOT_DIR} --removable ${DEVICE}
+
+    # either disk of a mirrored installation boots
+    if [ -n "${MIRROR_DEVICE}" ]; then
+        if [ -n "${MIRROR_BOOT}" ]; then
+            umount ${BOOT_DIR}/efi
+            mount ${MIRROR_BOOT} ${BOOT_DIR}/efi
+        fi
+        grub-install ${GRUB_TARGET} --boot-directory=${BOOT_DIR} --removable ${MIRROR_DEVICE}
+    fi
 }
 
 get_iso()
@@ -311,6 +519,62 @@ validate_device()
         echo "You should use an available device. Device ${DEVICE} does not exist."
         exit 1
     fi
+
+    MIRROR_DEVICE=$K3OS_INSTALL_MIRROR_DEVICE
+    if [ -n "${MIRROR_DEVICE}" ]; then
+        if [ ! -b ${MIRROR_DEVICE} ]; then
+            echo "You should use an available mirror device. Device ${MIRROR_DEVICE} does not exist."
+            exit 1
+        fi
+        if [ "$K3OS_INSTALL_NO_FORMAT" = "true" ]; then
+            echo "A mirrored installation can't skip formatting."
+            exit 1
+        fi
+        if [ ! -x "$(which mdadm)" ]; then
+            echo "mdadm is required to mirror the installation."
+            exit 1
+        fi
+    fi
+
+    DATA_DEVICE=$K3OS_INSTALL_DATA_DEVICE
+    if [ -n "${DATA_DEVICE}" ] && [ ! -b ${DATA_DEVICE} ]; then
+        echo "You should use an available data disk. Device ${DATA_DEVICE} does not exist."
+        exit 1
+    fi
+}
+
+# validate_encryption finds the keys of an encrypted installation, the key
+# file on the key device and the file of the passphrase
+validate_encryption()
+{
+    PASSPHRASE=$K3OS_INSTALL_ENCRYPTION_PASSPHRASE_FILE
+    if [ -n "$K3OS_INSTALL_ENCRYPTION_KEY_FILE" ]; then
+        KEY_MOUNT=/run/k3os/key
+        mkdir -p ${KEY_MOUNT}
+        if ! mount -o ro -L ${K3OS_INSTALL_ENCRYPTION_KEY_LABEL} ${KEY_MOUNT}; then
+            KEY_MOUNT=
+            echo "The key device labeled ${K3OS_INSTALL_ENCRYPTION_KEY_LABEL} is missing."
+            exit 1
+        fi
+        KEY=${KEY_MOUNT}${K3OS_INSTALL_ENCRYPTION_KEY_FILE}
+        if [ ! -f ${KEY} ]; then
+            echo "The key file ${K3OS_INSTALL_ENCRYPTION_KEY_FILE} is missing on the key device labeled ${K3OS_INSTALL_ENCRYPTION_KEY_LABEL}."
+            exit 1
+        fi
+    fi
+    if [ -z "${KEY}" ] && [ -z "${PASSPHRASE}" ]; then
+        return 0
+    fi
+
+    if [ "$K3OS_INSTALL_NO_FORMAT" = "true" ]; then
+        echo "An encrypted installation can't skip formatting."
+        exit 1
+    fi
+    if [ ! -x "$(which cryptsetup)" ]; then
+        echo "cryptsetup is required to encrypt the installation."
+        exit 1
+    fi
+    ENCRYPTION=true
 }
 
 create_opt()
@@ -384,9 +648,11 @@ validate_device
 
 trap cleanup exit
 
+validate_encryption
 get_iso
 setup_style
 do_format
+format_data
 do_mount
 do_copy
 install_grub
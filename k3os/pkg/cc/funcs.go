@@ -128,6 +128,14 @@ func ApplyK3S(cfg *config.CloudConfig, restart, install bool) error {
 		}
 	}
 
+	// the k3s installer saves the proxy to the service env of k3s, which
+	// containerd inherits
+	for _, key := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"} {
+		if value, ok := cfg.K3OS.Environment[key]; ok {
+			vars = append(vars, fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+
 	if strings.HasPrefix(cfg.K3OS.Token, "K10") {
 		vars = append(vars, fmt.Sprintf("K3S_TOKEN=%s", cfg.K3OS.Token))
 	} else if cfg.K3OS.Token != "" {
@@ -4,7 +4,9 @@ import (
 	"fmt"
 
 	"github.com/rancher/k3os/pkg/cli/config"
+	"github.com/rancher/k3os/pkg/cli/disk"
 	"github.com/rancher/k3os/pkg/cli/install"
+	"github.com/rancher/k3os/pkg/cli/network"
 	"github.com/rancher/k3os/pkg/cli/rc"
 	"github.com/rancher/k3os/pkg/cli/upgrade"
 	"github.com/rancher/k3os/pkg/version"
@@ -38,7 +40,9 @@ func New() *cli.App {
 	app.Commands = []cli.Command{
 		rc.Command(),
 		config.Command(),
+		disk.Command(),
 		install.Command(),
+		network.Command(),
 		upgrade.Command(),
 	}
 
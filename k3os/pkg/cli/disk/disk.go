@@ -0,0 +1,45 @@
+package disk
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/harvester/harvester-installer/pkg/disk"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// Command `disk`
+func Command() cli.Command {
+	return cli.Command{
+		Name:  "disk",
+		Usage: "manage disks",
+		Before: func(c *cli.Context) error {
+			if os.Getuid() != 0 {
+				return fmt.Errorf("must be run as root")
+			}
+			return nil
+		},
+		Subcommands: []cli.Command{
+			{
+				Name:      "mount-data",
+				Usage:     "mount the data partition, which is found by its label",
+				ArgsUsage: "[MOUNTPOINT]",
+				Action: func(c *cli.Context) error {
+					if c.NArg() > 1 {
+						return fmt.Errorf("too many arguments, usage: k3os disk mount-data [MOUNTPOINT]")
+					}
+					mountPoint := disk.DataMountPoint
+					if c.NArg() == 1 {
+						mountPoint = c.Args().First()
+					}
+					if err := disk.MountData(mountPoint); err != nil {
+						logrus.Error(err)
+						return err
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,41 @@
+package network
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/harvester/harvester-installer/pkg/network"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// Command `network`
+func Command() cli.Command {
+	return cli.Command{
+		Name:  "network",
+		Usage: "configure networks",
+		Before: func(c *cli.Context) error {
+			if os.Getuid() != 0 {
+				return fmt.Errorf("must be run as root")
+			}
+			return nil
+		},
+		Subcommands: []cli.Command{
+			{
+				Name:      "apply",
+				Usage:     "apply networks and roll back if their gateways are unreachable",
+				ArgsUsage: "FILE",
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return fmt.Errorf("a networks file is required")
+					}
+					if err := network.ApplyFile(c.Args().First()); err != nil {
+						logrus.Error(err)
+						return err
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
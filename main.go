@@ -1,13 +1,165 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"strings"
 
+	"github.com/harvester/harvester-installer/pkg/config"
 	"github.com/harvester/harvester-installer/pkg/console"
 )
 
+const usage = `Usage:
+  harvester-installer                          start the installer console
+  harvester-installer config validate FILE...  validate Harvester config files
+  harvester-installer config schema            print the JSON Schema of Harvester config
+  harvester-installer config encrypt-secret    encrypt a secret read from stdin with the
+                                               base64 encoded key in $HARVESTER_SECRET_KEY
+  harvester-installer config keygen PREFIX     generate an ed25519 key pair to sign remote
+                                               files, saved to PREFIX.key and PREFIX.pub
+  harvester-installer config sign KEY FILE...  write the detached signature of each FILE
+                                               to FILE.sig
+`
+
 func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := console.RunConsole(); err != nil {
 		log.Panicln(err)
 	}
 }
+
+func runCommand(args []string) error {
+	if args[0] != "config" || len(args) < 2 {
+		return errors.New(usage)
+	}
+
+	switch args[1] {
+	case "validate":
+		if len(args) < 3 {
+			return errors.New(usage)
+		}
+		return validateConfigFiles(args[2:])
+	case "schema":
+		b, err := config.JSONSchema()
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	case "encrypt-secret":
+		return encryptSecret()
+	case "keygen":
+		if len(args) != 3 {
+			return errors.New(usage)
+		}
+		return generateSigningKey(args[2])
+	case "sign":
+		if len(args) < 4 {
+			return errors.New(usage)
+		}
+		return signFiles(args[2], args[3:])
+	}
+	return errors.New(usage)
+}
+
+func encryptSecret() error {
+	key, err := base64.StdEncoding.DecodeString(os.Getenv("HARVESTER_SECRET_KEY"))
+	if err != nil {
+		return fmt.Errorf("invalid HARVESTER_SECRET_KEY: %w", err)
+	}
+	secret, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	encrypted, err := config.EncryptSecret(key, strings.TrimRight(string(secret), "\r\n"))
+	if err != nil {
+		return err
+	}
+	fmt.Println(encrypted)
+	return nil
+}
+
+func generateSigningKey(prefix string) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(prefix+".key", []byte(base64.StdEncoding.EncodeToString(priv)+"\n"), 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(prefix+".pub", []byte(base64.StdEncoding.EncodeToString(pub)+"\n"), 0644)
+}
+
+func signFiles(keyFile string, files []string) error {
+	b, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		return fmt.Errorf("%s is not a key generated by config keygen", keyFile)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		sig := ed25519.Sign(ed25519.PrivateKey(key), data)
+		if err := ioutil.WriteFile(file+".sig", []byte(base64.StdEncoding.EncodeToString(sig)+"\n"), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateConfigFiles(files []string) error {
+	failed := 0
+	for _, file := range files {
+		if err := validateConfigFile(file); err != nil {
+			fmt.Printf("%s: %s\n", file, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: OK\n", file)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d config files are invalid", failed, len(files))
+	}
+	return nil
+}
+
+func validateConfigFile(file string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := config.CheckUnknownKeys(b); err != nil {
+		return err
+	}
+	cfgs, err := config.LoadHostConfigsOffline(b)
+	if err != nil {
+		return err
+	}
+	for i, cfg := range cfgs {
+		if err := console.ValidateConfigOffline(cfg); err != nil {
+			if len(cfgs) > 1 {
+				return fmt.Errorf("host entry %d: %w", i, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/imdario/mergo"
 )
@@ -17,6 +19,55 @@ type Network struct {
 	SubnetMask     string   `json:"subnetMask,omitempty"`
 	Gateway        string   `json:"gateway,omitempty"`
 	DNSNameservers []string `json:"dnsNameservers,omitempty"`
+
+	// IPv6Method is one of slaac, dhcpv6 or static. IPv6 is left as is if empty.
+	IPv6Method string `json:"ipv6Method,omitempty"`
+	// IPv6 is the static address in CIDR notation, e.g. 2001:db8::10/64
+	IPv6        string `json:"ipv6,omitempty"`
+	IPv6Gateway string `json:"ipv6Gateway,omitempty"`
+
+	// Bond creates Interface as a bond of the member NICs
+	Bond *Bond `json:"bond,omitempty"`
+	// VLANID tags the traffic of the network on Interface, the addresses are
+	// configured on the VLAN interface
+	VLANID int `json:"vlanId,omitempty"`
+
+	// MTU is set on the links of the network, the kernel default is kept if 0
+	MTU    int     `json:"mtu,omitempty"`
+	Routes []Route `json:"routes,omitempty"`
+}
+
+// Route is a static route through the network
+type Route struct {
+	// Destination is in CIDR notation, e.g. 10.10.0.0/16
+	Destination string `json:"destination,omitempty"`
+	Gateway     string `json:"gateway,omitempty"`
+	Metric      int    `json:"metric,omitempty"`
+}
+
+type Bond struct {
+	Members []string `json:"members,omitempty"`
+	// Mode is a Linux bonding mode, e.g. active-backup or 802.3ad
+	Mode   string `json:"mode,omitempty"`
+	Miimon int    `json:"miimon,omitempty"`
+}
+
+// LinkName returns the name of the interface that carries the addresses of
+// the network, e.g. bond0.100 for VLAN 100 on bond0
+func (n Network) LinkName() string {
+	if n.VLANID == 0 {
+		return n.Interface
+	}
+	return fmt.Sprintf("%s.%d", n.Interface, n.VLANID)
+}
+
+// Proxy is the proxy of the installer and the installed system
+type Proxy struct {
+	HTTP  string `json:"http,omitempty"`
+	HTTPS string `json:"https,omitempty"`
+	// NoProxy lists the hosts, domains and CIDRs reached directly. The cluster
+	// and service CIDRs and the node IP are added to it on the installed system.
+	NoProxy []string `json:"noProxy,omitempty"`
 }
 
 type HTTPBasicAuth struct {
@@ -34,6 +85,45 @@ type Webhook struct {
 	BasicAuth HTTPBasicAuth       `json:"basicAuth,omitempty"`
 }
 
+// Partitions sizes the partitions of the installation device in MiB. The
+// partition named by Fill takes the rest of the disk, its size being the
+// least it gets.
+type Partitions struct {
+	// BootSize is the size of the EFI partition, which only exists on EFI
+	// systems
+	BootSize  uint64 `json:"bootSize,omitempty"`
+	StateSize uint64 `json:"stateSize,omitempty"`
+	// RancherSize is the size of a separate /var/lib/rancher partition,
+	// there is none if it is zero and the partition isn't filled
+	RancherSize uint64 `json:"rancherSize,omitempty"`
+	// LogSize is the size of a separate /var/log partition, there is none if
+	// it is zero and the partition isn't filled
+	LogSize uint64 `json:"logSize,omitempty"`
+	// Fill is one of state, rancher or log, defaults to state
+	Fill string `json:"fill,omitempty"`
+	// KernelSize is the size of the partition the kernel is booted from in
+	// encrypted installations
+	KernelSize uint64 `json:"kernelSize,omitempty"`
+}
+
+// Encryption encrypts the state, rancher and log partitions with LUKS. They
+// are unlocked on boot with the key file if it is set, otherwise with the
+// passphrase typed on the console.
+type Encryption struct {
+	Passphrase string `json:"passphrase,omitempty"`
+	// KeyFile is the path of the key file on the filesystem labeled
+	// KeyLabel, e.g. a USB stick, which is plugged in at installation and on
+	// boot
+	KeyFile string `json:"keyFile,omitempty"`
+	// KeyLabel defaults to HARVESTER_KEY
+	KeyLabel string `json:"keyLabel,omitempty"`
+}
+
+// Enabled reports whether the installation is encrypted
+func (e Encryption) Enabled() bool {
+	return e.Passphrase != "" || e.KeyFile != ""
+}
+
 type Install struct {
 	Automatic     bool      `json:"automatic,omitempty"`
 	Mode          string    `json:"mode,omitempty"`
@@ -42,6 +132,7 @@ type Install struct {
 
 	ForceEFI  bool   `json:"forceEfi,omitempty"`
 	Device    string `json:"device,omitempty"`
+	DataDisk  string `json:"dataDisk,omitempty"`
 	ConfigURL string `json:"configUrl,omitempty"`
 	Silent    bool   `json:"silent,omitempty"`
 	ISOURL    string `json:"isoUrl,omitempty"`
@@ -50,6 +141,27 @@ type Install struct {
 	Debug     bool   `json:"debug,omitempty"`
 	TTY       string `json:"tty,omitempty"`
 
+	// MirrorDevice is partitioned like Device, the partitions but the EFI
+	// partition being mirrored by RAID1 arrays. install.device may also list
+	// both disks.
+	MirrorDevice string `json:"mirrorDevice,omitempty"`
+	// Force wipes the disks of automatic installations even if they have
+	// partitions or filesystems, which is refused otherwise
+	Force bool `json:"force,omitempty"`
+
+	Partitions Partitions `json:"partitions,omitempty"`
+	Encryption Encryption `json:"encryption,omitempty"`
+
+	// ConfigTemplate renders the remote config as a Go template with the
+	// facts of the machine before loading it
+	ConfigTemplate bool `json:"configTemplate,omitempty"`
+	// Strict rejects remote configs with unknown keys. Defaults to true for
+	// automatic installations.
+	Strict *bool `json:"strict,omitempty"`
+	// ConfigPublicKey is the ed25519 public key the remote config and SSH keys
+	// must be signed with, overriding the key baked into the ISO
+	ConfigPublicKey string `json:"configPublicKey,omitempty"`
+
 	Webhooks []Webhook `json:"webhooks,omitempty"`
 }
 
@@ -81,17 +193,41 @@ type OS struct {
 }
 
 type HarvesterConfig struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+
 	ServerURL string `json:"serverUrl,omitempty"`
 	Token     string `json:"token,omitempty"`
+	// VIP is the virtual IP of the management address of the cluster, it
+	// floats between the master nodes of the management subnet
+	VIP string `json:"vip,omitempty"`
+
+	// ClusterCIDR, ServiceCIDR and ClusterDomain are of the cluster created in
+	// create mode, the k3s defaults of Harvester are used if empty
+	ClusterCIDR   string `json:"clusterCidr,omitempty"`
+	ServiceCIDR   string `json:"serviceCidr,omitempty"`
+	ClusterDomain string `json:"clusterDomain,omitempty"`
+
+	Proxy Proxy `json:"proxy,omitempty"`
 
 	OS      `json:"os,omitempty"`
 	Install `json:"install,omitempty"`
+
+	// SecretRefs describes the secret fields that were resolved from references, keyed by field path
+	SecretRefs map[string]string `json:"-"`
 }
 
 func NewHarvesterConfig() *HarvesterConfig {
 	return &HarvesterConfig{}
 }
 
+// StrictConfig reports whether unknown keys in the remote config fail the installation
+func (c *HarvesterConfig) StrictConfig() bool {
+	if c.Install.Strict != nil {
+		return *c.Install.Strict
+	}
+	return c.Install.Automatic
+}
+
 func (c *HarvesterConfig) DeepCopy() (*HarvesterConfig, error) {
 	newConf := NewHarvesterConfig()
 	if err := mergo.Merge(newConf, c, mergo.WithAppendSlice); err != nil {
@@ -106,17 +242,49 @@ func (c *HarvesterConfig) sanitized() (*HarvesterConfig, error) {
 		return nil, err
 	}
 	if copied.Password != "" {
-		copied.Password = SanitizeMask
+		copied.Password = c.secretMask("os.password")
 	}
 	if copied.Token != "" {
-		copied.Token = SanitizeMask
+		copied.Token = c.secretMask("token")
 	}
+	copied.Proxy.HTTP = MaskURLPassword(copied.Proxy.HTTP)
+	copied.Proxy.HTTPS = MaskURLPassword(copied.Proxy.HTTPS)
 	for i := range copied.Wifi {
-		copied.Wifi[i].Passphrase = SanitizeMask
+		copied.Wifi[i].Passphrase = c.secretMask(fmt.Sprintf("os.wifi[%d].passphrase", i))
+	}
+	if copied.Install.Encryption.Passphrase != "" {
+		copied.Install.Encryption.Passphrase = c.secretMask("install.encryption.passphrase")
+	}
+	for i := range copied.Webhooks {
+		if copied.Webhooks[i].BasicAuth.Password != "" {
+			copied.Webhooks[i].BasicAuth.Password = c.secretMask(fmt.Sprintf("install.webhooks[%d].basicAuth.password", i))
+		}
 	}
 	return copied, nil
 }
 
+// secretMask masks a secret, telling where it was resolved from if it was a reference
+func (c *HarvesterConfig) secretMask(path string) string {
+	if ref, ok := c.SecretRefs[path]; ok {
+		return fmt.Sprintf("%s (%s)", SanitizeMask, ref)
+	}
+	return SanitizeMask
+}
+
+// MaskURLPassword masks the password in the user info of a URL
+func MaskURLPassword(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, ok := u.User.Password(); !ok {
+		return s
+	}
+	user := url.User(u.User.Username()).String()
+	u.User = nil
+	return fmt.Sprintf("%s://%s:%s@%s", u.Scheme, user, SanitizeMask, strings.TrimPrefix(u.String(), u.Scheme+"://"))
+}
+
 func (c *HarvesterConfig) String() string {
 	s, err := c.sanitized()
 	if err != nil {
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/rancher/mapper/convert"
+)
+
+const (
+	hostsKey = "hosts"
+)
+
+var hostMatchKeys = []string{"macAddress", "serial", "uuid", "hostname"}
+
+// HostFacts are the facts of the local machine used to pick its entry from a
+// multi-host config and to render config templates
+type HostFacts struct {
+	// NICs maps the name of each network interface to its MAC address
+	NICs     map[string]string
+	Serial   string
+	UUID     string
+	Hostname string
+	CPUs     int
+	Disks    []Disk
+	// Cmdline holds the kernel parameters, nested by their dotted keys
+	Cmdline map[string]interface{}
+}
+
+// Disk is a block device of the local machine
+type Disk struct {
+	Name string
+	Path string
+	// Size in bytes
+	Size uint64
+}
+
+// HostMatch selects a host entry. All specified criteria must match.
+type HostMatch struct {
+	MACAddr  string `json:"macAddress,omitempty"`
+	Serial   string `json:"serial,omitempty"`
+	UUID     string `json:"uuid,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+}
+
+func (m HostMatch) isEmpty() bool {
+	return m == HostMatch{}
+}
+
+// Matches reports whether the facts satisfy every criterion of the match.
+// Hostname is a shell pattern, e.g. "rack1-*".
+func (m HostMatch) Matches(facts HostFacts) bool {
+	if m.MACAddr != "" {
+		found := false
+		for _, mac := range facts.NICs {
+			if strings.EqualFold(mac, m.MACAddr) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if m.Serial != "" && !strings.EqualFold(m.Serial, facts.Serial) {
+		return false
+	}
+	if m.UUID != "" && !strings.EqualFold(m.UUID, facts.UUID) {
+		return false
+	}
+	if m.Hostname != "" {
+		if matched, err := path.Match(m.Hostname, facts.Hostname); err != nil || !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func (f HostFacts) String() string {
+	macs := make([]string, 0, len(f.NICs))
+	for _, mac := range f.NICs {
+		macs = append(macs, mac)
+	}
+	sort.Strings(macs)
+	return fmt.Sprintf("macAddresses=%s serial=%s uuid=%s hostname=%s",
+		strings.Join(macs, ","), f.Serial, f.UUID, f.Hostname)
+}
+
+// LoadHarvesterConfigForHost loads a config that may contain a "hosts" list.
+// Each entry has a "match" and a "config"; the config of the single entry
+// matching facts is merged over the rest of the document, which is shared by
+// all hosts. Documents without "hosts" are loaded as is.
+func LoadHarvesterConfigForHost(yamlBytes []byte, facts HostFacts) (*HarvesterConfig, error) {
+	result := NewHarvesterConfig()
+	data := map[string]interface{}{}
+	if err := yaml.Unmarshal(yamlBytes, &data); err != nil {
+		return result, fmt.Errorf("failed to unmarshal yaml: %v", err)
+	}
+
+	hosts, ok := data[hostsKey]
+	if !ok {
+		return result, toHarvesterConfig(data, result, defaultSecretResolver)
+	}
+	delete(data, hostsKey)
+
+	hostData, err := selectHost(hosts, facts)
+	if err != nil {
+		return nil, err
+	}
+	return mergeHostConfig(data, hostData, defaultSecretResolver)
+}
+
+// LoadHostConfigsOffline loads every host entry of a multi-host config merged
+// with the shared base, or just the config itself if it has no "hosts".
+// Secret references are not resolved, see LoadHarvesterConfigOffline.
+func LoadHostConfigsOffline(yamlBytes []byte) ([]*HarvesterConfig, error) {
+	data := map[string]interface{}{}
+	if err := yaml.Unmarshal(yamlBytes, &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal yaml: %v", err)
+	}
+
+	hosts, ok := data[hostsKey]
+	if !ok {
+		result := NewHarvesterConfig()
+		return []*HarvesterConfig{result}, toHarvesterConfig(data, result, placeholderSecretResolver)
+	}
+	delete(data, hostsKey)
+
+	entries, err := hostEntries(hosts)
+	if err != nil {
+		return nil, err
+	}
+	var results []*HarvesterConfig
+	for i, entry := range entries {
+		if _, err := entryMatch(i, entry); err != nil {
+			return nil, err
+		}
+		// the shared base is consumed by each conversion, so work on a copy
+		base := map[string]interface{}{}
+		if err := convert.ToObj(data, &base); err != nil {
+			return nil, err
+		}
+		result, err := mergeHostConfig(base, entryConfig(entry), placeholderSecretResolver)
+		if err != nil {
+			return nil, fmt.Errorf("host entry %d: %w", i, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// mergeHostConfig merges the host config over the shared base before they
+// are converted, so that the host config may also turn off what the base
+// turns on, e.g. install.automatic, and the migrations see the whole config of
+// the host. Maps are merged key by key, anything else set by the host config,
+// lists included, replaces the value of the base.
+func mergeHostConfig(data, hostData map[string]interface{}, r secretResolver) (*HarvesterConfig, error) {
+	baseVersion, hostVersion := convert.ToString(data[apiVersionKey]), convert.ToString(hostData[apiVersionKey])
+	if baseVersion != "" && hostVersion != "" && baseVersion != hostVersion {
+		return nil, fmt.Errorf("host config apiVersion %s differs from %s of the shared config", hostVersion, baseVersion)
+	}
+
+	schema.Mapper.ToInternal(data)
+	schema.Mapper.ToInternal(hostData)
+	result := NewHarvesterConfig()
+	if err := toHarvesterConfig(mergeMaps(data, hostData), result, r); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// mergeMaps merges src over dst and returns dst
+func mergeMaps(dst, src map[string]interface{}) map[string]interface{} {
+	for key, value := range src {
+		srcMap, srcOK := toMap(value)
+		dstMap, dstOK := toMap(dst[key])
+		if srcOK && dstOK {
+			dst[key] = mergeMaps(dstMap, srcMap)
+			continue
+		}
+		dst[key] = value
+	}
+	return dst
+}
+
+// toMap returns a map of the config, the mappers leave e.g. os.environment a
+// map of strings
+func toMap(value interface{}) (map[string]interface{}, bool) {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[string]string:
+		result := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			result[k] = v
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+func hostEntries(hosts interface{}) ([]map[string]interface{}, error) {
+	entries := convert.ToMapSlice(hosts)
+	if entries == nil && hosts != nil {
+		return nil, fmt.Errorf("%s must be a list of host entries", hostsKey)
+	}
+	return entries, nil
+}
+
+func entryMatch(i int, entry map[string]interface{}) (HostMatch, error) {
+	var match HostMatch
+	if err := convert.ToObj(entry["match"], &match); err != nil {
+		return match, fmt.Errorf("invalid match of host entry %d: %w", i, err)
+	}
+	if match.isEmpty() {
+		return match, fmt.Errorf("host entry %d has no match criteria", i)
+	}
+	return match, nil
+}
+
+func entryConfig(entry map[string]interface{}) map[string]interface{} {
+	if c := convert.ToMapInterface(entry["config"]); c != nil {
+		return c
+	}
+	return map[string]interface{}{}
+}
+
+func selectHost(hosts interface{}, facts HostFacts) (map[string]interface{}, error) {
+	entries, err := hostEntries(hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		matched []int
+		result  map[string]interface{}
+	)
+	for i, entry := range entries {
+		match, err := entryMatch(i, entry)
+		if err != nil {
+			return nil, err
+		}
+		if !match.Matches(facts) {
+			continue
+		}
+		matched = append(matched, i)
+		result = entryConfig(entry)
+	}
+
+	switch len(matched) {
+	case 0:
+		return nil, fmt.Errorf("no host entry matches this machine (%s)", facts)
+	case 1:
+		return result, nil
+	}
+	return nil, fmt.Errorf("host entries %v all match this machine (%s)", matched, facts)
+}
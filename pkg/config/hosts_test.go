@@ -0,0 +1,166 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const multiHostConfig = `
+token: TOKEN_VALUE
+os:
+  ssh_authorized_keys:
+  - github:username
+  dns_nameservers:
+  - 8.8.8.8
+install:
+  mode: join
+  device: /dev/sda
+hosts:
+- match:
+    macAddress: 52:54:00:00:00:01
+  config:
+    os:
+      hostname: node1
+    install:
+      mode: create
+- match:
+    serial: SN0002
+  config:
+    os:
+      hostname: node2
+    install:
+      device: /dev/nvme0n1
+- match:
+    hostname: rack1-*
+    uuid: 4C4C4544-0000-0000-0000-000000000003
+  config:
+    os:
+      hostname: node3
+`
+
+func TestLoadHarvesterConfigForHost(t *testing.T) {
+	testCases := []struct {
+		name     string
+		facts    HostFacts
+		hostname string
+		mode     string
+		device   string
+		errMsg   string
+	}{
+		{
+			name:     "match by MAC address",
+			facts:    HostFacts{NICs: map[string]string{"eth0": "52:54:00:aa:aa:aa", "eth1": "52:54:00:00:00:01"}},
+			hostname: "node1",
+			mode:     "create",
+			device:   "/dev/sda",
+		},
+		{
+			name:     "match by serial",
+			facts:    HostFacts{Serial: "sn0002"},
+			hostname: "node2",
+			mode:     "join",
+			device:   "/dev/nvme0n1",
+		},
+		{
+			name:     "match by hostname pattern and UUID",
+			facts:    HostFacts{Hostname: "rack1-07", UUID: "4c4c4544-0000-0000-0000-000000000003"},
+			hostname: "node3",
+			mode:     "join",
+			device:   "/dev/sda",
+		},
+		{
+			name:   "partial match",
+			facts:  HostFacts{Hostname: "rack1-07"},
+			errMsg: "no host entry matches this machine",
+		},
+		{
+			name:   "multiple matches",
+			facts:  HostFacts{NICs: map[string]string{"eth0": "52:54:00:00:00:01"}, Serial: "SN0002"},
+			errMsg: "host entries [0 1] all match this machine",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			c, err := LoadHarvesterConfigForHost([]byte(multiHostConfig), testCase.facts)
+			if testCase.errMsg != "" {
+				assert.NotNil(t, err)
+				assert.Contains(t, err.Error(), testCase.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.hostname, c.Hostname)
+			assert.Equal(t, testCase.mode, c.Install.Mode)
+			assert.Equal(t, testCase.device, c.Install.Device)
+			assert.Equal(t, "TOKEN_VALUE", c.Token)
+			assert.Equal(t, []string{"github:username"}, c.SSHAuthorizedKeys)
+			assert.Equal(t, CurrentAPIVersion, c.APIVersion)
+		})
+	}
+}
+
+func TestLoadHarvesterConfigForHost_singleHost(t *testing.T) {
+	c, err := LoadHarvesterConfigForHost([]byte("token: TOKEN_VALUE\n"), HostFacts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "TOKEN_VALUE", c.Token)
+}
+
+func TestLoadHostConfigsOffline(t *testing.T) {
+	cfgs, err := LoadHostConfigsOffline([]byte(multiHostConfig))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(cfgs))
+	for i, hostname := range []string{"node1", "node2", "node3"} {
+		assert.Equal(t, hostname, cfgs[i].Hostname)
+		assert.Equal(t, "TOKEN_VALUE", cfgs[i].Token)
+		assert.Equal(t, []string{"8.8.8.8"}, cfgs[i].DNSNameservers)
+	}
+
+	_, err = LoadHostConfigsOffline([]byte("hosts:\n- config:\n    token: abc\n"))
+	assert.EqualError(t, err, "host entry 0 has no match criteria")
+}
+
+func TestLoadHarvesterConfigForHost_merge(t *testing.T) {
+	const config = `
+os:
+  dns_nameservers:
+  - 8.8.8.8
+  environment:
+    FOO: bar
+install:
+  automatic: true
+  force: true
+hosts:
+- match:
+    serial: SN0001
+  config:
+    os:
+      environment:
+        BAZ: qux
+    install:
+      automatic: false
+      networks:
+      - interface: eth0
+        method: static
+        ip: 10.0.0.2
+`
+	c, err := LoadHarvesterConfigForHost([]byte(config), HostFacts{Serial: "SN0001"})
+	assert.Nil(t, err)
+	assert.False(t, c.Install.Automatic)
+	assert.True(t, c.Install.Force)
+	assert.Equal(t, map[string]string{"FOO": "bar", "BAZ": "qux"}, c.OS.Environment)
+	// the nameservers of the base are migrated into the networks of the host
+	if assert.Len(t, c.Install.Networks, 1) {
+		assert.Equal(t, []string{"8.8.8.8"}, c.Install.Networks[0].DNSNameservers)
+	}
+
+	_, err = LoadHarvesterConfigForHost([]byte(`
+apiVersion: harvesterhci.io/v1beta1
+hosts:
+- match:
+    serial: SN0001
+  config:
+    apiVersion: harvesterhci.io/v1alpha1
+`), HostFacts{Serial: "SN0001"})
+	assert.EqualError(t, err, "host config apiVersion harvesterhci.io/v1alpha1 differs from harvesterhci.io/v1beta1 of the shared config")
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/rancher/mapper"
+	"github.com/rancher/mapper/definition"
+
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+const (
+	jsonSchemaDraft     = "http://json-schema.org/draft-07/schema#"
+	secretReferenceType = "secretReference"
+)
+
+// secretFields lists the fields of each schema that accept a secret reference
+var secretFields = map[string][]string{
+	"harvesterConfig": {"token"},
+	"os":              {"password"},
+	"wifi":            {"passphrase"},
+	"httpBasicAuth":   {"password"},
+	"encryption":      {"passphrase"},
+}
+
+// listFields lists the fields of each schema that also accept a list of
+// values, see splitDevices
+var listFields = map[string][]string{
+	"install": {"device"},
+}
+
+// JSONSchema generates a JSON Schema of HarvesterConfig from the mapper schemas.
+// Keys are in their canonical camelCase form.
+func JSONSchema() ([]byte, error) {
+	definitions := map[string]interface{}{}
+	for id, s := range schemas.Schemas() {
+		definitions[id] = objectJSONSchema(s)
+	}
+	definitions[secretReferenceType] = secretReferenceJSONSchema()
+
+	root := map[string]interface{}{
+		"$schema":     jsonSchemaDraft,
+		"title":       "HarvesterConfig",
+		"$ref":        "#/definitions/" + schema.ID,
+		"definitions": definitions,
+	}
+	return json.MarshalIndent(root, "", "  ")
+}
+
+func objectJSONSchema(s *mapper.Schema) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	for name, field := range s.ResourceFields {
+		prop := fieldJSONSchema(field.Type)
+		if field.Description != "" {
+			prop["description"] = field.Description
+		}
+		if len(field.Options) > 0 {
+			prop["enum"] = field.Options
+		}
+		if util.StringSliceContains(secretFields[s.ID], name) {
+			prop = map[string]interface{}{
+				"oneOf": []interface{}{prop, fieldJSONSchema(secretReferenceType)},
+			}
+		}
+		if util.StringSliceContains(listFields[s.ID], name) {
+			prop = map[string]interface{}{
+				"oneOf": []interface{}{prop, map[string]interface{}{"type": "array", "items": prop}},
+			}
+		}
+		properties[name] = prop
+		if field.Required {
+			required = append(required, name)
+		}
+	}
+
+	result := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		result["required"] = required
+	}
+	return result
+}
+
+func fieldJSONSchema(fieldType string) map[string]interface{} {
+	switch {
+	case definition.IsArrayType(fieldType):
+		return map[string]interface{}{
+			"type":  "array",
+			"items": fieldJSONSchema(definition.SubType(fieldType)),
+		}
+	case definition.IsMapType(fieldType):
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": fieldJSONSchema(definition.SubType(fieldType)),
+		}
+	}
+
+	switch fieldType {
+	case "string", "enum", "password", "date", "hostname", "dnsLabel":
+		return map[string]interface{}{"type": "string"}
+	case "boolean":
+		return map[string]interface{}{"type": "boolean"}
+	case "int":
+		return map[string]interface{}{"type": "integer"}
+	case "float":
+		return map[string]interface{}{"type": "number"}
+	case "json":
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{"$ref": "#/definitions/" + fieldType}
+}
+
+func secretReferenceJSONSchema() map[string]interface{} {
+	properties := map[string]interface{}{}
+	for _, kind := range []string{secretFromFile, secretFromEnv, secretFromCmdline, secretEncrypted} {
+		properties[kind] = map[string]interface{}{"type": "string"}
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"minProperties":        1,
+		"maxProperties":        1,
+		"additionalProperties": false,
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONSchema(t *testing.T) {
+	b, err := JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var s struct {
+		Ref         string `json:"$ref"`
+		Definitions map[string]struct {
+			Type       string                            `json:"type"`
+			Properties map[string]map[string]interface{} `json:"properties"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "#/definitions/harvesterConfig", s.Ref)
+	root := s.Definitions["harvesterConfig"]
+	assert.Equal(t, "object", root.Type)
+	assert.Equal(t, map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"$ref": "#/definitions/secretReference"},
+		},
+	}, root.Properties["token"])
+	assert.Equal(t, map[string]interface{}{"type": "string"}, root.Properties["serverUrl"])
+	assert.Equal(t, map[string]interface{}{"$ref": "#/definitions/install"}, root.Properties["install"])
+
+	install := s.Definitions["install"]
+	assert.Equal(t, map[string]interface{}{"type": "boolean"}, install.Properties["automatic"])
+	assert.Equal(t, map[string]interface{}{
+		"type":  "array",
+		"items": map[string]interface{}{"$ref": "#/definitions/network"},
+	}, install.Properties["networks"])
+	assert.Equal(t, map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+	}, install.Properties["device"])
+
+	osSchema := s.Definitions["os"]
+	assert.Equal(t, map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": map[string]interface{}{"type": "string"},
+	}, osSchema.Properties["sysctls"])
+}
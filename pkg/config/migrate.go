@@ -0,0 +1,200 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rancher/mapper/convert"
+)
+
+const (
+	apiVersionKey = "apiVersion"
+	apiGroup      = "harvesterhci.io"
+
+	// APIVersionV1alpha1 is the implied version of configs that don't set apiVersion
+	APIVersionV1alpha1 = "harvesterhci.io/v1alpha1"
+	APIVersionV1beta1  = "harvesterhci.io/v1beta1"
+
+	// CurrentAPIVersion is the newest config schema this installer understands
+	CurrentAPIVersion = APIVersionV1beta1
+)
+
+// Migration upgrades a config document in place from one API version to the next
+type Migration func(data map[string]interface{}) error
+
+type migration struct {
+	from    string
+	to      string
+	migrate Migration
+}
+
+var (
+	// apiVersions lists all known API versions from oldest to newest
+	apiVersions = []string{
+		APIVersionV1alpha1,
+	}
+	migrations []migration
+)
+
+func init() {
+	registerMigration(APIVersionV1alpha1, APIVersionV1beta1, migrateV1alpha1ToV1beta1)
+}
+
+// registerMigration appends a migration to the chain. Migrations must be
+// registered in order and each one must start from the newest known version.
+func registerMigration(from, to string, m Migration) {
+	if latest := apiVersions[len(apiVersions)-1]; from != latest {
+		panic(fmt.Sprintf("migration from %s must start from the latest version %s", from, latest))
+	}
+	apiVersions = append(apiVersions, to)
+	migrations = append(migrations, migration{from: from, to: to, migrate: m})
+}
+
+func apiVersionIndex(version string) int {
+	for i, v := range apiVersions {
+		if v == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// kubeVersion matches the Kubernetes style versions of API groups, e.g. v1,
+// v1beta1 or v2alpha3
+var kubeVersion = regexp.MustCompile(`^v([1-9][0-9]*)(?:(alpha|beta)([1-9][0-9]*))?$`)
+
+// isNewerAPIVersion reports whether an unregistered version of the
+// harvesterhci.io group comes after the given registered one in the
+// Kubernetes order, v1alpha1 < v1beta1 < v1 < v2alpha1. Older and
+// misspelled versions aren't newer.
+func isNewerAPIVersion(version, than string) bool {
+	v, ok := parseAPIVersion(version)
+	if !ok {
+		return false
+	}
+	t, ok := parseAPIVersion(than)
+	if !ok {
+		return false
+	}
+	for i := range v {
+		if v[i] != t[i] {
+			return v[i] > t[i]
+		}
+	}
+	return false
+}
+
+// parseAPIVersion returns the major version, the stability (0 for alpha, 1
+// for beta and 2 for GA) and the minor version of a harvesterhci.io version
+func parseAPIVersion(version string) ([3]int, bool) {
+	if !strings.HasPrefix(version, apiGroup+"/") {
+		return [3]int{}, false
+	}
+	m := kubeVersion.FindStringSubmatch(strings.TrimPrefix(version, apiGroup+"/"))
+	if m == nil {
+		return [3]int{}, false
+	}
+	major, _ := strconv.Atoi(m[1])
+	stability := map[string]int{"alpha": 0, "beta": 1, "": 2}[m[2]]
+	minor, _ := strconv.Atoi(m[3])
+	return [3]int{major, stability, minor}, true
+}
+
+// migrate upgrades a config document that has already been through the
+// schema mappers to CurrentAPIVersion.
+func migrate(data map[string]interface{}) error {
+	if data == nil {
+		return nil
+	}
+
+	version := convert.ToString(data[apiVersionKey])
+	if version == "" {
+		version = APIVersionV1alpha1
+	}
+	if apiVersionIndex(version) < 0 {
+		if isNewerAPIVersion(version, CurrentAPIVersion) {
+			return fmt.Errorf("config apiVersion %s is newer than this installer supports (%s), please use a newer installer", version, CurrentAPIVersion)
+		}
+		return fmt.Errorf("unknown config apiVersion %s, the supported versions are %s", version, strings.Join(apiVersions, ", "))
+	}
+
+	for _, m := range migrations {
+		if m.from != version {
+			continue
+		}
+		if err := m.migrate(data); err != nil {
+			return fmt.Errorf("fail to migrate config from %s to %s: %w", m.from, m.to, err)
+		}
+		version = m.to
+	}
+
+	data[apiVersionKey] = version
+	return nil
+}
+
+// migrateV1alpha1ToV1beta1 moves the keys that changed in v1beta1:
+//
+//   - os.dnsNameservers is copied into the static networks that don't specify
+//     their own nameservers. Older configs only set the nameservers globally,
+//     while install.networks entries are expected to be self-contained.
+//   - the HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables of os.environment,
+//     in either case, move to the proxy section, which also passes them on
+//     to k3s and containerd.
+func migrateV1alpha1ToV1beta1(data map[string]interface{}) error {
+	osData := convert.ToMapInterface(data["os"])
+	if nameservers := convert.ToStringSlice(osData["dnsNameservers"]); len(nameservers) > 0 {
+		installData := convert.ToMapInterface(data["install"])
+		for _, network := range convert.ToMapSlice(installData["networks"]) {
+			if convert.ToString(network["method"]) != "static" {
+				continue
+			}
+			if len(convert.ToStringSlice(network["dnsNameservers"])) == 0 {
+				network["dnsNameservers"] = nameservers
+			}
+		}
+	}
+
+	// the mappers leave os.environment a map of strings
+	environment := map[string]interface{}{}
+	switch env := osData["environment"].(type) {
+	case map[string]string:
+		for key, value := range env {
+			environment[key] = value
+		}
+	case map[string]interface{}:
+		environment = env
+	}
+	if len(environment) == 0 || data["proxy"] != nil {
+		return nil
+	}
+	proxy := map[string]interface{}{}
+	for key, value := range environment {
+		switch strings.ToUpper(key) {
+		case "HTTP_PROXY":
+			proxy["http"] = convert.ToString(value)
+		case "HTTPS_PROXY":
+			proxy["https"] = convert.ToString(value)
+		case "NO_PROXY":
+			var noProxy []interface{}
+			for _, host := range strings.Split(convert.ToString(value), ",") {
+				if host = strings.TrimSpace(host); host != "" {
+					noProxy = append(noProxy, host)
+				}
+			}
+			proxy["noProxy"] = noProxy
+		default:
+			continue
+		}
+		delete(environment, key)
+	}
+	if len(proxy) > 0 {
+		data["proxy"] = proxy
+		osData["environment"] = environment
+		if len(environment) == 0 {
+			delete(osData, "environment")
+		}
+	}
+	return nil
+}
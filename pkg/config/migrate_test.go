@@ -0,0 +1,142 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadHarvesterConfig_migrate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected *HarvesterConfig
+		errMsg   string
+	}{
+		{
+			name: "unversioned config gets per-network nameservers",
+			input: `
+os:
+  dns_nameservers:
+  - 8.8.8.8
+install:
+  networks:
+  - interface: eth0
+    method: static
+    ip: 10.0.0.2
+  - interface: eth1
+    method: dhcp
+`,
+			expected: &HarvesterConfig{
+				APIVersion: CurrentAPIVersion,
+				OS: OS{
+					DNSNameservers: []string{"8.8.8.8"},
+				},
+				Install: Install{
+					Networks: []Network{
+						{
+							Interface:      "eth0",
+							Method:         "static",
+							IP:             "10.0.0.2",
+							DNSNameservers: []string{"8.8.8.8"},
+						},
+						{
+							Interface: "eth1",
+							Method:    "dhcp",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "current config is untouched",
+			input: `
+apiVersion: harvesterhci.io/v1beta1
+os:
+  dns_nameservers:
+  - 8.8.8.8
+install:
+  networks:
+  - interface: eth0
+    method: static
+    dnsNameservers:
+    - 1.1.1.1
+`,
+			expected: &HarvesterConfig{
+				APIVersion: CurrentAPIVersion,
+				OS: OS{
+					DNSNameservers: []string{"8.8.8.8"},
+				},
+				Install: Install{
+					Networks: []Network{
+						{
+							Interface:      "eth0",
+							Method:         "static",
+							DNSNameservers: []string{"1.1.1.1"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "unversioned config gets the proxy section",
+			input: `
+os:
+  environment:
+    http_proxy: http://proxy:3128
+    HTTPS_PROXY: http://proxy:3129
+    NO_PROXY: localhost, .internal
+    FOO: bar
+`,
+			expected: &HarvesterConfig{
+				APIVersion: CurrentAPIVersion,
+				Proxy: Proxy{
+					HTTP:    "http://proxy:3128",
+					HTTPS:   "http://proxy:3129",
+					NoProxy: []string{"localhost", ".internal"},
+				},
+				OS: OS{
+					Environment: map[string]string{"FOO": "bar"},
+				},
+			},
+		},
+		{
+			name:   "newer config",
+			input:  "apiVersion: harvesterhci.io/v2\n",
+			errMsg: "config apiVersion harvesterhci.io/v2 is newer than this installer supports",
+		},
+		{
+			name:   "newer GA config",
+			input:  "apiVersion: harvesterhci.io/v1\n",
+			errMsg: "config apiVersion harvesterhci.io/v1 is newer than this installer supports",
+		},
+		{
+			name:   "older unregistered config",
+			input:  "apiVersion: harvesterhci.io/v1alpha2\n",
+			errMsg: "unknown config apiVersion harvesterhci.io/v1alpha2, the supported versions are harvesterhci.io/v1alpha1, harvesterhci.io/v1beta1",
+		},
+		{
+			name:   "misspelled config",
+			input:  "apiVersion: harvesterhci.io/v1beta\n",
+			errMsg: "unknown config apiVersion harvesterhci.io/v1beta",
+		},
+		{
+			name:   "unknown config",
+			input:  "apiVersion: foo/v1\n",
+			errMsg: "unknown config apiVersion foo/v1",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			output, err := LoadHarvesterConfig([]byte(testCase.input))
+			if testCase.errMsg != "" {
+				assert.NotNil(t, err)
+				assert.Contains(t, err.Error(), testCase.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.expected, output)
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/rancher/mapper/convert"
+	"gopkg.in/yaml.v2"
+)
+
+// Source is where the value of a config field came from
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceCmdline Source = "cmdline"
+	SourceRemote  Source = "remote"
+	SourceUser    Source = "user"
+)
+
+// Provenance tracks which sources supplied the value of each config field.
+// Fields are identified by their dotted path, e.g. "install.device".
+type Provenance struct {
+	values  map[string]interface{}
+	sources map[string][]Source
+}
+
+func NewProvenance() *Provenance {
+	return &Provenance{
+		values:  map[string]interface{}{},
+		sources: map[string][]Source{},
+	}
+}
+
+// Record attributes every field that changed since the last call to source.
+// A slice that was appended to keeps its previous sources.
+func (p *Provenance) Record(cfg *HarvesterConfig, source Source) error {
+	data, err := convert.EncodeToMap(cfg)
+	if err != nil {
+		return err
+	}
+	values := map[string]interface{}{}
+	flatten("", data, values)
+
+	for path, value := range values {
+		old, ok := p.values[path]
+		switch {
+		case !ok:
+			p.sources[path] = []Source{source}
+		case reflect.DeepEqual(old, value):
+			continue
+		case isAppended(old, value):
+			if last := p.sources[path]; len(last) == 0 || last[len(last)-1] != source {
+				p.sources[path] = append(last, source)
+			}
+		default:
+			p.sources[path] = []Source{source}
+		}
+	}
+	for path := range p.values {
+		if _, ok := values[path]; !ok {
+			delete(p.sources, path)
+		}
+	}
+	p.values = values
+	return nil
+}
+
+// Sources returns the sources of a field, nil if the field is not set
+func (p *Provenance) Sources(path string) []Source {
+	return p.sources[path]
+}
+
+func (p *Provenance) paths() []string {
+	paths := make([]string, 0, len(p.sources))
+	for path := range p.sources {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (p *Provenance) String() string {
+	var b strings.Builder
+	for _, path := range p.paths() {
+		fmt.Fprintf(&b, "%s: %s\n", path, joinSources(p.sources[path]))
+	}
+	return b.String()
+}
+
+// Dump writes the provenance of every field to a YAML file
+func (p *Provenance) Dump(path string) error {
+	out := yaml.MapSlice{}
+	for _, field := range p.paths() {
+		out = append(out, yaml.MapItem{Key: field, Value: joinSources(p.sources[field])})
+	}
+	b, err := yaml.Marshal(out)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0600)
+}
+
+func joinSources(sources []Source) string {
+	s := make([]string, len(sources))
+	for i, source := range sources {
+		s[i] = string(source)
+	}
+	return strings.Join(s, ",")
+}
+
+func flatten(prefix string, data map[string]interface{}, out map[string]interface{}) {
+	for k, v := range data {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		if sub, ok := v.(map[string]interface{}); ok {
+			flatten(path, sub, out)
+			continue
+		}
+		out[path] = v
+	}
+}
+
+func isAppended(old, value interface{}) bool {
+	oldSlice, ok := old.([]interface{})
+	if !ok {
+		return false
+	}
+	newSlice, ok := value.([]interface{})
+	if !ok || len(newSlice) <= len(oldSlice) {
+		return false
+	}
+	return reflect.DeepEqual(oldSlice, newSlice[:len(oldSlice)])
+}
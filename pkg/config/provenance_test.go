@@ -0,0 +1,48 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/imdario/mergo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvenance_Record(t *testing.T) {
+	p := NewProvenance()
+
+	c := NewHarvesterConfig()
+	c.OS.NTPServers = []string{"ntp.ubuntu.com"}
+	c.OS.Modules = []string{"kvm"}
+	c.Install.Device = "/dev/sda"
+	assert.Nil(t, p.Record(c, SourceDefault))
+
+	cmdline := NewHarvesterConfig()
+	cmdline.OS.NTPServers = []string{"0.pool.ntp.org"}
+	cmdline.OS.Sysctls = map[string]string{"kernel.printk": "4 4 1 7"}
+	cmdline.Install.Mode = "create"
+	assert.Nil(t, mergo.Merge(c, cmdline, mergo.WithAppendSlice))
+	assert.Nil(t, p.Record(c, SourceCmdline))
+
+	c.Install.Device = "/dev/vda"
+	c.Token = "token"
+	assert.Nil(t, p.Record(c, SourceUser))
+
+	assert.Equal(t, []Source{SourceDefault, SourceCmdline}, p.Sources("os.ntpServers"))
+	assert.Equal(t, []Source{SourceDefault}, p.Sources("os.modules"))
+	assert.Equal(t, []Source{SourceCmdline}, p.Sources("os.sysctls.kernel.printk"))
+	assert.Equal(t, []Source{SourceCmdline}, p.Sources("install.mode"))
+	assert.Equal(t, []Source{SourceUser}, p.Sources("install.device"))
+	assert.Equal(t, []Source{SourceUser}, p.Sources("token"))
+	assert.Nil(t, p.Sources("serverUrl"))
+
+	c.Token = ""
+	assert.Nil(t, p.Record(c, SourceUser))
+	assert.Nil(t, p.Sources("token"))
+
+	assert.Equal(t, `install.device: user
+install.mode: cmdline
+os.modules: default
+os.ntpServers: default,cmdline
+os.sysctls.kernel.printk: cmdline
+`, p.String())
+}
@@ -1,8 +1,6 @@
 package config
 
 import (
-	"github.com/rancher/mapper/convert"
-
 	"github.com/harvester/harvester-installer/pkg/util"
 )
 
@@ -17,6 +15,6 @@ func ReadConfig() (HarvesterConfig, error) {
 	if err != nil {
 		return *result, err
 	}
-	schema.Mapper.ToInternal(data)
-	return *result, convert.ToObj(data, result)
+	err = toHarvesterConfig(data, result, defaultSecretResolver)
+	return *result, err
 }
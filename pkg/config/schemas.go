@@ -30,6 +30,68 @@ func LoadHarvesterConfig(yamlBytes []byte) (*HarvesterConfig, error) {
 	if err := yaml.Unmarshal(yamlBytes, &data); err != nil {
 		return result, fmt.Errorf("failed to unmarshal yaml: %v", err)
 	}
+	return result, toHarvesterConfig(data, result, defaultSecretResolver)
+}
+
+// LoadHarvesterConfigOffline loads a config without resolving secret
+// references, which are only checked for syntax and replaced by placeholders
+func LoadHarvesterConfigOffline(yamlBytes []byte) (*HarvesterConfig, error) {
+	result := NewHarvesterConfig()
+	data := map[string]interface{}{}
+	if err := yaml.Unmarshal(yamlBytes, &data); err != nil {
+		return result, fmt.Errorf("failed to unmarshal yaml: %v", err)
+	}
+	return result, toHarvesterConfig(data, result, placeholderSecretResolver)
+}
+
+// toHarvesterConfig normalizes, migrates and resolves secrets of a raw config
+// document before converting it into result
+func toHarvesterConfig(data map[string]interface{}, result *HarvesterConfig, r secretResolver) error {
 	schema.Mapper.ToInternal(data)
-	return result, convert.ToObj(data, result)
+	if err := migrate(data); err != nil {
+		return err
+	}
+	if err := splitDevices(data); err != nil {
+		return err
+	}
+	refs, err := r.resolve(data)
+	if err != nil {
+		return err
+	}
+	if err := convert.ToObj(data, result); err != nil {
+		return err
+	}
+	result.SecretRefs = refs
+	return nil
+}
+
+// splitDevices accepts the two disks of a mirrored installation as a list in
+// install.device, which is stored as device and mirrorDevice. A kernel
+// parameter given twice is a list of strings.
+func splitDevices(data map[string]interface{}) error {
+	install, ok := data["install"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var devices []interface{}
+	switch v := install["device"].(type) {
+	case []interface{}:
+		devices = v
+	case []string:
+		for _, device := range v {
+			devices = append(devices, device)
+		}
+	default:
+		return nil
+	}
+	switch len(devices) {
+	case 2:
+		install["mirrorDevice"] = devices[1]
+		fallthrough
+	case 1:
+		install["device"] = devices[0]
+	default:
+		return fmt.Errorf("install.device must be a disk or a list of two disks to mirror, got %d disks", len(devices))
+	}
+	return nil
 }
@@ -17,8 +17,9 @@ func TestToHarvesterConfig(t *testing.T) {
 		{
 			input: util.LoadFixture(t, "harvester-config.yaml"),
 			expected: &HarvesterConfig{
-				ServerURL: "https://someserver:6443",
-				Token:     "TOKEN_VALUE",
+				APIVersion: CurrentAPIVersion,
+				ServerURL:  "https://someserver:6443",
+				Token:      "TOKEN_VALUE",
 				OS: OS{
 					SSHAuthorizedKeys: []string{
 						"ssh-rsa AAAAB3NzaC1yc2EAAAADAQAB...",
@@ -52,10 +53,11 @@ func TestToHarvesterConfig(t *testing.T) {
 						},
 					},
 					Password: "rancher",
-					Environment: map[string]string{
-						"http_proxy":  "http://myserver",
-						"https_proxy": "http://myserver",
-					},
+				},
+				// the unversioned config gets the proxy section
+				Proxy: Proxy{
+					HTTP:  "http://myserver",
+					HTTPS: "http://myserver",
 				},
 				Install: Install{
 					Mode:          "create",
@@ -80,3 +82,29 @@ func TestToHarvesterConfig(t *testing.T) {
 		assert.Equal(t, testCase.err, err)
 	}
 }
+
+func TestToHarvesterConfigMirrorDevice(t *testing.T) {
+	c, err := LoadHarvesterConfig([]byte("install:\n  device: /dev/sda\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "/dev/sda", c.Install.Device)
+	assert.Equal(t, "", c.Install.MirrorDevice)
+
+	c, err = LoadHarvesterConfig([]byte("install:\n  device:\n  - /dev/sda\n  - /dev/sdb\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "/dev/sda", c.Install.Device)
+	assert.Equal(t, "/dev/sdb", c.Install.MirrorDevice)
+
+	_, err = LoadHarvesterConfig([]byte("install:\n  device:\n  - /dev/sda\n  - /dev/sdb\n  - /dev/sdc\n"))
+	assert.EqualError(t, err, "install.device must be a disk or a list of two disks to mirror, got 3 disks")
+
+	// harvester.install.device=/dev/sda harvester.install.device=/dev/sdb
+	c = NewHarvesterConfig()
+	cmdline := map[string]interface{}{
+		"install": map[string]interface{}{
+			"device": []string{"/dev/sda", "/dev/sdb"},
+		},
+	}
+	assert.Nil(t, toHarvesterConfig(cmdline, c, defaultSecretResolver))
+	assert.Equal(t, "/dev/sda", c.Install.Device)
+	assert.Equal(t, "/dev/sdb", c.Install.MirrorDevice)
+}
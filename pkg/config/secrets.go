@@ -0,0 +1,238 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/rancher/mapper/convert"
+	"github.com/rancher/mapper/values"
+
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+const (
+	secretFromFile    = "fromFile"
+	secretFromEnv     = "fromEnv"
+	secretFromCmdline = "fromCmdline"
+	secretEncrypted   = "encrypted"
+
+	// SecretKeyCmdline is the kernel parameter holding the base64 encoded
+	// AES-256 key that unlocks encrypted secrets
+	SecretKeyCmdline = "harvester_secret_key"
+)
+
+// secretResolver resolves secret references like
+//
+//	token:
+//	  fromFile: /run/secrets/token
+//
+// into their values. A reference is a map with exactly one of the keys
+// fromFile, fromEnv, fromCmdline or encrypted.
+type secretResolver struct {
+	readFile  func(string) ([]byte, error)
+	lookupEnv func(string) (string, bool)
+	cmdline   func() (map[string]interface{}, error)
+	// placeholder skips resolving and substitutes a placeholder value
+	placeholder bool
+}
+
+var defaultSecretResolver = secretResolver{
+	readFile:  ioutil.ReadFile,
+	lookupEnv: os.LookupEnv,
+	cmdline: func() (map[string]interface{}, error) {
+		return util.ReadCmdline("")
+	},
+}
+
+var placeholderSecretResolver = secretResolver{
+	placeholder: true,
+}
+
+// resolve replaces all secret references in data with their values and
+// returns a description of each resolved reference keyed by field path
+func (r secretResolver) resolve(data map[string]interface{}) (map[string]string, error) {
+	if data == nil {
+		return nil, nil
+	}
+	refs := map[string]string{}
+
+	if err := r.resolveField(data, "token", "token", refs); err != nil {
+		return nil, err
+	}
+
+	osData := convert.ToMapInterface(data["os"])
+	if err := r.resolveField(osData, "password", "os.password", refs); err != nil {
+		return nil, err
+	}
+	for i, wifi := range convert.ToMapSlice(osData["wifi"]) {
+		if err := r.resolveField(wifi, "passphrase", fmt.Sprintf("os.wifi[%d].passphrase", i), refs); err != nil {
+			return nil, err
+		}
+	}
+
+	installData := convert.ToMapInterface(data["install"])
+	encryption := convert.ToMapInterface(installData["encryption"])
+	if err := r.resolveField(encryption, "passphrase", "install.encryption.passphrase", refs); err != nil {
+		return nil, err
+	}
+	for i, webhook := range convert.ToMapSlice(installData["webhooks"]) {
+		basicAuth := convert.ToMapInterface(webhook["basicAuth"])
+		if err := r.resolveField(basicAuth, "password", fmt.Sprintf("install.webhooks[%d].basicAuth.password", i), refs); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	return refs, nil
+}
+
+func (r secretResolver) resolveField(data map[string]interface{}, key, path string, refs map[string]string) error {
+	ref, ok := data[key].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if len(ref) != 1 {
+		return fmt.Errorf("secret reference of %s must have exactly one of %s, %s, %s or %s",
+			path, secretFromFile, secretFromEnv, secretFromCmdline, secretEncrypted)
+	}
+
+	var (
+		kind   string
+		source string
+	)
+	for k, v := range ref {
+		kind = k
+		source = convert.ToString(v)
+	}
+
+	value, err := r.resolveRef(kind, source)
+	if err != nil {
+		return fmt.Errorf("fail to resolve secret %s: %w", path, err)
+	}
+	data[key] = value
+
+	if kind == secretEncrypted {
+		refs[path] = kind
+	} else {
+		refs[path] = kind + " " + source
+	}
+	return nil
+}
+
+func (r secretResolver) resolveRef(kind, source string) (string, error) {
+	if r.placeholder {
+		switch kind {
+		case secretFromFile, secretFromEnv, secretFromCmdline, secretEncrypted:
+			return fmt.Sprintf("<%s>", kind), nil
+		}
+		return "", fmt.Errorf("unknown secret reference %s", kind)
+	}
+
+	switch kind {
+	case secretFromFile:
+		b, err := r.readFile(source)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	case secretFromEnv:
+		value, ok := r.lookupEnv(source)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", source)
+		}
+		return value, nil
+	case secretFromCmdline:
+		value, err := r.lookupCmdline(source)
+		if err != nil {
+			return "", err
+		}
+		if value == "" {
+			return "", fmt.Errorf("kernel parameter %s is not set", source)
+		}
+		return value, nil
+	case secretEncrypted:
+		encodedKey, err := r.lookupCmdline(SecretKeyCmdline)
+		if err != nil {
+			return "", err
+		}
+		if encodedKey == "" {
+			return "", fmt.Errorf("kernel parameter %s is required to decrypt secrets", SecretKeyCmdline)
+		}
+		key, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s: %w", SecretKeyCmdline, err)
+		}
+		return DecryptSecret(key, source)
+	}
+	return "", fmt.Errorf("unknown secret reference %s", kind)
+}
+
+func (r secretResolver) lookupCmdline(key string) (string, error) {
+	params, err := r.cmdline()
+	if err != nil {
+		return "", err
+	}
+	value, _ := values.GetValue(params, strings.Split(key, ".")...)
+	switch v := value.(type) {
+	case []string:
+		return v[len(v)-1], nil
+	default:
+		return convert.ToString(v), nil
+	}
+}
+
+// EncryptSecret encrypts a secret with AES-256-GCM so it can be used as an
+// encrypted secret reference
+func EncryptSecret(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret decrypts a secret encrypted by EncryptSecret
+func DecryptSecret(key []byte, encrypted string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("encrypted secret is too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("fail to decrypt secret, wrong key?")
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("secret key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
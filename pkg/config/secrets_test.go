@@ -0,0 +1,186 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretResolver_resolve(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	encrypted, err := EncryptSecret(key, "wifi-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := secretResolver{
+		readFile: func(name string) ([]byte, error) {
+			if name == "/run/secrets/token" {
+				return []byte("file-token\n"), nil
+			}
+			return nil, errors.New("file not found")
+		},
+		lookupEnv: func(name string) (string, bool) {
+			if name == "WEBHOOK_PASSWORD" {
+				return "env-password", true
+			}
+			return "", false
+		},
+		cmdline: func() (map[string]interface{}, error) {
+			return map[string]interface{}{
+				"os_password":    "cmdline-password",
+				SecretKeyCmdline: base64.StdEncoding.EncodeToString(key),
+			}, nil
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		data     map[string]interface{}
+		expected map[string]interface{}
+		refs     map[string]string
+		errMsg   string
+	}{
+		{
+			name: "no references",
+			data: map[string]interface{}{
+				"token": "plain",
+			},
+			expected: map[string]interface{}{
+				"token": "plain",
+			},
+		},
+		{
+			name: "all kinds of references",
+			data: map[string]interface{}{
+				"token": map[string]interface{}{"fromFile": "/run/secrets/token"},
+				"os": map[string]interface{}{
+					"password": map[string]interface{}{"fromCmdline": "os_password"},
+					"wifi": []interface{}{
+						map[string]interface{}{
+							"name":       "home",
+							"passphrase": map[string]interface{}{"encrypted": encrypted},
+						},
+					},
+				},
+				"install": map[string]interface{}{
+					"webhooks": []interface{}{
+						map[string]interface{}{
+							"basicAuth": map[string]interface{}{
+								"user":     "admin",
+								"password": map[string]interface{}{"fromEnv": "WEBHOOK_PASSWORD"},
+							},
+						},
+					},
+				},
+			},
+			expected: map[string]interface{}{
+				"token": "file-token",
+				"os": map[string]interface{}{
+					"password": "cmdline-password",
+					"wifi": []interface{}{
+						map[string]interface{}{
+							"name":       "home",
+							"passphrase": "wifi-secret",
+						},
+					},
+				},
+				"install": map[string]interface{}{
+					"webhooks": []interface{}{
+						map[string]interface{}{
+							"basicAuth": map[string]interface{}{
+								"user":     "admin",
+								"password": "env-password",
+							},
+						},
+					},
+				},
+			},
+			refs: map[string]string{
+				"token":                                  "fromFile /run/secrets/token",
+				"os.password":                            "fromCmdline os_password",
+				"os.wifi[0].passphrase":                  "encrypted",
+				"install.webhooks[0].basicAuth.password": "fromEnv WEBHOOK_PASSWORD",
+			},
+		},
+		{
+			name: "missing env",
+			data: map[string]interface{}{
+				"token": map[string]interface{}{"fromEnv": "NOT_SET"},
+			},
+			errMsg: "fail to resolve secret token: environment variable NOT_SET is not set",
+		},
+		{
+			name: "missing cmdline",
+			data: map[string]interface{}{
+				"token": map[string]interface{}{"fromCmdline": "not_set"},
+			},
+			errMsg: "fail to resolve secret token: kernel parameter not_set is not set",
+		},
+		{
+			name: "ambiguous reference",
+			data: map[string]interface{}{
+				"token": map[string]interface{}{"fromEnv": "A", "fromFile": "B"},
+			},
+			errMsg: "secret reference of token must have exactly one of",
+		},
+		{
+			name: "unknown reference",
+			data: map[string]interface{}{
+				"token": map[string]interface{}{"fromVault": "A"},
+			},
+			errMsg: "unknown secret reference fromVault",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			refs, err := r.resolve(testCase.data)
+			if testCase.errMsg != "" {
+				assert.NotNil(t, err)
+				assert.Contains(t, err.Error(), testCase.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.expected, testCase.data)
+			assert.Equal(t, testCase.refs, refs)
+		})
+	}
+}
+
+func TestDecryptSecret(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	encrypted, err := EncryptSecret(key, "secret")
+	assert.Nil(t, err)
+
+	plaintext, err := DecryptSecret(key, encrypted)
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", plaintext)
+
+	_, err = DecryptSecret([]byte("fedcba9876543210fedcba9876543210"), encrypted)
+	assert.EqualError(t, err, "fail to decrypt secret, wrong key?")
+
+	_, err = DecryptSecret([]byte("short"), encrypted)
+	assert.EqualError(t, err, "secret key must be 32 bytes, got 5")
+}
+
+func TestLoadHarvesterConfigOffline(t *testing.T) {
+	c, err := LoadHarvesterConfigOffline([]byte(`
+token:
+  fromFile: /run/secrets/token
+os:
+  password:
+    encrypted: c2VjcmV0
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, "<fromFile>", c.Token)
+	assert.Equal(t, "<encrypted>", c.Password)
+
+	_, err = LoadHarvesterConfigOffline([]byte(`
+token:
+  fromVault: secret/token
+`))
+	assert.EqualError(t, err, "fail to resolve secret token: unknown secret reference fromVault")
+}
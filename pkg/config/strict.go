@@ -0,0 +1,246 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/rancher/mapper"
+	"github.com/rancher/mapper/convert"
+	"github.com/rancher/mapper/definition"
+
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+// UnknownKey is a config key that is not part of the schema
+type UnknownKey struct {
+	Path       string
+	Suggestion string
+}
+
+func (k UnknownKey) String() string {
+	if k.Suggestion == "" {
+		return fmt.Sprintf("unknown key %s", k.Path)
+	}
+	return fmt.Sprintf("unknown key %s, did you mean %s?", k.Path, k.Suggestion)
+}
+
+// UnknownKeysError reports all unknown keys of a config
+type UnknownKeysError []UnknownKey
+
+func (e UnknownKeysError) Error() string {
+	lines := make([]string, len(e))
+	for i, k := range e {
+		lines[i] = k.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CheckUnknownKeys reports every key of a config document that would be
+// silently dropped when loading it. Keys are accepted in any of the spellings
+// the loader understands, e.g. "mgmt_interface" for "mgmtInterface". The
+// entries of a multi-host config are checked as well.
+func CheckUnknownKeys(yamlBytes []byte) error {
+	data := map[string]interface{}{}
+	if err := yaml.Unmarshal(yamlBytes, &data); err != nil {
+		return fmt.Errorf("failed to unmarshal yaml: %v", err)
+	}
+
+	var unknown []UnknownKey
+	if hosts, ok := data[hostsKey]; ok {
+		entries, err := hostEntries(hosts)
+		if err != nil {
+			return err
+		}
+		for i, entry := range entries {
+			unknown = append(unknown, checkHostEntry(fmt.Sprintf("%s[%d]", hostsKey, i), entry)...)
+		}
+	}
+	unknown = append(unknown, checkSchemaKeys("", schema, data, hostsKey)...)
+	return unknownKeysError(unknown)
+}
+
+// CheckUnknownCmdlineKeys reports every harvester.* kernel parameter that is
+// not a config key, e.g. harvester.install.mgmt_interfce
+func CheckUnknownCmdlineKeys() error {
+	data, err := util.ReadCmdline(kernelParamPrefix)
+	if err != nil {
+		return err
+	}
+	return checkUnknownCmdlineKeys(data)
+}
+
+func checkUnknownCmdlineKeys(data map[string]interface{}) error {
+	return unknownKeysError(checkSchemaKeys(kernelParamPrefix, schema, data))
+}
+
+func unknownKeysError(unknown []UnknownKey) error {
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Slice(unknown, func(i, j int) bool {
+		return unknown[i].Path < unknown[j].Path
+	})
+	return UnknownKeysError(unknown)
+}
+
+func checkHostEntry(path string, entry map[string]interface{}) []UnknownKey {
+	var unknown []UnknownKey
+	for k, v := range entry {
+		switch k {
+		case "match":
+			for mk := range convert.ToMapInterface(v) {
+				if !util.StringSliceContains(hostMatchKeys, mk) {
+					unknown = append(unknown, newUnknownKey(joinPath(path+".match", mk), mk, hostMatchKeys))
+				}
+			}
+		case "config":
+			unknown = append(unknown, checkSchemaKeys(path+".config", schema, convert.ToMapInterface(v))...)
+		default:
+			unknown = append(unknown, newUnknownKey(joinPath(path, k), k, []string{"match", "config"}))
+		}
+	}
+	return unknown
+}
+
+func checkSchemaKeys(path string, s *mapper.Schema, data map[string]interface{}, allowed ...string) []UnknownKey {
+	names := fuzzyFieldNames(s)
+	var unknown []UnknownKey
+	for k, v := range data {
+		fieldPath := joinPath(path, k)
+		name, ok := names[k]
+		if !ok {
+			if !util.StringSliceContains(allowed, k) {
+				unknown = append(unknown, newUnknownKey(fieldPath, k, fieldNames(s)))
+			}
+			continue
+		}
+		if _, isRef := v.(map[string]interface{}); isRef && util.StringSliceContains(secretFields[s.ID], name) {
+			// secret references are checked when they are resolved
+			continue
+		}
+		unknown = append(unknown, checkFieldKeys(fieldPath, s.ResourceFields[name].Type, v)...)
+	}
+	return unknown
+}
+
+func checkFieldKeys(path, fieldType string, value interface{}) []UnknownKey {
+	if definition.IsArrayType(fieldType) {
+		var unknown []UnknownKey
+		for i, item := range convert.ToInterfaceSlice(value) {
+			unknown = append(unknown, checkFieldKeys(fmt.Sprintf("%s[%d]", path, i), definition.SubType(fieldType), item)...)
+		}
+		return unknown
+	}
+	if sub := schemas.Schema(fieldType); sub != nil {
+		if data, ok := value.(map[string]interface{}); ok {
+			return checkSchemaKeys(path, sub, data)
+		}
+	}
+	return nil
+}
+
+// fuzzyFieldNames maps every accepted spelling of the fields of a schema to
+// the field, following config.FuzzyNames
+func fuzzyFieldNames(s *mapper.Schema) map[string]string {
+	names := map[string]string{}
+	add := func(name, field string) {
+		names[name] = field
+		names[strings.ToLower(name)] = field
+		names[convert.ToYAMLKey(name)] = field
+		names[strings.ToLower(convert.ToYAMLKey(name))] = field
+	}
+	for field := range s.ResourceFields {
+		if strings.HasSuffix(field, "s") && len(field) > 1 {
+			add(field[:len(field)-1], field)
+		}
+		if strings.HasSuffix(field, "es") && len(field) > 2 {
+			add(field[:len(field)-2], field)
+		}
+		add(field, field)
+	}
+	if _, ok := s.ResourceFields["passphrase"]; ok {
+		names["pass"] = "passphrase"
+	}
+	return names
+}
+
+func fieldNames(s *mapper.Schema) []string {
+	names := make([]string, 0, len(s.ResourceFields))
+	for name := range s.ResourceFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newUnknownKey(path, key string, candidates []string) UnknownKey {
+	return UnknownKey{
+		Path:       path,
+		Suggestion: suggestKey(key, candidates),
+	}
+}
+
+// suggestKey returns the candidate closest to key, if it is close enough to be
+// a likely misspelling
+func suggestKey(key string, candidates []string) string {
+	normalized := normalizeKey(key)
+	best, bestDistance := "", -1
+	for _, candidate := range candidates {
+		d := editDistance(normalized, normalizeKey(candidate))
+		if bestDistance < 0 || d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	maxDistance := len(normalized) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+	if bestDistance < 0 || bestDistance > maxDistance {
+		return ""
+	}
+	return best
+}
+
+func normalizeKey(key string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	result := values[0]
+	for _, v := range values[1:] {
+		if v < result {
+			result = v
+		}
+	}
+	return result
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
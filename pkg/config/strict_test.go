@@ -0,0 +1,150 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckUnknownKeys(t *testing.T) {
+	testCases := []struct {
+		name     string
+		yaml     string
+		expected UnknownKeysError
+	}{
+		{
+			name: "known keys in any spelling",
+			yaml: `
+apiVersion: harvesterhci.io/v1beta1
+token: token
+os:
+  ssh_authorized_keys:
+  - github:user
+  ntp_server: pool.ntp.org
+  wifi:
+  - name: home
+    pass: secret
+install:
+  mgmt_interface: eth0
+  networks:
+  - interface: bond0
+    method: dhcp
+    vlan_id: 100
+    bond:
+      members:
+      - eth0
+      - eth1
+      mode: 802.3ad
+      miimon: 100
+    mtu: 9000
+    routes:
+    - destination: 10.10.0.0/16
+      gateway: 10.0.0.254
+      metric: 100
+  webhooks:
+  - event: FAILED
+    headers:
+      Content-Type:
+      - application/json
+`,
+		},
+		{
+			name: "secret references",
+			yaml: `
+token:
+  fromEnv: TOKEN
+install:
+  webhooks:
+  - basicAuth:
+      password:
+        fromFile: /run/secrets/hook
+`,
+		},
+		{
+			name: "misspelled keys",
+			yaml: `
+tokn: token
+os:
+  hostnme: node1
+install:
+  mgmtInterfce: eth0
+  networks:
+  - interface: eth0
+    methd: dhcp
+    bond:
+      membrs:
+      - eth1
+  foo: bar
+`,
+			expected: UnknownKeysError{
+				{Path: "install.foo"},
+				{Path: "install.mgmtInterfce", Suggestion: "mgmtInterface"},
+				{Path: "install.networks[0].bond.membrs", Suggestion: "members"},
+				{Path: "install.networks[0].methd", Suggestion: "method"},
+				{Path: "os.hostnme", Suggestion: "hostname"},
+				{Path: "tokn", Suggestion: "token"},
+			},
+		},
+		{
+			name: "multi-host config",
+			yaml: `
+token: token
+hosts:
+- match:
+    serail: SN0001
+  config:
+    install:
+      devce: /dev/sda
+  extra: true
+`,
+			expected: UnknownKeysError{
+				{Path: "hosts[0].config.install.devce", Suggestion: "device"},
+				{Path: "hosts[0].extra"},
+				{Path: "hosts[0].match.serail", Suggestion: "serial"},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := CheckUnknownKeys([]byte(testCase.yaml))
+			if testCase.expected == nil {
+				assert.Nil(t, err)
+				return
+			}
+			assert.Equal(t, testCase.expected, err)
+		})
+	}
+}
+
+func TestCheckUnknownCmdlineKeys(t *testing.T) {
+	// harvester.install.mgmt_interfce=eth0 harvester.install.device=/dev/sda
+	// harvester.install.device=/dev/sdb harvester.os.dns_nameservers=8.8.8.8
+	// harvester.tokne=secret
+	data := map[string]interface{}{
+		"install": map[string]interface{}{
+			"mgmt_interfce": "eth0",
+			"device":        []string{"/dev/sda", "/dev/sdb"},
+		},
+		"os": map[string]interface{}{
+			"dns_nameservers": "8.8.8.8",
+		},
+		"tokne": "secret",
+	}
+	assert.Equal(t, UnknownKeysError{
+		{Path: "harvester.install.mgmt_interfce", Suggestion: "mgmtInterface"},
+		{Path: "harvester.tokne", Suggestion: "token"},
+	}, checkUnknownCmdlineKeys(data))
+
+	assert.Nil(t, checkUnknownCmdlineKeys(map[string]interface{}{
+		"install": map[string]interface{}{"automatic": "true"},
+	}))
+}
+
+func TestUnknownKeysError(t *testing.T) {
+	err := UnknownKeysError{
+		{Path: "install.mgmtInterfce", Suggestion: "mgmtInterface"},
+		{Path: "install.foo"},
+	}
+	assert.Equal(t, "unknown key install.mgmtInterfce, did you mean mgmtInterface?\nunknown key install.foo", err.Error())
+}
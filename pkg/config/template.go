@@ -0,0 +1,52 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+var templateFuncs = template.FuncMap{
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": strings.ReplaceAll,
+	"dict":    templateDict,
+}
+
+// templateDict builds a lookup table from key value pairs, e.g.
+//
+//	{{ index (dict "SN0001" "10.0.0.11" "SN0002" "10.0.0.12") .Serial }}
+func templateDict(pairs ...string) (map[string]string, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict expects key value pairs, got %d arguments", len(pairs))
+	}
+	result := make(map[string]string, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		result[pairs[i]] = pairs[i+1]
+	}
+	return result, nil
+}
+
+// RenderHarvesterConfig renders a config template with the facts of the local
+// machine, e.g. {{ .Serial }} or {{ index .NICs "eth0" }}. Unlike webhook
+// templates, referring to a missing key is an error so that a typo does not
+// silently install a machine with an empty value.
+//
+// The whole document is rendered, webhook payloads included, so the templates
+// of webhook payloads must be escaped to be rendered when the webhooks fire,
+// e.g. {{`{{ .MACAddr }}`}}.
+func RenderHarvesterConfig(tmplBytes []byte, facts HostFacts) ([]byte, error) {
+	tmpl, err := template.New("config").Option("missingkey=error").Funcs(templateFuncs).Parse(string(tmplBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config template: %w", err)
+	}
+	bs := bytes.NewBuffer(nil)
+	if err := tmpl.Execute(bs, facts); err != nil {
+		if strings.Contains(err.Error(), "can't evaluate field") {
+			return nil, fmt.Errorf("failed to render config template: %w, templates of webhook payloads must be escaped, e.g. {{`{{ .MACAddr }}`}}", err)
+		}
+		return nil, fmt.Errorf("failed to render config template: %w", err)
+	}
+	return bs.Bytes(), nil
+}
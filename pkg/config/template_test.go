@@ -0,0 +1,109 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderHarvesterConfig(t *testing.T) {
+	facts := HostFacts{
+		NICs:     map[string]string{"eth0": "52:54:00:12:34:56"},
+		Serial:   "SN0002",
+		Hostname: "rancher",
+		CPUs:     8,
+		Disks: []Disk{
+			{Name: "sda", Path: "/dev/sda", Size: 500 << 30},
+			{Name: "nvme0n1", Path: "/dev/nvme0n1", Size: 1 << 40},
+		},
+		Cmdline: map[string]interface{}{
+			"harvester": map[string]interface{}{
+				"rack": "r1",
+			},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		template string
+		expected string
+		errMsg   string
+	}{
+		{
+			name:     "facts",
+			template: `hostname: node-{{ lower .Serial }}-{{ replace (index .NICs "eth0") ":" "" }}`,
+			expected: `hostname: node-sn0002-525400123456`,
+		},
+		{
+			name:     "lookup table",
+			template: `ip: {{ index (dict "SN0001" "10.0.0.11" "SN0002" "10.0.0.12") .Serial }}`,
+			expected: `ip: 10.0.0.12`,
+		},
+		{
+			name:     "disks and cpus",
+			template: `{{ range .Disks }}{{ if gt .Size 600000000000 }}device: {{ .Path }}{{ end }}{{ end }} {{ .CPUs }}`,
+			expected: `device: /dev/nvme0n1 8`,
+		},
+		{
+			name:     "cmdline",
+			template: `rack: {{ .Cmdline.harvester.rack }}`,
+			expected: `rack: r1`,
+		},
+		{
+			name:     "missing cmdline key",
+			template: `rack: {{ .Cmdline.harvester.row }}`,
+			errMsg:   "failed to render config template",
+		},
+		{
+			name:     "odd dict arguments",
+			template: `{{ dict "a" }}`,
+			errMsg:   "dict expects key value pairs",
+		},
+		{
+			name:     "unescaped webhook payload",
+			template: `payload: '{"mac": "{{ .MACAddr }}"}'`,
+			errMsg:   "templates of webhook payloads must be escaped",
+		},
+		{
+			name:     "invalid template",
+			template: `{{ .Serial `,
+			errMsg:   "failed to parse config template",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			b, err := RenderHarvesterConfig([]byte(testCase.template), facts)
+			if testCase.errMsg != "" {
+				assert.NotNil(t, err)
+				assert.Contains(t, err.Error(), testCase.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.expected, string(b))
+		})
+	}
+}
+
+func TestRenderHarvesterConfig_webhookPayload(t *testing.T) {
+	tmpl := `
+os:
+  hostname: node-{{ lower .Serial }}
+install:
+  webhooks:
+  - event: SUCCEEDED
+    method: POST
+    url: http://10.100.0.10/cblr/svc/op/nopxe/system/{{ .Hostname }}
+    payload: '{"host": "{{ .Hostname }}", "mac": "{{` + "`{{ .MACAddr }}`" + `}}"}'
+`
+	b, err := RenderHarvesterConfig([]byte(tmpl), HostFacts{Serial: "SN0002", Hostname: "rack1-07"})
+	assert.Nil(t, err)
+	c, err := LoadHarvesterConfig(b)
+	assert.Nil(t, err)
+	assert.Equal(t, "node-sn0002", c.OS.Hostname)
+	if assert.Len(t, c.Install.Webhooks, 1) {
+		// the payload is left for the webhook context to fill in
+		assert.Equal(t, `{"host": "rack1-07", "mac": "{{ .MACAddr }}"}`, c.Install.Webhooks[0].Payload)
+		assert.Equal(t, "http://10.100.0.10/cblr/svc/op/nopxe/system/rack1-07", c.Install.Webhooks[0].URL)
+	}
+}
@@ -1,11 +1,17 @@
 package config
 
 import (
+	"strings"
+
+	k3os "github.com/rancher/k3os/pkg/config"
 	"github.com/rancher/mapper/convert"
 	"gopkg.in/yaml.v2"
 )
 
 func PrintInstall(cfg HarvesterConfig) ([]byte, error) {
+	if cfg.Install.Encryption.Passphrase != "" {
+		cfg.Install.Encryption.Passphrase = SanitizeMask
+	}
 	data, err := convert.EncodeToMap(cfg.Install)
 	if err != nil {
 		return nil, err
@@ -15,6 +21,37 @@ func PrintInstall(cfg HarvesterConfig) ([]byte, error) {
 	return yaml.Marshal(data)
 }
 
+// PrintCloudConfig prints a k3os cloud config with its secrets masked
+func PrintCloudConfig(cloudConfig *k3os.CloudConfig) ([]byte, error) {
+	masked := *cloudConfig
+	if masked.K3OS.Password != "" {
+		masked.K3OS.Password = SanitizeMask
+	}
+	if masked.K3OS.Token != "" {
+		masked.K3OS.Token = SanitizeMask
+	}
+	masked.K3OS.Wifi = make([]k3os.Wifi, len(cloudConfig.K3OS.Wifi))
+	for i, wifi := range cloudConfig.K3OS.Wifi {
+		masked.K3OS.Wifi[i] = k3os.Wifi{Name: wifi.Name, Passphrase: SanitizeMask}
+	}
+	if cloudConfig.K3OS.Environment != nil {
+		masked.K3OS.Environment = make(map[string]string, len(cloudConfig.K3OS.Environment))
+		for key, value := range cloudConfig.K3OS.Environment {
+			switch strings.ToUpper(key) {
+			case "HTTP_PROXY", "HTTPS_PROXY":
+				value = MaskURLPassword(value)
+			}
+			masked.K3OS.Environment[key] = value
+		}
+	}
+
+	data, err := convert.EncodeToMap(masked)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(data)
+}
+
 func toYAMLKeys(data map[string]interface{}) {
 	for k, v := range data {
 		if sub, ok := v.(map[string]interface{}); ok {
@@ -9,6 +9,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/harvester/harvester-installer/pkg/config"
+	"github.com/harvester/harvester-installer/pkg/network"
 	"github.com/harvester/harvester-installer/pkg/widgets"
 )
 
@@ -35,6 +36,15 @@ type Console struct {
 	*gocui.Gui
 	elements map[string]widgets.Element
 	config   *config.HarvesterConfig
+	// provenance tracks which source supplied each field of config
+	provenance *config.Provenance
+	// remoteConfig is the remote config checked in the TUI, used to preview
+	// the cloud config before it is fetched again for installation
+	remoteConfig *config.HarvesterConfig
+	// diagnostics are the results of diagnosing the management network
+	diagnostics network.Diagnostics
+	// clockDiagnosis is the result of synchronizing the clock, nil until it is done
+	clockDiagnosis *network.Diagnosis
 }
 
 // RunConsole starts the console
@@ -56,10 +66,11 @@ func NewConsole() (*Console, error) {
 		return nil, err
 	}
 	return &Console{
-		context:  context.Background(),
-		Gui:      g,
-		elements: make(map[string]widgets.Element),
-		config:   config.NewHarvesterConfig(),
+		context:    context.Background(),
+		Gui:        g,
+		elements:   make(map[string]widgets.Element),
+		config:     config.NewHarvesterConfig(),
+		provenance: config.NewProvenance(),
 	}, nil
 }
 
@@ -93,6 +104,12 @@ func (c *Console) setContentByName(name string, content string) error {
 	return err
 }
 
+func (c *Console) recordProvenance(source config.Source) {
+	if err := c.provenance.Record(c.config, source); err != nil {
+		logrus.Errorf("fail to record config provenance: %s", err)
+	}
+}
+
 func (c *Console) CloseElement(name string) {
 	v, err := c.GetElement(name)
 	if err != nil {
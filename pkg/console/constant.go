@@ -4,6 +4,11 @@ const (
 	titlePanel            = "title"
 	debugPanel            = "debug"
 	diskPanel             = "disk"
+	mirrorDiskPanel       = "mirrorDisk"
+	dataDiskPanel         = "dataDisk"
+	confirmWipePanel      = "confirmWipe"
+	encryptionPanel       = "encryption"
+	encryptConfirmPanel   = "encryptionConfirm"
 	askCreatePanel        = "askCreate"
 	serverURLPanel        = "serverUrl"
 	passwordPanel         = "osPassword"
@@ -11,13 +16,30 @@ const (
 	sshKeyPanel           = "sshKey"
 	tokenPanel            = "token"
 	proxyPanel            = "proxy"
+	httpsProxyPanel       = "httpsProxy"
+	noProxyPanel          = "noProxy"
 	askInterfacePanel     = "askInterface"
 	askNetworkMethodPanel = "askNetworkMethod"
 	hostNamePanel         = "hostname"
 	addressPanel          = "address"
 	gatewayPanel          = "gateway"
+	askIPv6MethodPanel    = "askIPv6Method"
+	ipv6AddressPanel      = "ipv6Address"
+	ipv6GatewayPanel      = "ipv6Gateway"
 	dnsServersPanel       = "dnsServers"
+	bondModePanel         = "bondMode"
+	bondMembersPanel      = "bondMembers"
+	bondMiimonPanel       = "bondMiimon"
+	vlanIDPanel           = "vlanId"
+	mtuPanel              = "mtu"
+	routesPanel           = "routes"
+	ntpServersPanel       = "ntpServers"
 	networkValidatorPanel = "networkValidator"
+	diagnosticsPanel      = "diagnostics"
+	vipPanel              = "vip"
+	clusterCIDRPanel      = "clusterCidr"
+	serviceCIDRPanel      = "serviceCidr"
+	clusterDomainPanel    = "clusterDomain"
 	cloudInitPanel        = "cloudInit"
 	validatorPanel        = "validator"
 	notePanel             = "note"
@@ -26,6 +48,8 @@ const (
 	spinnerPanel          = "spinner"
 	confirmInstallPanel   = "confirmInstall"
 	confirmUpgradePanel   = "confirmUpgrade"
+	cloudConfigPanel      = "cloudConfig"
+	saveCloudConfigPanel  = "saveCloudConfig"
 	upgradePanel          = "upgrade"
 
 	modeCreate  = "create"
@@ -38,18 +62,124 @@ const (
 	hostNameLabel         = "HostName"
 	addressLabel          = "IPv4 Address"
 	gatewayLabel          = "Gateway"
+	askIPv6MethodLabel    = "IPv6 Method"
+	ipv6AddressLabel      = "IPv6 Address"
+	ipv6GatewayLabel      = "IPv6 Gateway"
 	dnsServersLabel       = "DNS Servers"
+	linkTitle             = "Configure bond and VLAN"
+	bondModeLabel         = "Bond Mode"
+	bondMembersLabel      = "NICs"
+	bondMiimonLabel       = "MII Monitor (ms)"
+	vlanIDLabel           = "VLAN ID"
+	bondModeNoneText      = "None"
+	advancedNetworkTitle  = "Optional: configure MTU and static routes"
+	mtuLabel              = "MTU"
+	routesLabel           = "Routes"
+	ntpTitle              = "Optional: configure NTP servers"
+	ntpServersLabel       = "NTP Servers"
+	defaultNTPServer      = "ntp.ubuntu.com"
+	vipTitle              = "Optional: configure the management VIP"
+	vipLabel              = "VIP"
+	clusterNetworkTitle   = "Optional: configure cluster networks"
+	clusterCIDRLabel      = "Cluster CIDR"
+	serviceCIDRLabel      = "Service CIDR"
+	clusterDomainLabel    = "Cluster Domain"
+
+	diagnosticsTitle      = "Network diagnostics"
+	diagnosticsFailedNote = "Some checks failed, the installation may not reach what it needs.\nGo back to change the network or continue anyway."
+
+	// the management NIC option that opens the bond and VLAN page
+	networkLinkOption     = "bond/vlan"
+	networkLinkOptionText = "Bond / VLAN"
 
 	networkMethodDHCP       = "dhcp"
 	networkMethodDHCPText   = "Automatic (DHCP)"
 	networkMethodStatic     = "static"
 	networkMethodStaticText = "Static"
+	networkMethodNone       = "none"
+	networkMethodNoneText   = "Disabled"
+	networkMethodSLAAC      = "slaac"
+	networkMethodSLAACText  = "Automatic (SLAAC)"
+	networkMethodDHCPv6     = "dhcpv6"
+	networkMethodDHCPv6Text = "Automatic (DHCPv6)"
+
+	defaultClusterCIDR   = "10.52.0.0/16"
+	defaultServiceCIDR   = "10.53.0.0/16"
+	defaultClusterDomain = "cluster.local"
+	// the cluster DNS is the tenth address of the service CIDR as in k3s
+	clusterDNSOffset     = 10
+	maxServiceCIDRPrefix = 28
+
+	// partitions of the installation device, sized in MiB
+	partitionBoot    = "boot"
+	partitionState   = "state"
+	partitionRancher = "rancher"
+	partitionLog     = "log"
+	partitionKernel  = "kernel"
+	partitionFill    = "fill"
+	defaultBootSize  = 50
+	defaultStateSize = 20480
+	minBootSize      = 32
+	minStateSize     = 8192
+	minPartitionSize = 1024
+	partitionsEnv    = "K3OS_INSTALL_PARTITIONS"
+	mirrorDeviceEnv  = "K3OS_INSTALL_MIRROR_DEVICE"
+	dataDeviceEnv    = "K3OS_INSTALL_DATA_DEVICE"
+	mib              = 1024 * 1024
+	// parted aligns the first partition at 1MiB
+	partitionAlignment = 1
+	// the kernel partition of encrypted installations keeps the running
+	// kernel and the upgraded one
+	defaultKernelSize = 1024
+	minKernelSize     = 512
+
+	// the passphrase is passed in a file to keep it out of the traces of the
+	// installer
+	encryptionPassphraseFileEnv = "K3OS_INSTALL_ENCRYPTION_PASSPHRASE_FILE"
+	encryptionKeyFileEnv        = "K3OS_INSTALL_ENCRYPTION_KEY_FILE"
+	encryptionKeyLabelEnv       = "K3OS_INSTALL_ENCRYPTION_KEY_LABEL"
+	defaultEncryptionKeyLabel   = "HARVESTER_KEY"
+
+	defaultBondInterface = "bond0"
+	maxVLANID            = 4094
+	minMTU               = 576
+	minIPv6MTU           = 1280
+	maxMTU               = 9216
 
 	clusterTokenCreateNote = "Note: The token is used for adding nodes to the cluster"
 	clusterTokenJoinNote   = "Note: Input the token of the existing cluster"
-	serverURLNote          = "Note: Input IP/domain name of the management node"
-	proxyNote              = "Note: In the form of \"http://[[user][:pass]@]host[:port]/\"."
+	serverURLNote          = "Note: Input the VIP of the cluster, shown in the management URL of its dashboard,\nor IP/domain name of a management node"
+	proxyNote              = "Note: In the form of \"http://[[user][:pass]@]host[:port]/\". The HTTPS proxy defaults to the HTTP proxy.\nSeparate the hosts to reach directly by commas, the cluster and service CIDRs and the node IP are added to them."
+	routesNote             = "Note: Separate routes by commas, e.g. \"10.10.0.0/16 via 10.0.0.254 metric 100\"."
+	ntpServersNote         = "Note: Separate servers by commas. The clock is synchronized before going on, leave empty to skip."
+	vipNote                = "Note: The VIP floats between the management nodes, it must be an unused address of the management subnet.\nLeave empty to use the address of this node."
+	clusterNetworkNote     = "Note: The pods and services get addresses of the cluster and service CIDRs, which must not overlap the networks of the node.\nThe cluster DNS is the tenth address of the service CIDR."
+	confirmWipeNote        = "Note: All the data on the disk will be lost. Type the device name, e.g. /dev/sda, to wipe it."
+	encryptionNote         = "Note: The passphrase is typed on the console on every boot to unlock the installation. Leave empty to not encrypt it."
 	sshKeyNote             = "For example: https://github.com/<username>.keys"
 
 	authorizedFile = "/home/rancher/.ssh/authorized_keys"
+	provenanceFile = "/var/log/harvester-config-sources.yaml"
+	// default path to save the previewed cloud config to
+	cloudConfigFile = "/tmp/harvester-cloud-config.yaml"
+	// public key baked into the ISO to verify remote configs and SSH keys
+	configPublicKeyFile = "/etc/harvester/config-signing.pub"
+	// suffix of the URL of the detached signature of a remote file
+	signatureSuffix = ".sig"
+	// networks applied on every boot of the installed system
+	networksFile = "/etc/harvester/networks.yaml"
+	// connman service config, which lists the links connman must not touch
+	connmanConfFile = "/etc/conf.d/connman"
+	connmanWantWifi = `rc_want="wpa_supplicant"`
 )
+
+// Linux bonding modes
+var bondModes = []string{
+	"balance-rr",
+	"active-backup",
+	"balance-xor",
+	"broadcast",
+	"802.3ad",
+	"balance-tlb",
+	"balance-alb",
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/jroimartin/gocui"
 	"github.com/sirupsen/logrus"
 
+	"github.com/harvester/harvester-installer/pkg/disk"
 	"github.com/harvester/harvester-installer/pkg/util"
 	"github.com/harvester/harvester-installer/pkg/version"
 	"github.com/harvester/harvester-installer/pkg/widgets"
@@ -68,7 +69,7 @@ func (c *Console) layoutDashboard(g *gocui.Gui) error {
 		v.Wrap = true
 		go syncManagementURL(context.Background(), g)
 	}
-	if v, err := g.SetView("status", maxX/2-40, 14, maxX/2+40, 18); err != nil {
+	if v, err := g.SetView("status", maxX/2-40, 14, maxX/2+40, 20); err != nil {
 		if err != gocui.ErrUnknownView {
 			return err
 		}
@@ -213,8 +214,10 @@ func syncManagementURL(ctx context.Context, g *gocui.Gui) {
 
 func doSyncManagementURL(g *gocui.Gui) {
 	managementURL := "Unavailable"
-	if managementIP := getFirstReadyMasterIP(); managementIP != "" {
-		managementURL = fmt.Sprintf("https://%s:%s", managementIP, harvesterNodePort)
+	if vip := getVIP(); vip != "" {
+		managementURL = fmt.Sprintf("https://%s", net.JoinHostPort(vip, harvesterNodePort))
+	} else if managementIP := getFirstReadyMasterIP(); managementIP != "" {
+		managementURL = fmt.Sprintf("https://%s", net.JoinHostPort(managementIP, harvesterNodePort))
 	}
 	g.Update(func(g *gocui.Gui) error {
 		v, err := g.View("url")
@@ -288,6 +291,9 @@ func syncHarvesterStatus(ctx context.Context, g *gocui.Gui) {
 
 func doSyncHarvesterStatus(g *gocui.Gui) {
 	status := getHarvesterStatus()
+	if raidStatus := getRAIDStatus(); raidStatus != "" {
+		status += "\n\n" + raidStatus
+	}
 	g.Update(func(g *gocui.Gui) error {
 		v, err := g.View("status")
 		if err != nil {
@@ -382,6 +388,27 @@ func getHarvesterStatus() string {
 	return wrapColor(statusNotReady, colorYellow)
 }
 
+// getRAIDStatus warns about the degraded arrays of a mirrored installation
+func getRAIDStatus() string {
+	arrays, err := disk.Arrays()
+	if err != nil {
+		logrus.Error(err)
+		return ""
+	}
+	var degraded []string
+	for _, array := range arrays {
+		if !array.Active {
+			degraded = append(degraded, array.Name+" inactive")
+		} else if array.Degraded() {
+			degraded = append(degraded, fmt.Sprintf("%s [%s]", array.Name, array.Status))
+		}
+	}
+	if len(degraded) == 0 {
+		return ""
+	}
+	return wrapColor("RAID degraded: "+strings.Join(degraded, ", "), colorRed)
+}
+
 func wrapColor(s string, color int) string {
 	return fmt.Sprintf("\033[3%d;7m%s\033[0m", color, s)
 }
@@ -0,0 +1,36 @@
+package console
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+	"github.com/harvester/harvester-installer/pkg/disk"
+)
+
+// resolveDevices replaces the disks of the installation given by stable
+// identifiers, e.g. /dev/disk/by-id/..., or by selectors with their device
+// paths. A selector doesn't pick a disk already chosen for the installation.
+func resolveDevices(install *config.Install) error {
+	if err := checkDeviceSelectors(*install); err != nil {
+		return err
+	}
+	var resolved []string
+	for _, device := range []*string{&install.Device, &install.MirrorDevice, &install.DataDisk} {
+		if *device == "" {
+			continue
+		}
+		d, err := disk.Resolve(*device, resolved...)
+		if err != nil {
+			return err
+		}
+		if d == nil {
+			return prettyError(ErrMsgDeviceNotFound, *device)
+		}
+		if d.Path != *device {
+			logrus.Infof("Resolved %s to %s: %s", *device, d.Path, d.Description())
+		}
+		*device = d.Path
+		resolved = append(resolved, d.Path)
+	}
+	return nil
+}
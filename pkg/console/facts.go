@@ -0,0 +1,82 @@
+package console
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+	"github.com/harvester/harvester-installer/pkg/disk"
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+const (
+	dmiPath = "/sys/class/dmi/id"
+)
+
+func readDMI(name string) string {
+	b, err := ioutil.ReadFile(dmiPath + "/" + name)
+	if err != nil {
+		logrus.Debugf("fail to read DMI %s: %s", name, err)
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func getNICs() map[string]string {
+	nics := map[string]string{}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		logrus.Error(err)
+		return nil
+	}
+	for _, i := range ifaces {
+		if i.Flags&net.FlagLoopback != 0 || len(i.HardwareAddr) == 0 {
+			continue
+		}
+		nics[i.Name] = i.HardwareAddr.String()
+	}
+	return nics
+}
+
+func getDisks() []config.Disk {
+	disks, err := disk.List()
+	if err != nil {
+		logrus.Error(err)
+		return nil
+	}
+	var result []config.Disk
+	for _, d := range disks {
+		result = append(result, config.Disk{
+			Name: d.Name,
+			Path: d.Path,
+			Size: d.Size,
+		})
+	}
+	return result
+}
+
+// getHostFacts gathers the facts used to select the host entry of a multi-host
+// config and to render config templates
+func getHostFacts() config.HostFacts {
+	hostname, _ := os.Hostname()
+	cmdline, err := util.ReadCmdline("")
+	if err != nil {
+		logrus.Errorf("fail to read kernel parameters: %s", err)
+	}
+	facts := config.HostFacts{
+		NICs:     getNICs(),
+		Serial:   readDMI("product_serial"),
+		UUID:     readDMI("product_uuid"),
+		Hostname: hostname,
+		CPUs:     runtime.NumCPU(),
+		Disks:    getDisks(),
+		Cmdline:  cmdline,
+	}
+	logrus.Debugf("host facts %+v", facts)
+	return facts
+}
@@ -2,20 +2,26 @@ package console
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net"
+	"net/url"
 	"os"
-	"os/exec"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/imdario/mergo"
 	"github.com/jroimartin/gocui"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
 	"k8s.io/apimachinery/pkg/util/validation"
 
 	"github.com/harvester/harvester-installer/pkg/config"
+	"github.com/harvester/harvester-installer/pkg/disk"
+	"github.com/harvester/harvester-installer/pkg/network"
 	"github.com/harvester/harvester-installer/pkg/util"
 	"github.com/harvester/harvester-installer/pkg/version"
 	"github.com/harvester/harvester-installer/pkg/widgets"
@@ -28,6 +34,19 @@ type UserInputData struct {
 	PasswordConfirm string
 	Address         string
 	DNSServers      string
+	BondMode        string
+	BondMembers     string
+	BondMiimon      string
+	VLANID          string
+	MTU             string
+	Routes          string
+	NTPServers      string
+	HTTPProxy       string
+	HTTPSProxy      string
+	NoProxy         string
+	ClusterCIDR     string
+	ServiceCIDR     string
+	ClusterDomain   string
 }
 
 const (
@@ -39,28 +58,48 @@ const (
 
 var (
 	once          sync.Once
-	userInputData = UserInputData{}
-	mgmtNetwork   = config.Network{}
+	userInputData = UserInputData{
+		NTPServers: defaultNTPServer,
+	}
+	mgmtNetwork = config.Network{}
+	// disks the user has confirmed to wipe, by device
+	confirmedWipes = map[string]bool{}
+	pendingWipe    wipe
 )
 
+// wipe is a disk waiting for the confirmation to wipe it
+type wipe struct {
+	disk disk.Disk
+	// prev is the panel to go back to
+	prev string
+	next func() error
+}
+
 func (c *Console) layoutInstall(g *gocui.Gui) error {
 	var err error
 	once.Do(func() {
 		setPanels(c)
 		initPanel := askCreatePanel
 
-		c.config.OS.NTPServers = []string{"ntp.ubuntu.com"}
 		c.config.OS.Modules = []string{"kvm", "vhost_net"}
+		c.recordProvenance(config.SourceDefault)
 
 		if cfg, err := config.ReadConfig(); err == nil {
 			if cfg.Install.Automatic {
 				logrus.Info("Start automatic installation...")
 				mergo.Merge(c.config, cfg, mergo.WithAppendSlice)
+				c.recordProvenance(config.SourceCmdline)
 				if cfg.Install.Mode == modeUpgrade {
 					initPanel = upgradePanel
 				} else {
 					initPanel = installPanel
 				}
+			} else if cfg.Install.ConfigPublicKey != "" || cfg.Install.ConfigTemplate {
+				// the signing key and the templating of the remote config
+				// apply to interactive installations too
+				c.config.Install.ConfigPublicKey = cfg.Install.ConfigPublicKey
+				c.config.Install.ConfigTemplate = cfg.Install.ConfigTemplate
+				c.recordProvenance(config.SourceCmdline)
 			}
 		}
 
@@ -93,7 +132,15 @@ func setPanels(c *Console) error {
 		addFooterPanel,
 		addAskCreatePanel,
 		addDiskPanel,
+		addMirrorDiskPanel,
+		addDataDiskPanel,
+		addConfirmWipePanel,
+		addEncryptionPanels,
 		addNetworkPanel,
+		addNTPPanel,
+		addNetworkDiagnosticsPanel,
+		addVIPPanel,
+		addClusterNetworkPanel,
 		addServerURLPanel,
 		addTokenPanel,
 		addPasswordPanels,
@@ -101,6 +148,8 @@ func setPanels(c *Console) error {
 		addProxyPanel,
 		addCloudInitPanel,
 		addConfirmInstallPanel,
+		addCloudConfigPanel,
+		addSaveCloudConfigPanel,
 		addConfirmUpgradePanel,
 		addInstallPanel,
 		addSpinnerPanel,
@@ -164,9 +213,21 @@ func addDiskPanel(c *Console) error {
 			if err != nil {
 				return err
 			}
+			if err := checkDevice(device, c.config.Install); err != nil {
+				return c.setContentByName(validatorPanel, err.Error())
+			}
 			c.config.Install.Device = device
+			if c.config.Install.MirrorDevice == device {
+				c.config.Install.MirrorDevice = ""
+			}
+			if c.config.Install.DataDisk == device {
+				c.config.Install.DataDisk = ""
+			}
+			c.CloseElement(validatorPanel)
 			diskV.Close()
-			return showNetworkPage(c)
+			return confirmWipe(c, device, diskPanel, func() error {
+				return showNext(c, mirrorDiskPanel)
+			})
 		},
 		gocui.KeyEsc: func(g *gocui.Gui, v *gocui.View) error {
 			diskV.Close()
@@ -182,23 +243,280 @@ func addDiskPanel(c *Console) error {
 }
 
 func getDiskOptions() ([]widgets.Option, error) {
-	output, err := exec.Command("/bin/sh", "-c", `lsblk -r -o NAME,SIZE,TYPE | grep -w disk|cut -d ' ' -f 1,2`).CombinedOutput()
+	disks, err := disk.List()
 	if err != nil {
 		return nil, err
 	}
-	lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
 	var options []widgets.Option
-	for _, line := range lines {
-		splits := strings.SplitN(line, " ", 2)
-		if len(splits) == 2 {
-			options = append(options, widgets.Option{
-				Value: "/dev/" + splits[0],
-				Text:  line,
+	for _, d := range disks {
+		options = append(options, widgets.Option{
+			Value: d.Path,
+			Text:  fmt.Sprintf("%s  %s", d.Path, d.Description()),
+		})
+	}
+	return options, nil
+}
+
+func addMirrorDiskPanel(c *Console) error {
+	mirrorDiskV, err := widgets.NewSelect(c.Gui, mirrorDiskPanel, "", func() ([]widgets.Option, error) {
+		return getOtherDiskOptions("None, install on a single disk", c.config.Install.Device)
+	})
+	if err != nil {
+		return err
+	}
+	mirrorDiskV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyEnter: func(g *gocui.Gui, v *gocui.View) error {
+			mirrorDisk, err := mirrorDiskV.GetData()
+			if err != nil {
+				return err
+			}
+			if mirrorDisk != "" {
+				if err := checkDevice(mirrorDisk, c.config.Install); err != nil {
+					return c.setContentByName(validatorPanel, err.Error())
+				}
+			}
+			c.config.Install.MirrorDevice = mirrorDisk
+			if c.config.Install.DataDisk == mirrorDisk {
+				c.config.Install.DataDisk = ""
+			}
+			c.CloseElement(validatorPanel)
+			mirrorDiskV.Close()
+			return confirmWipe(c, mirrorDisk, mirrorDiskPanel, func() error {
+				return showNext(c, dataDiskPanel)
+			})
+		},
+		gocui.KeyEsc: func(g *gocui.Gui, v *gocui.View) error {
+			c.CloseElement(validatorPanel)
+			mirrorDiskV.Close()
+			return showNext(c, diskPanel)
+		},
+	}
+	mirrorDiskV.PreShow = func() error {
+		mirrorDiskV.Value = c.config.Install.MirrorDevice
+		return c.setContentByName(titlePanel, "Choose a second disk to mirror the installation. Disk will be formatted")
+	}
+	c.AddElement(mirrorDiskPanel, mirrorDiskV)
+	return nil
+}
+
+func addDataDiskPanel(c *Console) error {
+	dataDiskV, err := widgets.NewSelect(c.Gui, dataDiskPanel, "", func() ([]widgets.Option, error) {
+		return getOtherDiskOptions("None, store VMs on the installation device", c.config.Install.Device, c.config.Install.MirrorDevice)
+	})
+	if err != nil {
+		return err
+	}
+	dataDiskV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyEnter: func(g *gocui.Gui, v *gocui.View) error {
+			dataDisk, err := dataDiskV.GetData()
+			if err != nil {
+				return err
+			}
+			if dataDisk != "" {
+				if err := checkDataDisk(dataDisk, c.config.Install.Device, c.config.Install.MirrorDevice); err != nil {
+					return c.setContentByName(validatorPanel, err.Error())
+				}
+			}
+			c.config.Install.DataDisk = dataDisk
+			c.CloseElement(validatorPanel)
+			dataDiskV.Close()
+			return confirmWipe(c, dataDisk, dataDiskPanel, func() error {
+				return showNext(c, encryptConfirmPanel, encryptionPanel)
 			})
+		},
+		gocui.KeyEsc: func(g *gocui.Gui, v *gocui.View) error {
+			c.CloseElement(validatorPanel)
+			dataDiskV.Close()
+			return showNext(c, mirrorDiskPanel)
+		},
+	}
+	dataDiskV.PreShow = func() error {
+		dataDiskV.Value = c.config.Install.DataDisk
+		return c.setContentByName(titlePanel, "Choose a data disk for VM storage. Existing Harvester data is kept, other contents will be erased")
+	}
+	c.AddElement(dataDiskPanel, dataDiskV)
+	return nil
+}
+
+// getOtherDiskOptions returns the disks other than the installation devices,
+// after the option to choose none of them
+func getOtherDiskOptions(noneText string, devices ...string) ([]widgets.Option, error) {
+	options, err := getDiskOptions()
+	if err != nil {
+		return nil, err
+	}
+	otherOptions := []widgets.Option{
+		{
+			Value: "",
+			Text:  noneText,
+		},
+	}
+	for _, option := range options {
+		if !util.StringSliceContains(devices, option.Value) {
+			otherOptions = append(otherOptions, option)
+		}
+	}
+	return otherOptions, nil
+}
+
+func addEncryptionPanels(c *Console) error {
+	maxX, maxY := c.Gui.Size()
+	passphraseV, err := widgets.NewInput(c.Gui, encryptionPanel, "Passphrase", true)
+	if err != nil {
+		return err
+	}
+	passphraseConfirmV, err := widgets.NewInput(c.Gui, encryptConfirmPanel, "Confirm passphrase", true)
+	if err != nil {
+		return err
+	}
+	var passphraseConfirm string
+	closeThisPage := func() {
+		c.CloseElement(notePanel)
+		passphraseV.Close()
+		passphraseConfirmV.Close()
+	}
+	gotoNextPage := func() error {
+		closeThisPage()
+		return showNetworkPage(c)
+	}
+	gotoPrevPage := func(g *gocui.Gui, v *gocui.View) error {
+		closeThisPage()
+		return showNext(c, dataDiskPanel)
+	}
+
+	passphraseV.PreShow = func() error {
+		c.Gui.Cursor = true
+		passphraseV.Value = c.config.Install.Encryption.Passphrase
+		if err := c.setContentByName(notePanel, encryptionNote); err != nil {
+			return err
+		}
+		return c.setContentByName(titlePanel, "Encrypt the installation")
+	}
+	passphraseVConfirm := func(g *gocui.Gui, v *gocui.View) error {
+		passphrase, err := passphraseV.GetData()
+		if err != nil {
+			return err
+		}
+		if passphrase == "" {
+			c.config.Install.Encryption.Passphrase = ""
+			passphraseConfirm = ""
+			return gotoNextPage()
 		}
+		return showNext(c, encryptConfirmPanel)
 	}
+	passphraseV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyEnter:     passphraseVConfirm,
+		gocui.KeyArrowDown: passphraseVConfirm,
+		gocui.KeyEsc:       gotoPrevPage,
+	}
+	passphraseV.SetLocation(maxX/8, maxY/8, maxX/8*7, maxY/8+2)
+	c.AddElement(encryptionPanel, passphraseV)
 
-	return options, nil
+	passphraseConfirmV.PreShow = func() error {
+		c.Gui.Cursor = true
+		passphraseConfirmV.Value = passphraseConfirm
+		return nil
+	}
+	passphraseConfirmV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyArrowUp: func(g *gocui.Gui, v *gocui.View) error {
+			passphraseConfirm, err = passphraseConfirmV.GetData()
+			if err != nil {
+				return err
+			}
+			return showNext(c, encryptionPanel)
+		},
+		gocui.KeyEnter: func(g *gocui.Gui, v *gocui.View) error {
+			passphrase, err := passphraseV.GetData()
+			if err != nil {
+				return err
+			}
+			passphraseConfirm, err = passphraseConfirmV.GetData()
+			if err != nil {
+				return err
+			}
+			if passphrase != passphraseConfirm {
+				return c.setContentByName(validatorPanel, "Passphrase mismatching")
+			}
+			install := c.config.Install
+			install.Encryption.Passphrase = passphrase
+			// the kernel partition takes room on the disks
+			for _, device := range []string{install.Device, install.MirrorDevice} {
+				if device == "" {
+					continue
+				}
+				if err := checkDevice(device, install); err != nil {
+					return c.setContentByName(validatorPanel, err.Error())
+				}
+			}
+			c.config.Install.Encryption.Passphrase = passphrase
+			return gotoNextPage()
+		},
+		gocui.KeyEsc: gotoPrevPage,
+	}
+	passphraseConfirmV.SetLocation(maxX/8, maxY/8+3, maxX/8*7, maxY/8+5)
+	c.AddElement(encryptConfirmPanel, passphraseConfirmV)
+
+	return nil
+}
+
+// confirmWipe asks to type the name of the device before going on to the next
+// page if there is anything on the disk. A formatted data disk is kept as it
+// is.
+func confirmWipe(c *Console, device string, prev string, next func() error) error {
+	if device == "" || confirmedWipes[device] {
+		return next()
+	}
+	d, err := disk.Find(device)
+	if err != nil {
+		return err
+	}
+	if d == nil || !d.InUse() || (device == c.config.Install.DataDisk && d.HasData()) {
+		return next()
+	}
+	pendingWipe = wipe{disk: *d, prev: prev, next: next}
+	return showNext(c, confirmWipePanel)
+}
+
+func addConfirmWipePanel(c *Console) error {
+	confirmWipeV, err := widgets.NewInput(c.Gui, confirmWipePanel, "Device name", false)
+	if err != nil {
+		return err
+	}
+	confirmWipeV.PreShow = func() error {
+		c.Gui.Cursor = true
+		confirmWipeV.Value = ""
+		if err := c.setContentByName(notePanel, confirmWipeNote); err != nil {
+			return err
+		}
+		d := pendingWipe.disk
+		return c.setContentByName(titlePanel, fmt.Sprintf("%s has %s", d.Path, d.Contents()))
+	}
+	closeThisPage := func() error {
+		c.Gui.Cursor = false
+		c.CloseElement(notePanel)
+		c.CloseElement(validatorPanel)
+		return confirmWipeV.Close()
+	}
+	confirmWipeV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyEnter: func(g *gocui.Gui, v *gocui.View) error {
+			device, err := confirmWipeV.GetData()
+			if err != nil {
+				return err
+			}
+			if device != pendingWipe.disk.Path {
+				return c.setContentByName(validatorPanel, fmt.Sprintf("Type %s to wipe the disk, or press Esc to choose another one", pendingWipe.disk.Path))
+			}
+			confirmedWipes[device] = true
+			closeThisPage()
+			return pendingWipe.next()
+		},
+		gocui.KeyEsc: func(g *gocui.Gui, v *gocui.View) error {
+			closeThisPage()
+			return showNext(c, pendingWipe.prev)
+		},
+	}
+	c.AddElement(confirmWipePanel, confirmWipeV)
+	return nil
 }
 
 func addAskCreatePanel(c *Console) error {
@@ -262,6 +580,12 @@ func addServerURLPanel(c *Console) error {
 	}
 	serverURLV.PreShow = func() error {
 		c.Gui.Cursor = true
+		if userInputData.ServerURL == "" && c.config.ServerURL != "" {
+			// suggest the address of the remote config, e.g. the VIP of the cluster
+			if u, err := url.Parse(c.config.ServerURL); err == nil {
+				userInputData.ServerURL = u.Hostname()
+			}
+		}
 		serverURLV.Value = userInputData.ServerURL
 		if err := c.setContentByName(titlePanel, "Configure management address"); err != nil {
 			return err
@@ -317,7 +641,7 @@ func addServerURLPanel(c *Console) error {
 		gocui.KeyEsc: func(g *gocui.Gui, v *gocui.View) error {
 			g.Cursor = false
 			serverURLV.Close()
-			return showNetworkPage(c)
+			return showNext(c, diagnosticsPanel)
 		},
 	}
 	serverURLV.PostClose = func() error {
@@ -405,7 +729,7 @@ func addPasswordPanels(c *Console) error {
 				return err
 			}
 			c.config.Password = encrypted
-			return showNext(c, proxyPanel)
+			return showProxyPage(c)
 		},
 		gocui.KeyEsc: func(g *gocui.Gui, v *gocui.View) error {
 			passwordV.Close()
@@ -464,7 +788,15 @@ func addSSHKeyPanel(c *Console) error {
 				spinner.Start()
 
 				go func(g *gocui.Gui) {
-					pubKeys, err := getRemoteSSHKeys(url)
+					signingKey, err := getConfigPublicKey(c.config)
+					if err != nil {
+						spinner.Stop(true, err.Error())
+						g.Update(func(g *gocui.Gui) error {
+							return showNext(c, sshKeyPanel)
+						})
+						return
+					}
+					pubKeys, err := getRemoteSSHKeys(url, signingKey)
 					if err != nil {
 						spinner.Stop(true, err.Error())
 						g.Update(func(g *gocui.Gui) error {
@@ -485,7 +817,7 @@ func addSSHKeyPanel(c *Console) error {
 		},
 		gocui.KeyEsc: func(g *gocui.Gui, v *gocui.View) error {
 			closeThisPage()
-			return showNext(c, proxyPanel)
+			return showProxyPage(c)
 		},
 	}
 	sshKeyV.PostClose = func() error {
@@ -502,102 +834,351 @@ func addSSHKeyPanel(c *Console) error {
 	return nil
 }
 
-func addTokenPanel(c *Console) error {
-	tokenV, err := widgets.NewInput(c.Gui, tokenPanel, "Cluster token", false)
+func addVIPPanel(c *Console) error {
+	vipV, err := widgets.NewInput(c.Gui, vipPanel, vipLabel, false)
 	if err != nil {
 		return err
 	}
-	tokenV.PreShow = func() error {
+	vipV.PreShow = func() error {
 		c.Gui.Cursor = true
-		tokenV.Value = c.config.Token
-		tokenNote := clusterTokenJoinNote
-		if c.config.Install.Mode == modeCreate {
-			tokenNote = clusterTokenCreateNote
-		}
-		if err = c.setContentByName(notePanel, tokenNote); err != nil {
+		vipV.Value = c.config.VIP
+		if err := c.setContentByName(titlePanel, vipTitle); err != nil {
 			return err
 		}
-		return c.setContentByName(titlePanel, "Configure cluster token")
+		return c.setContentByName(notePanel, vipNote)
 	}
-	closeThisPage := func() error {
+	gotoNextPage := func() error {
+		vipV.Close()
 		c.CloseElement(notePanel)
-		return tokenV.Close()
+		return showClusterNetworkPage(c)
 	}
-	tokenV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+	vipV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
 		gocui.KeyEnter: func(g *gocui.Gui, v *gocui.View) error {
-			token, err := tokenV.GetData()
+			asyncTaskV, err := c.GetElement(spinnerPanel)
 			if err != nil {
 				return err
 			}
-			if token == "" {
-				return c.setContentByName(validatorPanel, "Cluster token is required")
+			asyncTaskV.Close()
+
+			vip, err := vipV.GetData()
+			if err != nil {
+				return err
 			}
-			c.config.Token = token
-			closeThisPage()
-			return showNext(c, passwordConfirmPanel, passwordPanel)
+			if vip == "" {
+				c.CloseElement(validatorPanel)
+				c.config.VIP = ""
+				return gotoNextPage()
+			}
+			if err := checkVIP(vip, mgmtNetwork); err != nil {
+				return c.setContentByName(validatorPanel, err.Error())
+			}
+			c.CloseElement(validatorPanel)
+
+			// focus on task panel to prevent input
+			asyncTaskV.Show()
+			spinner := NewSpinner(c.Gui, spinnerPanel, fmt.Sprintf("Checking %s is unused...", vip))
+			spinner.Start()
+			go func(g *gocui.Gui) {
+				if err := checkVIPAvailable(vip, mgmtNetwork); err != nil {
+					spinner.Stop(true, err.Error())
+					g.Update(func(g *gocui.Gui) error {
+						return showNext(c, vipPanel)
+					})
+					return
+				}
+				spinner.Stop(false, "")
+				c.config.VIP = vip
+				g.Update(func(g *gocui.Gui) error {
+					return gotoNextPage()
+				})
+			}(c.Gui)
+			return nil
 		},
 		gocui.KeyEsc: func(g *gocui.Gui, v *gocui.View) error {
-			closeThisPage()
-			if c.config.Install.Mode == modeCreate {
-				g.Cursor = false
-				return showNetworkPage(c)
-			}
-			return showNext(c, serverURLPanel)
+			g.Cursor = false
+			vipV.Close()
+			c.CloseElement(notePanel)
+			return showNext(c, diagnosticsPanel)
 		},
 	}
-	c.AddElement(tokenPanel, tokenV)
+	vipV.PostClose = func() error {
+		asyncTaskV, err := c.GetElement(spinnerPanel)
+		if err != nil {
+			return err
+		}
+		return asyncTaskV.Close()
+	}
+	c.AddElement(vipPanel, vipV)
 	return nil
 }
 
-func showNetworkPage(c *Console) error {
-	if mgmtNetwork.Method != networkMethodStatic {
-		return showNext(c, askInterfacePanel, askNetworkMethodPanel, hostNamePanel)
-	}
-	return showNext(c, askInterfacePanel, askNetworkMethodPanel, addressPanel, gatewayPanel, dnsServersPanel, hostNamePanel)
+// showClusterNetworkPage shows the cluster network inputs with the networks of
+// the config
+func showClusterNetworkPage(c *Console) error {
+	userInputData.ClusterCIDR = getClusterCIDR(c.config)
+	userInputData.ServiceCIDR = getServiceCIDR(c.config)
+	userInputData.ClusterDomain = getClusterDomain(c.config)
+	return showNext(c, clusterDomainPanel, serviceCIDRPanel, clusterCIDRPanel)
 }
 
-func addNetworkPanel(c *Console) error {
+func addClusterNetworkPanel(c *Console) error {
 	maxX, maxY := c.Gui.Size()
-	lastY := maxY / 8
-	setLocation := func(p *widgets.Panel, height int) {
-		var (
-			x0 = maxX / 8
-			y0 = lastY
-			x1 = maxX / 8 * 7
-			y1 int
-		)
-		if height == 0 {
-			y1 = maxY / 8 * 7
-		} else {
-			y1 = y0 + height
-		}
-		lastY += height
-		p.SetLocation(x0, y0, x1, y1)
-	}
-
-	hostNameV, err := widgets.NewInput(c.Gui, hostNamePanel, hostNameLabel, false)
+	clusterCIDRV, err := widgets.NewInput(c.Gui, clusterCIDRPanel, clusterCIDRLabel, false)
 	if err != nil {
 		return err
 	}
-
-	askInterfaceV, err := widgets.NewDropDown(c.Gui, askInterfacePanel, askInterfaceLabel, getNetworkInterfaceOptions)
+	serviceCIDRV, err := widgets.NewInput(c.Gui, serviceCIDRPanel, serviceCIDRLabel, false)
 	if err != nil {
 		return err
 	}
-
-	askNetworkMethodV, err := widgets.NewDropDown(c.Gui, askNetworkMethodPanel, askNetworkMethodLabel, getNetworkMethodOptions)
+	clusterDomainV, err := widgets.NewInput(c.Gui, clusterDomainPanel, clusterDomainLabel, false)
 	if err != nil {
 		return err
 	}
 
-	addressV, err := widgets.NewInput(c.Gui, addressPanel, addressLabel, false)
-	if err != nil {
-		return err
+	closeThisPage := func() {
+		clusterCIDRV.Close()
+		serviceCIDRV.Close()
+		clusterDomainV.Close()
+		c.CloseElement(notePanel)
 	}
-
-	gatewayV, err := widgets.NewInput(c.Gui, gatewayPanel, gatewayLabel, false)
-	if err != nil {
-		return err
+	clusterCIDRV.PreShow = func() error {
+		c.Gui.Cursor = true
+		clusterCIDRV.Value = userInputData.ClusterCIDR
+		if err := c.setContentByName(titlePanel, clusterNetworkTitle); err != nil {
+			return err
+		}
+		return c.setContentByName(notePanel, clusterNetworkNote)
+	}
+	serviceCIDRV.PreShow = func() error {
+		serviceCIDRV.Value = userInputData.ServiceCIDR
+		return nil
+	}
+	clusterDomainV.PreShow = func() error {
+		clusterDomainV.Value = userInputData.ClusterDomain
+		return nil
+	}
+	// the inputs are saved before moving between them as showing an input
+	// resets its value
+	saveInputs := func() error {
+		var err error
+		if userInputData.ClusterCIDR, err = clusterCIDRV.GetData(); err != nil {
+			return err
+		}
+		if userInputData.ServiceCIDR, err = serviceCIDRV.GetData(); err != nil {
+			return err
+		}
+		userInputData.ClusterDomain, err = clusterDomainV.GetData()
+		return err
+	}
+	next := func(name string) func(*gocui.Gui, *gocui.View) error {
+		return func(g *gocui.Gui, v *gocui.View) error {
+			if err := saveInputs(); err != nil {
+				return err
+			}
+			return showNext(c, name)
+		}
+	}
+	gotoPrevPage := func(g *gocui.Gui, v *gocui.View) error {
+		closeThisPage()
+		return showNext(c, vipPanel)
+	}
+	// the defaults are left out of the config
+	valueOrEmpty := func(value, defaultValue string) string {
+		if value == defaultValue {
+			return ""
+		}
+		return value
+	}
+
+	clusterCIDRV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyEnter:     next(serviceCIDRPanel),
+		gocui.KeyArrowDown: next(serviceCIDRPanel),
+		gocui.KeyEsc:       gotoPrevPage,
+	}
+	clusterCIDRV.SetLocation(maxX/8, maxY/8, maxX/8*7, maxY/8+2)
+	c.AddElement(clusterCIDRPanel, clusterCIDRV)
+
+	serviceCIDRV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyEnter:     next(clusterDomainPanel),
+		gocui.KeyArrowDown: next(clusterDomainPanel),
+		gocui.KeyArrowUp:   next(clusterCIDRPanel),
+		gocui.KeyEsc:       gotoPrevPage,
+	}
+	serviceCIDRV.SetLocation(maxX/8, maxY/8+3, maxX/8*7, maxY/8+5)
+	c.AddElement(serviceCIDRPanel, serviceCIDRV)
+
+	clusterDomainV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyArrowUp: next(serviceCIDRPanel),
+		gocui.KeyEnter: func(g *gocui.Gui, v *gocui.View) error {
+			if err := saveInputs(); err != nil {
+				return err
+			}
+			cfg := *c.config
+			cfg.ClusterCIDR = valueOrEmpty(userInputData.ClusterCIDR, defaultClusterCIDR)
+			cfg.ServiceCIDR = valueOrEmpty(userInputData.ServiceCIDR, defaultServiceCIDR)
+			cfg.ClusterDomain = valueOrEmpty(userInputData.ClusterDomain, defaultClusterDomain)
+			if err := checkClusterNetworks(&cfg, getLinkSubnets(&cfg)); err != nil {
+				return c.setContentByName(validatorPanel, err.Error())
+			}
+			c.config.ClusterCIDR = cfg.ClusterCIDR
+			c.config.ServiceCIDR = cfg.ServiceCIDR
+			c.config.ClusterDomain = cfg.ClusterDomain
+			g.Cursor = false
+			closeThisPage()
+			return showNext(c, tokenPanel)
+		},
+		gocui.KeyEsc: gotoPrevPage,
+	}
+	clusterDomainV.SetLocation(maxX/8, maxY/8+6, maxX/8*7, maxY/8+8)
+	c.AddElement(clusterDomainPanel, clusterDomainV)
+	return nil
+}
+
+func addTokenPanel(c *Console) error {
+	tokenV, err := widgets.NewInput(c.Gui, tokenPanel, "Cluster token", false)
+	if err != nil {
+		return err
+	}
+	tokenV.PreShow = func() error {
+		c.Gui.Cursor = true
+		tokenV.Value = c.config.Token
+		tokenNote := clusterTokenJoinNote
+		if c.config.Install.Mode == modeCreate {
+			tokenNote = clusterTokenCreateNote
+		}
+		if err = c.setContentByName(notePanel, tokenNote); err != nil {
+			return err
+		}
+		return c.setContentByName(titlePanel, "Configure cluster token")
+	}
+	closeThisPage := func() error {
+		c.CloseElement(notePanel)
+		return tokenV.Close()
+	}
+	tokenV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyEnter: func(g *gocui.Gui, v *gocui.View) error {
+			token, err := tokenV.GetData()
+			if err != nil {
+				return err
+			}
+			if token == "" {
+				return c.setContentByName(validatorPanel, "Cluster token is required")
+			}
+			c.config.Token = token
+			closeThisPage()
+			return showNext(c, passwordConfirmPanel, passwordPanel)
+		},
+		gocui.KeyEsc: func(g *gocui.Gui, v *gocui.View) error {
+			closeThisPage()
+			if c.config.Install.Mode == modeCreate {
+				return showClusterNetworkPage(c)
+			}
+			return showNext(c, serverURLPanel)
+		},
+	}
+	c.AddElement(tokenPanel, tokenV)
+	return nil
+}
+
+func showNetworkPage(c *Console) error {
+	if mgmtNetwork.Method != networkMethodStatic {
+		return showNext(c, askInterfacePanel, askNetworkMethodPanel, hostNamePanel)
+	}
+	return showNext(c, askInterfacePanel, askNetworkMethodPanel, addressPanel, gatewayPanel, hostNamePanel)
+}
+
+// showIPv6NetworkPage shows the second network page with the IPv6 and DNS settings
+func showIPv6NetworkPage(c *Console) error {
+	var names []string
+	if mgmtNetwork.IPv6Method == networkMethodStatic {
+		names = append(names, ipv6AddressPanel, ipv6GatewayPanel)
+	}
+	if needsDNSServers() {
+		names = append(names, dnsServersPanel)
+	}
+	return showNext(c, append(names, askIPv6MethodPanel)...)
+}
+
+// showLinkPage shows the page to build the management interface from a bond
+// and a VLAN
+func showLinkPage(c *Console) error {
+	if userInputData.BondMode != "" {
+		return showNext(c, vlanIDPanel, bondMiimonPanel, bondMembersPanel, bondModePanel)
+	}
+	return showNext(c, vlanIDPanel, bondMembersPanel, bondModePanel)
+}
+
+// showAdvancedNetworkPage shows the optional page with the MTU and static
+// routes of the management network
+func showAdvancedNetworkPage(c *Console) error {
+	return showNext(c, routesPanel, mtuPanel)
+}
+
+// needsDNSServers reports whether DNS servers must be input because no
+// method gets them automatically
+func needsDNSServers() bool {
+	return mgmtNetwork.Method == networkMethodStatic ||
+		(mgmtNetwork.Method == networkMethodNone && mgmtNetwork.IPv6Method == networkMethodStatic)
+}
+
+func addNetworkPanel(c *Console) error {
+	maxX, maxY := c.Gui.Size()
+	lastY := maxY / 8
+	setLocation := func(p *widgets.Panel, height int) {
+		var (
+			x0 = maxX / 8
+			y0 = lastY
+			x1 = maxX / 8 * 7
+			y1 int
+		)
+		if height == 0 {
+			y1 = maxY / 8 * 7
+		} else {
+			y1 = y0 + height
+		}
+		lastY += height
+		p.SetLocation(x0, y0, x1, y1)
+	}
+
+	hostNameV, err := widgets.NewInput(c.Gui, hostNamePanel, hostNameLabel, false)
+	if err != nil {
+		return err
+	}
+
+	askInterfaceV, err := widgets.NewDropDown(c.Gui, askInterfacePanel, askInterfaceLabel, getNetworkInterfaceOptions)
+	if err != nil {
+		return err
+	}
+
+	askNetworkMethodV, err := widgets.NewDropDown(c.Gui, askNetworkMethodPanel, askNetworkMethodLabel, getNetworkMethodOptions)
+	if err != nil {
+		return err
+	}
+
+	addressV, err := widgets.NewInput(c.Gui, addressPanel, addressLabel, false)
+	if err != nil {
+		return err
+	}
+
+	gatewayV, err := widgets.NewInput(c.Gui, gatewayPanel, gatewayLabel, false)
+	if err != nil {
+		return err
+	}
+
+	askIPv6MethodV, err := widgets.NewDropDown(c.Gui, askIPv6MethodPanel, askIPv6MethodLabel, getIPv6MethodOptions)
+	if err != nil {
+		return err
+	}
+
+	ipv6AddressV, err := widgets.NewInput(c.Gui, ipv6AddressPanel, ipv6AddressLabel, false)
+	if err != nil {
+		return err
+	}
+
+	ipv6GatewayV, err := widgets.NewInput(c.Gui, ipv6GatewayPanel, ipv6GatewayLabel, false)
+	if err != nil {
+		return err
 	}
 
 	dnsServersV, err := widgets.NewInput(c.Gui, dnsServersPanel, dnsServersLabel, false)
@@ -605,6 +1186,36 @@ func addNetworkPanel(c *Console) error {
 		return err
 	}
 
+	bondModeV, err := widgets.NewDropDown(c.Gui, bondModePanel, bondModeLabel, getBondModeOptions)
+	if err != nil {
+		return err
+	}
+
+	bondMembersV, err := widgets.NewInput(c.Gui, bondMembersPanel, bondMembersLabel, false)
+	if err != nil {
+		return err
+	}
+
+	bondMiimonV, err := widgets.NewInput(c.Gui, bondMiimonPanel, bondMiimonLabel, false)
+	if err != nil {
+		return err
+	}
+
+	vlanIDV, err := widgets.NewInput(c.Gui, vlanIDPanel, vlanIDLabel, false)
+	if err != nil {
+		return err
+	}
+
+	mtuV, err := widgets.NewInput(c.Gui, mtuPanel, mtuLabel, false)
+	if err != nil {
+		return err
+	}
+
+	routesV, err := widgets.NewInput(c.Gui, routesPanel, routesLabel, false)
+	if err != nil {
+		return err
+	}
+
 	networkValidatorV := widgets.NewPanel(c.Gui, networkValidatorPanel)
 
 	gotoNextPanel := func(c *Console, name string, hooks ...func() (string, error)) func(g *gocui.Gui, v *gocui.View) error {
@@ -630,35 +1241,50 @@ func addNetworkPanel(c *Console) error {
 			askNetworkMethodPanel,
 			addressPanel,
 			gatewayPanel,
+			networkValidatorPanel)
+	}
+
+	closeLinkPage := func() {
+		c.CloseElements(
+			bondModePanel,
+			bondMembersPanel,
+			bondMiimonPanel,
+			vlanIDPanel,
+			networkValidatorPanel)
+	}
+
+	closeIPv6Page := func() {
+		c.CloseElements(
+			askIPv6MethodPanel,
+			ipv6AddressPanel,
+			ipv6GatewayPanel,
 			dnsServersPanel,
 			networkValidatorPanel)
 	}
 
-	setupNetwork := func() ([]byte, error) {
-		cmd := exec.Command("/bin/sh", "-c", getConfigureNetworkCMD(mgmtNetwork))
-		cmd.Env = os.Environ()
-		return cmd.CombinedOutput()
+	closeAdvancedPage := func() {
+		c.CloseElements(
+			mtuPanel,
+			routesPanel,
+			notePanel,
+			networkValidatorPanel)
+	}
+
+	setupNetwork := func() error {
+		return network.NewConfigurator().Apply(mgmtNetwork)
 	}
 
 	preGotoNextPage := func() (string, error) {
-		output, err := setupNetwork()
-		if err != nil {
-			return fmt.Sprintf("Configure network failed: %s", string(output)), nil
+		if err := setupNetwork(); err != nil {
+			return fmt.Sprintf("Configure network failed: %s", err), nil
 		}
 		c.config.Networks = []config.Network{
 			mgmtNetwork,
 		}
-		closeThisPage()
+		closeAdvancedPage()
 		return "", nil
 	}
 
-	getNextPagePanel := func() string {
-		if c.config.Install.Mode == modeCreate {
-			return tokenPanel
-		}
-		return serverURLPanel
-	}
-
 	gotoNextPage := func() error {
 		msg, err := preGotoNextPage()
 		if err != nil {
@@ -667,12 +1293,32 @@ func addNetworkPanel(c *Console) error {
 		if msg != "" {
 			return c.setContentByName(networkValidatorPanel, msg)
 		}
-		return showNext(c, getNextPagePanel())
+		return showNext(c, ntpServersPanel)
+	}
+
+	gotoAdvancedPage := func() error {
+		closeIPv6Page()
+		return showAdvancedNetworkPage(c)
+	}
+
+	gotoIPv6Page := func() error {
+		closeThisPage()
+		return showIPv6NetworkPage(c)
 	}
 
 	gotoPrevPage := func(g *gocui.Gui, v *gocui.View) error {
 		closeThisPage()
-		return showNext(c, diskPanel)
+		return showNext(c, encryptConfirmPanel, encryptionPanel)
+	}
+
+	gotoNetworkPage := func(g *gocui.Gui, v *gocui.View) error {
+		closeIPv6Page()
+		return showNetworkPage(c)
+	}
+
+	gotoNetworkPageFromLinkPage := func(g *gocui.Gui, v *gocui.View) error {
+		closeLinkPage()
+		return showNetworkPage(c)
 	}
 
 	// hostNameV
@@ -711,20 +1357,21 @@ func addNetworkPanel(c *Console) error {
 			return err
 		}
 		c.CloseElement(networkValidatorPanel)
-		switch nicState := getNICState(selected); nicState {
-		case NICStateNotFound:
-			return c.setContentByName(networkValidatorPanel, fmt.Sprintf("NIC %s not found", selected))
-		case NICStateDown:
-			return c.setContentByName(networkValidatorPanel, fmt.Sprintf("NIC %s is down", selected))
-		case NICStateLowerDown:
-			return c.setContentByName(networkValidatorPanel, fmt.Sprintf("NIC %s is down\nNetwork cable isn't plugged in", selected))
+		if selected == networkLinkOption {
+			closeThisPage()
+			return showLinkPage(c)
+		}
+		if msg := checkNICState(selected); msg != "" {
+			return c.setContentByName(networkValidatorPanel, msg)
 		}
 		c.config.Install.MgmtInterface = selected
 		mgmtNetwork.Interface = selected
+		mgmtNetwork.Bond = nil
+		mgmtNetwork.VLANID = 0
 		if mgmtNetwork.Method != networkMethodStatic {
 			return showNext(c, askNetworkMethodPanel)
 		}
-		return showNext(c, dnsServersPanel, gatewayPanel, addressPanel, askNetworkMethodPanel)
+		return showNext(c, gatewayPanel, addressPanel, askNetworkMethodPanel)
 	}
 	askInterfaceV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
 		gocui.KeyArrowUp:   gotoNextPanel(c, hostNamePanel),
@@ -736,37 +1383,51 @@ func addNetworkPanel(c *Console) error {
 	c.AddElement(askInterfacePanel, askInterfaceV)
 
 	// askNetworkMethodV
-	validateDHCPAddresses := func() (string, error) {
-		if mgmtNetwork.Method == networkMethodStatic {
-			return "", nil
-		}
-		nic, err := net.InterfaceByName(mgmtNetwork.Interface)
+	hasDHCPAddress := func() (bool, error) {
+		// a bond or VLAN interface doesn't exist until the network is set up
+		nic, err := net.InterfaceByName(mgmtNetwork.LinkName())
 		if err != nil {
-			return "", err
+			if mgmtNetwork.Bond == nil && mgmtNetwork.VLANID == 0 {
+				return false, err
+			}
+			return false, nil
 		}
 		addrList, err := nic.Addrs()
 		if err != nil {
-			return "", err
+			return false, err
 		}
 		for _, addr := range addrList {
-			if ipNet, ok := addr.(*net.IPNet); ok {
-				if ipNet.IP.To4() != nil {
-					_, cidrIPNet, err := net.ParseCIDR(ipNet.String())
-					if err != nil {
-						return err.Error(), nil
-					}
-					if cidrIPNet.String() != "169.254.0.0/16" {
-						return "", nil
-					}
-				}
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil && !ipNet.IP.IsLinkLocalUnicast() {
+				return true, nil
 			}
 		}
+		return false, nil
+	}
+	validateDHCPAddresses := func() (string, error) {
+		if mgmtNetwork.Method != networkMethodDHCP {
+			return "", nil
+		}
 		askInterfaceV.Close()
 		askInterfaceV.Show()
-		if output, err := setupNetwork(); err != nil {
-			return fmt.Sprintf("Configure network failed: %s", string(output)), nil
+		// a link configured statically before is handed back to connman
+		// without its old address, which must not pass for a lease
+		if err := setupNetwork(); err != nil {
+			return fmt.Sprintf("Configure network failed: %s", err), nil
+		}
+		deadline := time.Now().Add(dhcpAddressTimeout)
+		for {
+			ok, err := hasDHCPAddress()
+			if err != nil {
+				return "", err
+			}
+			if ok {
+				return "", nil
+			}
+			if time.Now().After(deadline) {
+				return "Can't get a valid IP address from DHCP server", nil
+			}
+			time.Sleep(time.Second / 2)
 		}
-		return "Can't get a valid IP address from DHCP server", nil
 	}
 	askNetworkMethodVConfirm := func(g *gocui.Gui, _ *gocui.View) error {
 		selected, err := askNetworkMethodV.GetData()
@@ -784,15 +1445,12 @@ func addNetworkPanel(c *Console) error {
 		}
 		if selected != networkMethodStatic {
 			userInputData.Address = ""
-			userInputData.DNSServers = ""
 			mgmtNetwork.IP = ""
 			mgmtNetwork.SubnetMask = ""
 			mgmtNetwork.Gateway = ""
-			mgmtNetwork.DNSNameservers = nil
-			c.config.OS.DNSNameservers = nil
-			return gotoNextPage()
+			return gotoIPv6Page()
 		}
-		return showNext(c, dnsServersPanel, gatewayPanel, addressPanel)
+		return showNext(c, gatewayPanel, addressPanel)
 	}
 	askNetworkMethodV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
 		gocui.KeyArrowUp:   gotoNextPanel(c, askInterfacePanel),
@@ -854,13 +1512,23 @@ func addNetworkPanel(c *Console) error {
 		if err = checkStaticRequiredString("gateway", gateway); err != nil {
 			return err.Error(), nil
 		}
-		if err = checkIP(gateway); err != nil {
+		if err = checkIPv4(gateway); err != nil {
 			return err.Error(), nil
 		}
 		mgmtNetwork.Gateway = gateway
 		return "", nil
 	}
-	gatewayVConfirm := gotoNextPanel(c, dnsServersPanel, validateGateway)
+	gatewayVConfirm := func(g *gocui.Gui, v *gocui.View) error {
+		c.CloseElement(networkValidatorPanel)
+		msg, err := validateGateway()
+		if err != nil {
+			return err
+		}
+		if msg != "" {
+			return c.setContentByName(networkValidatorPanel, msg)
+		}
+		return gotoIPv6Page()
+	}
 	gatewayV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
 		gocui.KeyArrowUp: gotoNextPanel(c, addressPanel, func() (string, error) {
 			mgmtNetwork.Gateway, err = gatewayV.GetData()
@@ -873,6 +1541,114 @@ func addNetworkPanel(c *Console) error {
 	setLocation(gatewayV.Panel, 3)
 	c.AddElement(gatewayPanel, gatewayV)
 
+	// the IPv6 and DNS panels make up the second page
+	pageBottom := lastY
+	lastY = maxY / 8
+
+	// askIPv6MethodV
+	askIPv6MethodVConfirm := func(g *gocui.Gui, _ *gocui.View) error {
+		selected, err := askIPv6MethodV.GetData()
+		if err != nil {
+			return err
+		}
+		mgmtNetwork.IPv6Method = selected
+		c.CloseElement(networkValidatorPanel)
+		if mgmtNetwork.Method == networkMethodNone && selected == networkMethodNone {
+			return c.setContentByName(networkValidatorPanel, ErrMsgNetworkDisabled)
+		}
+		if selected == networkMethodStatic {
+			return showNext(c, dnsServersPanel, ipv6GatewayPanel, ipv6AddressPanel)
+		}
+		mgmtNetwork.IPv6 = ""
+		mgmtNetwork.IPv6Gateway = ""
+		c.CloseElements(ipv6AddressPanel, ipv6GatewayPanel)
+		if needsDNSServers() {
+			return showNext(c, dnsServersPanel)
+		}
+		userInputData.DNSServers = ""
+		mgmtNetwork.DNSNameservers = nil
+		c.config.OS.DNSNameservers = nil
+		c.CloseElement(dnsServersPanel)
+		return gotoAdvancedPage()
+	}
+	askIPv6MethodV.PreShow = func() error {
+		askIPv6MethodV.Value = mgmtNetwork.IPv6Method
+		return c.setContentByName(titlePanel, networkTitle)
+	}
+	askIPv6MethodV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyArrowDown: askIPv6MethodVConfirm,
+		gocui.KeyEnter:     askIPv6MethodVConfirm,
+		gocui.KeyEsc:       gotoNetworkPage,
+	}
+	setLocation(askIPv6MethodV.Panel, 3)
+	c.AddElement(askIPv6MethodPanel, askIPv6MethodV)
+
+	// ipv6AddressV
+	ipv6AddressV.PreShow = func() error {
+		c.Gui.Cursor = true
+		ipv6AddressV.Value = mgmtNetwork.IPv6
+		return nil
+	}
+	validateIPv6Address := func() (string, error) {
+		address, err := ipv6AddressV.GetData()
+		if err != nil {
+			return "", err
+		}
+		if err = checkStaticRequiredString("ipv6 address", address); err != nil {
+			return err.Error(), nil
+		}
+		if err = checkIPv6CIDR(address); err != nil {
+			return err.Error(), nil
+		}
+		mgmtNetwork.IPv6 = address
+		return "", nil
+	}
+	ipv6AddressVConfirm := gotoNextPanel(c, ipv6GatewayPanel, validateIPv6Address)
+	ipv6AddressV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyArrowUp: gotoNextPanel(c, askIPv6MethodPanel, func() (string, error) {
+			mgmtNetwork.IPv6, err = ipv6AddressV.GetData()
+			return "", err
+		}),
+		gocui.KeyArrowDown: ipv6AddressVConfirm,
+		gocui.KeyEnter:     ipv6AddressVConfirm,
+		gocui.KeyEsc:       gotoNetworkPage,
+	}
+	setLocation(ipv6AddressV.Panel, 3)
+	c.AddElement(ipv6AddressPanel, ipv6AddressV)
+
+	// ipv6GatewayV
+	ipv6GatewayV.PreShow = func() error {
+		c.Gui.Cursor = true
+		ipv6GatewayV.Value = mgmtNetwork.IPv6Gateway
+		return nil
+	}
+	validateIPv6Gateway := func() (string, error) {
+		gateway, err := ipv6GatewayV.GetData()
+		if err != nil {
+			return "", err
+		}
+		if err = checkStaticRequiredString("ipv6 gateway", gateway); err != nil {
+			return err.Error(), nil
+		}
+		if err = checkIPv6(gateway); err != nil {
+			return err.Error(), nil
+		}
+		mgmtNetwork.IPv6Gateway = gateway
+		return "", nil
+	}
+	ipv6GatewayVConfirm := gotoNextPanel(c, dnsServersPanel, validateIPv6Gateway)
+	ipv6GatewayV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyArrowUp: gotoNextPanel(c, ipv6AddressPanel, func() (string, error) {
+			mgmtNetwork.IPv6Gateway, err = ipv6GatewayV.GetData()
+			return "", err
+		}),
+		gocui.KeyArrowDown: ipv6GatewayVConfirm,
+		gocui.KeyEnter:     ipv6GatewayVConfirm,
+		gocui.KeyEsc:       gotoNetworkPage,
+	}
+	setLocation(ipv6GatewayV.Panel, 3)
+	c.AddElement(ipv6GatewayPanel, ipv6GatewayV)
+
 	// dnsServersV
 	dnsServersV.PreShow = func() error {
 		c.Gui.Cursor = true
@@ -891,33 +1667,502 @@ func addNetworkPanel(c *Console) error {
 		if err = checkIPList(dnsServerList); err != nil {
 			return err.Error(), nil
 		}
-		userInputData.DNSServers = dnsServers
-		mgmtNetwork.DNSNameservers = dnsServerList
-		c.config.OS.DNSNameservers = dnsServerList
-		return "", nil
+		userInputData.DNSServers = dnsServers
+		mgmtNetwork.DNSNameservers = dnsServerList
+		c.config.OS.DNSNameservers = dnsServerList
+		return "", nil
+	}
+	dnsServersVConfirm := func(g *gocui.Gui, v *gocui.View) error {
+		c.CloseElement(networkValidatorPanel)
+		msg, err := validateDNSServers()
+		if err != nil {
+			return err
+		}
+		if msg != "" {
+			return c.setContentByName(networkValidatorPanel, msg)
+		}
+		return gotoAdvancedPage()
+	}
+	prevPanelOfDNSServers := func() string {
+		if mgmtNetwork.IPv6Method == networkMethodStatic {
+			return ipv6GatewayPanel
+		}
+		return askIPv6MethodPanel
+	}
+	dnsServersV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyArrowUp: func(g *gocui.Gui, v *gocui.View) error {
+			return gotoNextPanel(c, prevPanelOfDNSServers(), func() (string, error) {
+				userInputData.DNSServers, err = dnsServersV.GetData()
+				return "", err
+			})(g, v)
+		},
+		gocui.KeyEnter: dnsServersVConfirm,
+		gocui.KeyEsc:   gotoNetworkPage,
+	}
+	setLocation(dnsServersV.Panel, 3)
+	c.AddElement(dnsServersPanel, dnsServersV)
+
+	// the MTU and routes panels make up the optional third page
+	if lastY > pageBottom {
+		pageBottom = lastY
+	}
+	lastY = maxY / 8
+
+	gotoIPv6PageFromAdvancedPage := func(g *gocui.Gui, v *gocui.View) error {
+		closeAdvancedPage()
+		return showIPv6NetworkPage(c)
+	}
+
+	// mtuV
+	mtuV.PreShow = func() error {
+		c.Gui.Cursor = true
+		mtuV.Value = userInputData.MTU
+		if err := c.setContentByName(titlePanel, advancedNetworkTitle); err != nil {
+			return err
+		}
+		return c.setContentByName(notePanel, routesNote)
+	}
+	validateMTU := func() (string, error) {
+		mtu, err := mtuV.GetData()
+		if err != nil {
+			return "", err
+		}
+		mgmtNetwork.MTU = 0
+		if mtu != "" {
+			if mgmtNetwork.MTU, err = strconv.Atoi(mtu); err != nil {
+				return fmt.Sprintf("%s is not a valid MTU", mtu), nil
+			}
+		}
+		if err := checkMTU(mgmtNetwork); err != nil {
+			return err.Error(), nil
+		}
+		userInputData.MTU = mtu
+		return "", nil
+	}
+	mtuVConfirm := gotoNextPanel(c, routesPanel, validateMTU)
+	mtuV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyArrowDown: mtuVConfirm,
+		gocui.KeyEnter:     mtuVConfirm,
+		gocui.KeyEsc:       gotoIPv6PageFromAdvancedPage,
+	}
+	setLocation(mtuV.Panel, 3)
+	c.AddElement(mtuPanel, mtuV)
+
+	// routesV
+	routesV.PreShow = func() error {
+		c.Gui.Cursor = true
+		routesV.Value = userInputData.Routes
+		return nil
+	}
+	validateRoutes := func() (string, error) {
+		input, err := routesV.GetData()
+		if err != nil {
+			return "", err
+		}
+		routes, err := parseRoutes(input)
+		if err != nil {
+			return err.Error(), nil
+		}
+		if err := checkRoutes(routes); err != nil {
+			return err.Error(), nil
+		}
+		userInputData.Routes = input
+		mgmtNetwork.Routes = routes
+		return "", nil
+	}
+	routesVConfirm := func(g *gocui.Gui, v *gocui.View) error {
+		c.CloseElement(networkValidatorPanel)
+		msg, err := validateRoutes()
+		if err != nil {
+			return err
+		}
+		if msg != "" {
+			return c.setContentByName(networkValidatorPanel, msg)
+		}
+		g.Cursor = false
+		return gotoNextPage()
+	}
+	routesV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyArrowUp: gotoNextPanel(c, mtuPanel, func() (string, error) {
+			userInputData.Routes, err = routesV.GetData()
+			return "", err
+		}),
+		gocui.KeyEnter: routesVConfirm,
+		gocui.KeyEsc:   gotoIPv6PageFromAdvancedPage,
+	}
+	setLocation(routesV.Panel, 3)
+	c.AddElement(routesPanel, routesV)
+
+	// the bond and VLAN panels make up the page opened from the NIC options
+	if lastY > pageBottom {
+		pageBottom = lastY
+	}
+	lastY = maxY / 8
+
+	// bondModeV
+	bondModeV.PreShow = func() error {
+		bondModeV.Value = userInputData.BondMode
+		return c.setContentByName(titlePanel, linkTitle)
+	}
+	bondModeVConfirm := func(g *gocui.Gui, _ *gocui.View) error {
+		selected, err := bondModeV.GetData()
+		if err != nil {
+			return err
+		}
+		userInputData.BondMode = selected
+		c.CloseElement(networkValidatorPanel)
+		if selected == "" {
+			c.CloseElement(bondMiimonPanel)
+			return showNext(c, bondMembersPanel)
+		}
+		return showNext(c, bondMiimonPanel, bondMembersPanel)
+	}
+	bondModeV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyArrowDown: bondModeVConfirm,
+		gocui.KeyEnter:     bondModeVConfirm,
+		gocui.KeyEsc:       gotoNetworkPageFromLinkPage,
+	}
+	setLocation(bondModeV.Panel, 3)
+	c.AddElement(bondModePanel, bondModeV)
+
+	// bondMembersV
+	bondMembersV.PreShow = func() error {
+		c.Gui.Cursor = true
+		bondMembersV.Value = userInputData.BondMembers
+		return nil
+	}
+	validateBondMembers := func() (string, error) {
+		members, err := bondMembersV.GetData()
+		if err != nil {
+			return "", err
+		}
+		if err = checkStaticRequiredString("NICs", members); err != nil {
+			return err.Error(), nil
+		}
+		memberList := splitList(members)
+		if userInputData.BondMode == "" && len(memberList) > 1 {
+			return "only one NIC can be used without a bond", nil
+		}
+		for _, member := range memberList {
+			if msg := checkNICState(member); msg != "" {
+				return msg, nil
+			}
+		}
+		userInputData.BondMembers = members
+		return "", nil
+	}
+	bondMembersVConfirm := func(g *gocui.Gui, v *gocui.View) error {
+		next := vlanIDPanel
+		if userInputData.BondMode != "" {
+			next = bondMiimonPanel
+		}
+		return gotoNextPanel(c, next, validateBondMembers)(g, v)
+	}
+	bondMembersV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyArrowUp: gotoNextPanel(c, bondModePanel, func() (string, error) {
+			userInputData.BondMembers, err = bondMembersV.GetData()
+			return "", err
+		}),
+		gocui.KeyArrowDown: bondMembersVConfirm,
+		gocui.KeyEnter:     bondMembersVConfirm,
+		gocui.KeyEsc:       gotoNetworkPageFromLinkPage,
+	}
+	setLocation(bondMembersV.Panel, 3)
+	c.AddElement(bondMembersPanel, bondMembersV)
+
+	// bondMiimonV
+	bondMiimonV.PreShow = func() error {
+		c.Gui.Cursor = true
+		bondMiimonV.Value = userInputData.BondMiimon
+		if bondMiimonV.Value == "" {
+			bondMiimonV.Value = strconv.Itoa(network.DefaultBondMiimon)
+		}
+		return nil
+	}
+	validateBondMiimon := func() (string, error) {
+		miimon, err := bondMiimonV.GetData()
+		if err != nil {
+			return "", err
+		}
+		if n, err := strconv.Atoi(miimon); err != nil || n < 0 {
+			return fmt.Sprintf("%s is not a valid interval", miimon), nil
+		}
+		userInputData.BondMiimon = miimon
+		return "", nil
+	}
+	bondMiimonVConfirm := gotoNextPanel(c, vlanIDPanel, validateBondMiimon)
+	bondMiimonV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyArrowUp: gotoNextPanel(c, bondMembersPanel, func() (string, error) {
+			userInputData.BondMiimon, err = bondMiimonV.GetData()
+			return "", err
+		}),
+		gocui.KeyArrowDown: bondMiimonVConfirm,
+		gocui.KeyEnter:     bondMiimonVConfirm,
+		gocui.KeyEsc:       gotoNetworkPageFromLinkPage,
+	}
+	setLocation(bondMiimonV.Panel, 3)
+	c.AddElement(bondMiimonPanel, bondMiimonV)
+
+	// vlanIDV
+	vlanIDV.PreShow = func() error {
+		c.Gui.Cursor = true
+		vlanIDV.Value = userInputData.VLANID
+		return nil
+	}
+	validateVLANID := func() (string, error) {
+		vlanID, err := vlanIDV.GetData()
+		if err != nil {
+			return "", err
+		}
+		if vlanID != "" {
+			if n, err := strconv.Atoi(vlanID); err != nil || n < 1 || n > maxVLANID {
+				return ErrMsgVLANIDInvalid, nil
+			}
+		}
+		userInputData.VLANID = vlanID
+		return "", nil
+	}
+	vlanIDVConfirm := func(g *gocui.Gui, v *gocui.View) error {
+		c.CloseElement(networkValidatorPanel)
+		for _, validate := range []func() (string, error){validateBondMembers, validateVLANID} {
+			msg, err := validate()
+			if err != nil {
+				return err
+			}
+			if msg != "" {
+				return c.setContentByName(networkValidatorPanel, msg)
+			}
+		}
+		applyLinkInput()
+		c.config.Install.MgmtInterface = mgmtNetwork.Interface
+		g.Cursor = false
+		closeLinkPage()
+		if err := showNetworkPage(c); err != nil {
+			return err
+		}
+		return showNext(c, askNetworkMethodPanel)
+	}
+	prevPanelOfVLANID := func() string {
+		if userInputData.BondMode != "" {
+			return bondMiimonPanel
+		}
+		return bondMembersPanel
+	}
+	vlanIDV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyArrowUp: func(g *gocui.Gui, v *gocui.View) error {
+			return gotoNextPanel(c, prevPanelOfVLANID(), func() (string, error) {
+				userInputData.VLANID, err = vlanIDV.GetData()
+				return "", err
+			})(g, v)
+		},
+		gocui.KeyEnter: vlanIDVConfirm,
+		gocui.KeyEsc:   gotoNetworkPageFromLinkPage,
+	}
+	setLocation(vlanIDV.Panel, 3)
+	c.AddElement(vlanIDPanel, vlanIDV)
+
+	// networkValidatorV
+	networkValidatorV.FgColor = gocui.ColorRed
+	networkValidatorV.Wrap = true
+	networkValidatorV.Focus = false
+	if lastY < pageBottom {
+		lastY = pageBottom
+	}
+	setLocation(networkValidatorV, 0)
+	c.AddElement(networkValidatorPanel, networkValidatorV)
+
+	return nil
+}
+
+func addNTPPanel(c *Console) error {
+	ntpServersV, err := widgets.NewInput(c.Gui, ntpServersPanel, ntpServersLabel, false)
+	if err != nil {
+		return err
+	}
+	ntpServersV.PreShow = func() error {
+		c.Gui.Cursor = true
+		ntpServersV.Value = userInputData.NTPServers
+		if err := c.setContentByName(titlePanel, ntpTitle); err != nil {
+			return err
+		}
+		return c.setContentByName(notePanel, ntpServersNote)
+	}
+	gotoNextPage := func() error {
+		ntpServersV.Close()
+		c.CloseElement(notePanel)
+		return showNext(c, diagnosticsPanel)
+	}
+	ntpServersV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyEnter: func(g *gocui.Gui, v *gocui.View) error {
+			asyncTaskV, err := c.GetElement(spinnerPanel)
+			if err != nil {
+				return err
+			}
+			asyncTaskV.Close()
+
+			input, err := ntpServersV.GetData()
+			if err != nil {
+				return err
+			}
+			servers := splitList(input)
+			if err := checkNTPServers(servers); err != nil {
+				return c.setContentByName(validatorPanel, err.Error())
+			}
+			c.CloseElement(validatorPanel)
+			userInputData.NTPServers = input
+			// the default server is only filled in at installation, so that
+			// the servers of the remote config replace it
+			c.config.OS.NTPServers = nil
+			if input != defaultNTPServer {
+				c.config.OS.NTPServers = servers
+			}
+			if len(servers) == 0 {
+				c.syncClock(nil)
+				return gotoNextPage()
+			}
+
+			// focus on task panel to prevent input
+			asyncTaskV.Show()
+			spinner := NewSpinner(c.Gui, spinnerPanel, fmt.Sprintf("Synchronizing the clock with %s...", strings.Join(servers, ", ")))
+			spinner.Start()
+			go func(g *gocui.Gui) {
+				// failures are shown on the diagnostics page
+				c.syncClock(servers)
+				spinner.Stop(false, "")
+				g.Update(func(g *gocui.Gui) error {
+					g.Cursor = false
+					return gotoNextPage()
+				})
+			}(c.Gui)
+			return nil
+		},
+		gocui.KeyEsc: func(g *gocui.Gui, v *gocui.View) error {
+			ntpServersV.Close()
+			c.CloseElement(notePanel)
+			return showAdvancedNetworkPage(c)
+		},
+	}
+	ntpServersV.PostClose = func() error {
+		asyncTaskV, err := c.GetElement(spinnerPanel)
+		if err != nil {
+			return err
+		}
+		return asyncTaskV.Close()
 	}
-	dnsServersVConfirm := func(g *gocui.Gui, v *gocui.View) error {
-		return gotoNextPanel(c, getNextPagePanel(), validateDNSServers, preGotoNextPage)(g, v)
+	c.AddElement(ntpServersPanel, ntpServersV)
+	return nil
+}
+
+// syncClock synchronizes the clock before the first HTTPS fetch, as TLS
+// certificates can't be verified with a clock that is far off
+func (c *Console) syncClock(servers []string) network.Diagnosis {
+	result := network.NewDiagnoser().SyncClock(servers)
+	logrus.Infof("Clock synchronization: %s", result)
+	c.clockDiagnosis = &result
+	return result
+}
+
+func addNetworkDiagnosticsPanel(c *Console) error {
+	maxX, maxY := c.Gui.Size()
+	diagnosticsV := widgets.NewPanel(c.Gui, diagnosticsPanel)
+	diagnosticsV.SetLocation(maxX/8, maxY/8, maxX/8*7, maxY/8*7)
+	diagnosticsV.Frame = true
+	diagnosticsV.KeyBindingTips = map[string]string{
+		"Enter": "continue",
+	}
+	// keys are ignored until the diagnostics are done
+	running := false
+	diagnosticsV.PreShow = func() error {
+		c.Gui.Cursor = false
+		running = true
+		diagnosticsV.Content = "Running network diagnostics..."
+		go func(g *gocui.Gui) {
+			results := c.runNetworkDiagnostics(mgmtNetwork)
+			content := results.String()
+			if !results.Passed() {
+				content += "\n" + diagnosticsFailedNote
+			}
+			g.Update(func(g *gocui.Gui) error {
+				running = false
+				diagnosticsV.SetContent(content)
+				return nil
+			})
+		}(c.Gui)
+		return c.setContentByName(titlePanel, diagnosticsTitle)
 	}
-	dnsServersV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
-		gocui.KeyArrowUp: gotoNextPanel(c, gatewayPanel, func() (string, error) {
-			userInputData.DNSServers, err = dnsServersV.GetData()
-			return "", err
-		}),
-		gocui.KeyEnter: dnsServersVConfirm,
-		gocui.KeyEsc:   gotoPrevPage,
+	diagnosticsV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyEnter: func(g *gocui.Gui, v *gocui.View) error {
+			if running {
+				return nil
+			}
+			diagnosticsV.Close()
+			if c.config.Install.Mode == modeCreate {
+				return showClusterNetworkPage(c)
+			}
+			return showNext(c, serverURLPanel)
+		},
+		gocui.KeyEsc: func(g *gocui.Gui, v *gocui.View) error {
+			if running {
+				return nil
+			}
+			diagnosticsV.Close()
+			return showNext(c, ntpServersPanel)
+		},
 	}
-	setLocation(dnsServersV.Panel, 3)
-	c.AddElement(dnsServersPanel, dnsServersV)
+	c.AddElement(diagnosticsPanel, diagnosticsV)
+	return nil
+}
 
-	// networkValidatorV
-	networkValidatorV.FgColor = gocui.ColorRed
-	networkValidatorV.Wrap = true
-	networkValidatorV.Focus = false
-	setLocation(networkValidatorV, 0)
-	c.AddElement(networkValidatorPanel, networkValidatorV)
+// runNetworkDiagnostics diagnoses the management network and keeps the results
+// for the install log and the webhooks
+func (c *Console) runNetworkDiagnostics(mgmt config.Network) network.Diagnostics {
+	results := network.NewDiagnoser().Diagnose(mgmt, getDiagnosticTargets(c.config))
+	if c.clockDiagnosis != nil {
+		results = append(network.Diagnostics{*c.clockDiagnosis}, results...)
+	}
+	logrus.Infof("Network diagnostics of %s:\n%s", mgmt.LinkName(), results)
+	c.diagnostics = results
+	return results
+}
 
-	return nil
+// recheckURLs fetches the remote files again, the diagnostics page coming
+// before the proxy and the config URL are entered
+func (c *Console) recheckURLs() {
+	results := network.NewDiagnoser().CheckURLs(getDiagnosticTargets(c.config).URLs)
+	logrus.Infof("Reachability of the remote files:\n%s", results)
+	c.diagnostics = c.diagnostics.Replace(network.CheckHTTP, results)
+}
+
+// checkNICState returns a message if the NIC can't carry the management network
+func checkNICState(name string) string {
+	switch nicState := getNICState(name); nicState {
+	case NICStateNotFound:
+		return fmt.Sprintf("NIC %s not found", name)
+	case NICStateDown:
+		return fmt.Sprintf("NIC %s is down", name)
+	case NICStateLowerDown:
+		return fmt.Sprintf("NIC %s is down\nNetwork cable isn't plugged in", name)
+	}
+	return ""
+}
+
+// applyLinkInput sets the interface, bond and VLAN of the management network
+// from the input of the bond and VLAN page
+func applyLinkInput() {
+	members := splitList(userInputData.BondMembers)
+	if userInputData.BondMode == "" {
+		mgmtNetwork.Interface = members[0]
+		mgmtNetwork.Bond = nil
+	} else {
+		miimon, _ := strconv.Atoi(userInputData.BondMiimon)
+		mgmtNetwork.Interface = defaultBondInterface
+		mgmtNetwork.Bond = &config.Bond{
+			Members: members,
+			Mode:    userInputData.BondMode,
+			Miimon:  miimon,
+		}
+	}
+	mgmtNetwork.VLANID, _ = strconv.Atoi(userInputData.VLANID)
 }
 
 func getNICState(name string) int {
@@ -974,7 +2219,14 @@ func getNetworkInterfaceOptions() ([]widgets.Option, error) {
 		}
 		options = append(options, option)
 	}
-	return options, nil
+	linkOption := widgets.Option{
+		Value: networkLinkOption,
+		Text:  networkLinkOptionText,
+	}
+	if mgmtNetwork.Bond != nil || mgmtNetwork.VLANID != 0 {
+		linkOption.Text = fmt.Sprintf("%s (%s)", networkLinkOptionText, mgmtNetwork.LinkName())
+	}
+	return append(options, linkOption), nil
 }
 
 func getNetworkMethodOptions() ([]widgets.Option, error) {
@@ -987,50 +2239,203 @@ func getNetworkMethodOptions() ([]widgets.Option, error) {
 			Value: networkMethodStatic,
 			Text:  networkMethodStaticText,
 		},
+		{
+			Value: networkMethodNone,
+			Text:  networkMethodNoneText,
+		},
+	}, nil
+}
+
+func getBondModeOptions() ([]widgets.Option, error) {
+	options := []widgets.Option{
+		{
+			Value: "",
+			Text:  bondModeNoneText,
+		},
+	}
+	for _, mode := range bondModes {
+		options = append(options, widgets.Option{
+			Value: mode,
+			Text:  mode,
+		})
+	}
+	return options, nil
+}
+
+func getIPv6MethodOptions() ([]widgets.Option, error) {
+	return []widgets.Option{
+		{
+			Value: networkMethodNone,
+			Text:  networkMethodNoneText,
+		},
+		{
+			Value: networkMethodSLAAC,
+			Text:  networkMethodSLAACText,
+		},
+		{
+			Value: networkMethodDHCPv6,
+			Text:  networkMethodDHCPv6Text,
+		},
+		{
+			Value: networkMethodStatic,
+			Text:  networkMethodStaticText,
+		},
 	}, nil
 }
 
+// showProxyPage shows the proxy inputs with the proxy of the config
+func showProxyPage(c *Console) error {
+	userInputData.HTTPProxy = c.config.Proxy.HTTP
+	userInputData.HTTPSProxy = c.config.Proxy.HTTPS
+	userInputData.NoProxy = strings.Join(c.config.Proxy.NoProxy, ",")
+	return showNext(c, noProxyPanel, httpsProxyPanel, proxyPanel)
+}
+
 func addProxyPanel(c *Console) error {
-	proxyV, err := widgets.NewInput(c.Gui, proxyPanel, "Proxy address", false)
+	maxX, maxY := c.Gui.Size()
+	proxyV, err := widgets.NewInput(c.Gui, proxyPanel, "HTTP Proxy", false)
+	if err != nil {
+		return err
+	}
+	httpsProxyV, err := widgets.NewInput(c.Gui, httpsProxyPanel, "HTTPS Proxy", false)
+	if err != nil {
+		return err
+	}
+	noProxyV, err := widgets.NewInput(c.Gui, noProxyPanel, "No Proxy", false)
 	if err != nil {
 		return err
 	}
+
+	closeThisPage := func() {
+		proxyV.Close()
+		httpsProxyV.Close()
+		noProxyV.Close()
+		c.CloseElement(notePanel)
+	}
 	proxyV.PreShow = func() error {
 		c.Gui.Cursor = true
-		proxyV.Value = os.Getenv("HTTP_PROXY")
+		proxyV.Value = userInputData.HTTPProxy
 		if err := c.setContentByName(titlePanel, "Optional: configure proxy"); err != nil {
 			return err
 		}
 		return c.setContentByName(notePanel, proxyNote)
 	}
+	httpsProxyV.PreShow = func() error {
+		httpsProxyV.Value = userInputData.HTTPSProxy
+		return nil
+	}
+	noProxyV.PreShow = func() error {
+		noProxyV.Value = userInputData.NoProxy
+		return nil
+	}
+	// the inputs are saved before moving between them as showing an input
+	// resets its value
+	saveInputs := func() error {
+		var err error
+		if userInputData.HTTPProxy, err = proxyV.GetData(); err != nil {
+			return err
+		}
+		if userInputData.HTTPSProxy, err = httpsProxyV.GetData(); err != nil {
+			return err
+		}
+		userInputData.NoProxy, err = noProxyV.GetData()
+		return err
+	}
+	next := func(name string) func(*gocui.Gui, *gocui.View) error {
+		return func(g *gocui.Gui, v *gocui.View) error {
+			if err := saveInputs(); err != nil {
+				return err
+			}
+			return showNext(c, name)
+		}
+	}
+	gotoNextPage := func(proxy config.Proxy) error {
+		c.config.Proxy = proxy
+		setProxyEnv(proxy)
+		closeThisPage()
+		return showNext(c, sshKeyPanel)
+	}
+	gotoPrevPage := func(g *gocui.Gui, v *gocui.View) error {
+		closeThisPage()
+		return showNext(c, passwordConfirmPanel, passwordPanel)
+	}
+
 	proxyV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyEnter:     next(httpsProxyPanel),
+		gocui.KeyArrowDown: next(httpsProxyPanel),
+		gocui.KeyEsc:       gotoPrevPage,
+	}
+	proxyV.SetLocation(maxX/8, maxY/8, maxX/8*7, maxY/8+2)
+	c.AddElement(proxyPanel, proxyV)
+
+	httpsProxyV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyEnter:     next(noProxyPanel),
+		gocui.KeyArrowDown: next(noProxyPanel),
+		gocui.KeyArrowUp:   next(proxyPanel),
+		gocui.KeyEsc:       gotoPrevPage,
+	}
+	httpsProxyV.SetLocation(maxX/8, maxY/8+3, maxX/8*7, maxY/8+5)
+	c.AddElement(httpsProxyPanel, httpsProxyV)
+
+	noProxyV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyArrowUp: next(httpsProxyPanel),
 		gocui.KeyEnter: func(g *gocui.Gui, v *gocui.View) error {
-			proxy, err := proxyV.GetData()
+			asyncTaskV, err := c.GetElement(spinnerPanel)
 			if err != nil {
 				return err
 			}
-			if proxy != "" {
-				os.Setenv("HTTP_PROXY", proxy)
-				os.Setenv("HTTPS_PROXY ", proxy)
-			} else {
-				os.Unsetenv("HTTP_PROXY")
-				os.Unsetenv("HTTPS_PROXY")
-			}
-			proxyV.Close()
-			noteV, err := c.GetElement(notePanel)
-			if err != nil {
+			asyncTaskV.Close()
+
+			if err := saveInputs(); err != nil {
 				return err
 			}
-			noteV.Close()
-			return showNext(c, sshKeyPanel)
-		},
-		gocui.KeyEsc: func(g *gocui.Gui, v *gocui.View) error {
-			proxyV.Close()
-			c.CloseElement(notePanel)
-			return showNext(c, passwordConfirmPanel, passwordPanel)
+			proxy := config.Proxy{
+				HTTP:    userInputData.HTTPProxy,
+				HTTPS:   userInputData.HTTPSProxy,
+				NoProxy: splitList(userInputData.NoProxy),
+			}
+			if proxy.HTTPS == "" {
+				proxy.HTTPS = proxy.HTTP
+			}
+			if err := checkProxy(proxy); err != nil {
+				return c.setContentByName(validatorPanel, err.Error())
+			}
+			c.CloseElement(validatorPanel)
+			if !hasProxy(proxy) {
+				return gotoNextPage(proxy)
+			}
+
+			// focus on task panel to prevent input
+			asyncTaskV.Show()
+			urls := getProxyCheckURLs(c.config)
+			spinner := NewSpinner(c.Gui, spinnerPanel, fmt.Sprintf("Fetching %s through the proxy...", strings.Join(urls, ", ")))
+			spinner.Start()
+			go func(g *gocui.Gui) {
+				if err := checkProxyReachable(proxy, urls); err != nil {
+					spinner.Stop(true, err.Error())
+					g.Update(func(g *gocui.Gui) error {
+						return showNext(c, noProxyPanel)
+					})
+					return
+				}
+				spinner.Stop(false, "")
+				g.Update(func(g *gocui.Gui) error {
+					return gotoNextPage(proxy)
+				})
+			}(c.Gui)
+			return nil
 		},
+		gocui.KeyEsc: gotoPrevPage,
 	}
-	c.AddElement(proxyPanel, proxyV)
+	noProxyV.PostClose = func() error {
+		asyncTaskV, err := c.GetElement(spinnerPanel)
+		if err != nil {
+			return err
+		}
+		return asyncTaskV.Close()
+	}
+	noProxyV.SetLocation(maxX/8, maxY/8+6, maxX/8*7, maxY/8+8)
+	c.AddElement(noProxyPanel, noProxyV)
 	return nil
 }
 
@@ -1055,6 +2460,7 @@ func addCloudInitPanel(c *Console) error {
 				return err
 			}
 			c.config.Install.ConfigURL = configURL
+			c.remoteConfig = nil
 			if configURL != "" {
 				asyncTaskV, err := c.GetElement(spinnerPanel)
 				if err != nil {
@@ -1067,7 +2473,7 @@ func addCloudInitPanel(c *Console) error {
 				spinner.Start()
 
 				go func(g *gocui.Gui) {
-					if _, err = getRemoteConfig(configURL); err != nil {
+					if c.remoteConfig, err = getRemoteConfig(c.config); err != nil {
 						spinner.Stop(true, err.Error())
 						g.Update(func(g *gocui.Gui) error {
 							return showNext(c, cloudInitPanel)
@@ -1108,6 +2514,9 @@ func addConfirmInstallPanel(c *Console) error {
 			}, {
 				Value: "no",
 				Text:  "No",
+			}, {
+				Value: "preview",
+				Text:  "Show the full cloud-config",
 			},
 		}, nil
 	}
@@ -1116,20 +2525,41 @@ func addConfirmInstallPanel(c *Console) error {
 		return err
 	}
 	confirmV.PreShow = func() error {
+		c.recordProvenance(config.SourceUser)
 		installBytes, err := config.PrintInstall(*c.config)
 		if err != nil {
 			return err
 		}
 		options := fmt.Sprintf("install mode: %v\n", c.config.Install.Mode)
 		options += fmt.Sprintf("hostname: %v\n", c.config.OS.Hostname)
-		if proxy := os.Getenv("HTTP_PROXY"); proxy != "" {
-			options += fmt.Sprintf("proxy address: %v\n", proxy)
+		if ntpServers := getNTPServers(c.config, userInputData.NTPServers == defaultNTPServer); len(ntpServers) > 0 {
+			options += fmt.Sprintf("ntp servers: %v\n", strings.Join(ntpServers, ", "))
+		}
+		if c.config.VIP != "" {
+			options += fmt.Sprintf("vip: %v\n", c.config.VIP)
+		}
+		if c.config.ClusterCIDR != "" {
+			options += fmt.Sprintf("cluster cidr: %v\n", c.config.ClusterCIDR)
+		}
+		if c.config.ServiceCIDR != "" {
+			options += fmt.Sprintf("service cidr: %v\n", c.config.ServiceCIDR)
+		}
+		if c.config.ClusterDomain != "" {
+			options += fmt.Sprintf("cluster domain: %v\n", c.config.ClusterDomain)
+		}
+		if proxy := c.config.Proxy.HTTP; proxy != "" {
+			options += fmt.Sprintf("http proxy: %v\n", config.MaskURLPassword(proxy))
+		}
+		if proxy := c.config.Proxy.HTTPS; proxy != "" {
+			options += fmt.Sprintf("https proxy: %v\n", config.MaskURLPassword(proxy))
 		}
 		if userInputData.SSHKeyURL != "" {
 			options += fmt.Sprintf("ssh key url: %v\n", userInputData.SSHKeyURL)
 		}
 		options += string(installBytes)
-		logrus.Debug("cfm cfg: ", fmt.Sprintf("%+v", c.config.Install))
+		options += "\nconfig sources:\n" + indent(c.provenance.String(), "  ")
+		// the install config is printed with its passphrase masked
+		logrus.Debug("cfm cfg:\n", string(installBytes))
 		if !c.config.Install.Silent {
 			confirmV.SetContent(options +
 				"\nYour disk will be formatted and Harvester will be installed with \nthe above configuration. Continue?\n")
@@ -1151,6 +2581,9 @@ func addConfirmInstallPanel(c *Console) error {
 				return c.setContentByName(notePanel, "Installation halted. Rebooting system in 5 seconds")
 			}
 			confirmV.Close()
+			if confirmed == "preview" {
+				return showNext(c, cloudConfigPanel)
+			}
 			return showNext(c, installPanel)
 		},
 		gocui.KeyEsc: func(g *gocui.Gui, v *gocui.View) error {
@@ -1162,6 +2595,119 @@ func addConfirmInstallPanel(c *Console) error {
 	return nil
 }
 
+// previewCloudConfig prints the cloud config that the installation will use,
+// with secrets masked
+func (c *Console) previewCloudConfig() ([]byte, error) {
+	cfg, err := c.config.DeepCopy()
+	if err != nil {
+		return nil, err
+	}
+	if c.remoteConfig != nil {
+		if err := mergo.Merge(cfg, c.remoteConfig, mergo.WithAppendSlice); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.TTY == "" {
+		cfg.TTY = getLastTTY()
+	}
+	cfg.OS.NTPServers = getNTPServers(cfg, userInputData.NTPServers == defaultNTPServer)
+	cloudConfig, err := toCloudConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return config.PrintCloudConfig(cloudConfig)
+}
+
+func addCloudConfigPanel(c *Console) error {
+	maxX, maxY := c.Gui.Size()
+	cloudConfigV := widgets.NewPanel(c.Gui, cloudConfigPanel)
+	cloudConfigV.SetLocation(maxX/8, maxY/8, maxX/8*7, maxY/8*7)
+	cloudConfigV.Frame = true
+	cloudConfigV.KeyBindingTips = map[string]string{
+		"arrow keys/PgUp/PgDn": "scroll",
+		"Ctrl+S":               "save to a file",
+	}
+	cloudConfigV.PreShow = func() error {
+		c.Gui.Cursor = false
+		content, err := c.previewCloudConfig()
+		if err != nil {
+			content = []byte(fmt.Sprintf("fail to render cloud-config: %s", err))
+		}
+		cloudConfigV.Content = string(content)
+		return c.setContentByName(titlePanel, "Cloud-config to install")
+	}
+	scroll := func(f func(*gocui.View, int) error, lines int) func(*gocui.Gui, *gocui.View) error {
+		return func(g *gocui.Gui, v *gocui.View) error {
+			return f(v, lines)
+		}
+	}
+	pageHeight := cloudConfigV.Y1 - cloudConfigV.Y0 - 1
+	cloudConfigV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyArrowUp:   scroll(widgets.ScrollUp, 1),
+		gocui.KeyArrowDown: scroll(widgets.ScrollDown, 1),
+		gocui.KeyPgup:      scroll(widgets.ScrollUp, pageHeight),
+		gocui.KeyPgdn:      scroll(widgets.ScrollDown, pageHeight),
+		gocui.KeyCtrlS: func(g *gocui.Gui, v *gocui.View) error {
+			return showNext(c, saveCloudConfigPanel)
+		},
+		gocui.KeyEsc: func(g *gocui.Gui, v *gocui.View) error {
+			cloudConfigV.Close()
+			return showNext(c, confirmInstallPanel)
+		},
+	}
+	c.AddElement(cloudConfigPanel, cloudConfigV)
+	return nil
+}
+
+func addSaveCloudConfigPanel(c *Console) error {
+	maxX, maxY := c.Gui.Size()
+	saveV, err := widgets.NewInput(c.Gui, saveCloudConfigPanel, "Save to", false)
+	if err != nil {
+		return err
+	}
+	saveV.SetLocation(maxX/8, maxY/8*7-3, maxX/8*7, maxY/8*7)
+	saveV.PreShow = func() error {
+		c.Gui.Cursor = true
+		if saveV.Value == "" {
+			saveV.Value = cloudConfigFile
+		}
+		return nil
+	}
+	closeThisPage := func() error {
+		c.Gui.Cursor = false
+		if err := saveV.Close(); err != nil {
+			return err
+		}
+		_, err := c.Gui.SetCurrentView(cloudConfigPanel)
+		return err
+	}
+	saveV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyEnter: func(g *gocui.Gui, v *gocui.View) error {
+			path, err := saveV.GetData()
+			if err != nil {
+				return err
+			}
+			saveV.Value = path
+			content, err := c.previewCloudConfig()
+			if err == nil {
+				err = ioutil.WriteFile(path, content, 0600)
+			}
+			if err != nil {
+				return c.setContentByName(titlePanel, fmt.Sprintf("Fail to save cloud-config: %s", err))
+			}
+			if err := closeThisPage(); err != nil {
+				return err
+			}
+			return c.setContentByName(titlePanel, fmt.Sprintf("Cloud-config to install (saved to %s)", path))
+		},
+		gocui.KeyEsc: func(g *gocui.Gui, v *gocui.View) error {
+			return closeThisPage()
+		},
+	}
+	c.AddElement(saveCloudConfigPanel, saveV)
+	return nil
+}
+
 func addConfirmUpgradePanel(c *Console) error {
 	askOptionsFunc := func() ([]widgets.Option, error) {
 		return []widgets.Option{
@@ -1208,12 +2754,49 @@ func addInstallPanel(c *Console) error {
 	installV.PreShow = func() error {
 		go func() {
 			logrus.Info("Local config: ", c.config)
+			var unknownKeys config.UnknownKeysError
+			if err := config.CheckUnknownCmdlineKeys(); errors.As(err, &unknownKeys) {
+				if c.config.StrictConfig() {
+					logrus.Error(err)
+					printToPanel(c.Gui, err.Error(), installPanel)
+					notifyInstallFailed(c.config, err)
+					return
+				}
+				logrus.Warnf("kernel command line has unknown keys:\n%s", err)
+			} else if err != nil {
+				logrus.Errorf("fail to check the kernel command line: %s", err)
+			}
+			if c.clockDiagnosis == nil {
+				// automatic installations skip the NTP page
+				ntpServers := c.config.OS.NTPServers
+				if len(ntpServers) == 0 {
+					ntpServers = []string{defaultNTPServer}
+				}
+				if result := c.syncClock(ntpServers); result.Status != network.StatusPass {
+					printToPanel(c.Gui, fmt.Sprintf("Clock synchronization: %s", result), installPanel)
+				}
+			}
+			// automatic installations skip the proxy page
+			if hasProxy(c.config.Proxy) {
+				setProxyEnv(c.config.Proxy)
+			}
 			if c.config.Install.ConfigURL != "" {
 				printToPanel(c.Gui, fmt.Sprintf("Fetching %s...", c.config.Install.ConfigURL), installPanel)
-				remoteConfig, err := retryRemoteConfig(c.config.Install.ConfigURL, c.Gui)
+				remoteConfig, err := retryRemoteConfig(c.config, c.Gui)
 				if err != nil {
 					logrus.Error(err)
 					printToPanel(c.Gui, err.Error(), installPanel)
+					var (
+						unknownKeys config.UnknownKeysError
+						sigErr      *signatureError
+					)
+					if errors.As(err, &unknownKeys) {
+						mergo.Merge(remoteConfig, c.config, mergo.WithAppendSlice)
+						notifyInstallFailed(remoteConfig, err)
+					} else if errors.As(err, &sigErr) {
+						// the remote config is not trusted, so only the local webhooks are fired
+						notifyInstallFailed(c.config, err)
+					}
 					return
 				}
 				logrus.Info("Remote config: ", remoteConfig)
@@ -1221,7 +2804,11 @@ func addInstallPanel(c *Console) error {
 					printToPanel(c.Gui, fmt.Sprintf("fail to merge config: %s", err), installPanel)
 					return
 				}
+				c.recordProvenance(config.SourceRemote)
 				logrus.Info("Local config (merged): ", c.config)
+				if hasProxy(c.config.Proxy) {
+					setProxyEnv(c.config.Proxy)
+				}
 			}
 			if c.config.Hostname == "" {
 				c.config.Hostname = generateHostName()
@@ -1229,12 +2816,36 @@ func addInstallPanel(c *Console) error {
 			if c.config.TTY == "" {
 				c.config.TTY = getLastTTY()
 			}
+			c.config.OS.NTPServers = getNTPServers(c.config, userInputData.NTPServers == defaultNTPServer)
+			c.recordProvenance(config.SourceDefault)
+			logrus.Info("Config sources:\n", c.provenance)
+			if err := c.provenance.Dump(provenanceFile); err != nil {
+				logrus.Errorf("fail to dump config sources: %s", err)
+			}
+			if err := resolveDevices(&c.config.Install); err != nil {
+				printToPanel(c.Gui, err.Error(), installPanel)
+				return
+			}
 			if err := validateConfig(ConfigValidator{}, c.config); err != nil {
 				printToPanel(c.Gui, err.Error(), installPanel)
 				return
 			}
 
-			webhooks, err := PrepareWebhooks(c.config.Webhooks, getWebhookContext(c.config))
+			if c.diagnostics == nil {
+				// automatic installations skip the diagnostics page
+				if mgmt, ok := getMgmtNetwork(c.config); ok {
+					c.runNetworkDiagnostics(mgmt)
+				}
+			} else {
+				c.recheckURLs()
+			}
+			if c.diagnostics != nil && !c.diagnostics.Passed() {
+				printToPanel(c.Gui, "Network diagnostics failed, see /var/log/console.log", installPanel)
+			}
+
+			webhookContext := getWebhookContext(c.config)
+			setDiagnosticsContext(webhookContext, c.diagnostics)
+			webhooks, err := PrepareWebhooks(c.config.Webhooks, webhookContext)
 			if err != nil {
 				printToPanel(c.Gui, fmt.Sprintf("invalid webhook: %s", err), installPanel)
 			}
@@ -1244,7 +2855,20 @@ func addInstallPanel(c *Console) error {
 				printToPanel(c.Gui, err.Error(), installPanel)
 				return
 			}
-			doInstall(c.Gui, cloudConfig, webhooks)
+			if preview, err := config.PrintCloudConfig(cloudConfig); err == nil {
+				logrus.Info("Cloud config:\n", string(preview))
+			}
+			installEnv := getInstallEnv(c.config)
+			if passphrase := c.config.Install.Encryption.Passphrase; passphrase != "" {
+				passphraseFile, err := writePassphraseFile(passphrase)
+				if err != nil {
+					printToPanel(c.Gui, err.Error(), installPanel)
+					return
+				}
+				defer os.Remove(passphraseFile)
+				installEnv = append(installEnv, fmt.Sprintf("%s=%s", encryptionPassphraseFileEnv, passphraseFile))
+			}
+			doInstall(c.Gui, cloudConfig, installEnv, webhooks)
 		}()
 		return c.setContentByName(footerPanel, "")
 	}
@@ -0,0 +1,111 @@
+package console
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+)
+
+// partition is a partition of the installation device, sized in MiB
+type partition struct {
+	name string
+	size uint64
+	// fill takes the rest of the disk, size being the least it gets
+	fill bool
+}
+
+// getPartitionLayout returns the partitions of the installation device in
+// their order on the disk. The boot partition is only created on EFI systems,
+// the kernel partition in encrypted installations, and the partition filling
+// the disk is always the last.
+func getPartitionLayout(install config.Install) []partition {
+	p := install.Partitions
+	fill := p.Fill
+	if fill == "" {
+		fill = partitionState
+	}
+	bootSize := p.BootSize
+	if bootSize == 0 {
+		bootSize = defaultBootSize
+	}
+	stateSize := p.StateSize
+	if stateSize == 0 {
+		stateSize = defaultStateSize
+	}
+
+	layout := []partition{{name: partitionBoot, size: bootSize}}
+	// the bootloader can't read the kernel from the encrypted state partition
+	if install.Encryption.Enabled() {
+		kernelSize := p.KernelSize
+		if kernelSize == 0 {
+			kernelSize = defaultKernelSize
+		}
+		layout = append(layout, partition{name: partitionKernel, size: kernelSize})
+	}
+	var last partition
+	for _, part := range []partition{
+		{name: partitionState, size: stateSize},
+		{name: partitionRancher, size: p.RancherSize},
+		{name: partitionLog, size: p.LogSize},
+	} {
+		if part.name == fill {
+			part.fill = true
+			if part.size == 0 {
+				part.size = minPartitionSize
+			}
+			last = part
+		} else if part.size > 0 {
+			layout = append(layout, part)
+		}
+	}
+	return append(layout, last)
+}
+
+// getPartitionsEnv returns the partition layout for the k3os installer, e.g.
+// "boot:50 state:20480 log:fill"
+func getPartitionsEnv(install config.Install) string {
+	var parts []string
+	for _, part := range getPartitionLayout(install) {
+		size := fmt.Sprint(part.size)
+		if part.fill {
+			size = partitionFill
+		}
+		parts = append(parts, fmt.Sprintf("%s:%s", part.name, size))
+	}
+	return strings.Join(parts, " ")
+}
+
+// getMinDiskSize returns the least size in bytes of a disk that holds the
+// partition layout
+func getMinDiskSize(install config.Install) uint64 {
+	size := uint64(partitionAlignment)
+	for _, part := range getPartitionLayout(install) {
+		size += part.size
+	}
+	return size * mib
+}
+
+func checkPartitions(p config.Partitions) error {
+	switch p.Fill {
+	case "", partitionState, partitionRancher, partitionLog:
+	default:
+		return prettyError(ErrMsgPartitionFillUnknown, p.Fill)
+	}
+	for _, c := range []struct {
+		name    string
+		size    uint64
+		minSize uint64
+	}{
+		{partitionBoot, p.BootSize, minBootSize},
+		{partitionState, p.StateSize, minStateSize},
+		{partitionRancher, p.RancherSize, minPartitionSize},
+		{partitionLog, p.LogSize, minPartitionSize},
+		{partitionKernel, p.KernelSize, minKernelSize},
+	} {
+		if c.size != 0 && c.size < c.minSize {
+			return prettyError(ErrMsgPartitionTooSmall, fmt.Sprintf("%s partition has %d MiB, at least %d MiB is required", c.name, c.size, c.minSize))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package console
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+	"github.com/harvester/harvester-installer/pkg/disk"
+)
+
+func TestGetPartitionsEnv(t *testing.T) {
+	testCases := []struct {
+		name       string
+		partitions config.Partitions
+		encryption config.Encryption
+		env        string
+		minSize    uint64
+	}{
+		{
+			name:    "default",
+			env:     "boot:50 state:fill",
+			minSize: (1 + 50 + 20480) * mib,
+		},
+		{
+			name: "larger state",
+			partitions: config.Partitions{
+				BootSize:  100,
+				StateSize: 51200,
+			},
+			env:     "boot:100 state:fill",
+			minSize: (1 + 100 + 51200) * mib,
+		},
+		{
+			name: "rancher filling the disk",
+			partitions: config.Partitions{
+				StateSize: 10240,
+				LogSize:   4096,
+				Fill:      partitionRancher,
+			},
+			env:     "boot:50 state:10240 log:4096 rancher:fill",
+			minSize: (1 + 50 + 10240 + 4096 + minPartitionSize) * mib,
+		},
+		{
+			name: "log filling the disk",
+			partitions: config.Partitions{
+				RancherSize: 102400,
+				LogSize:     2048,
+				Fill:        partitionLog,
+			},
+			env:     "boot:50 state:20480 rancher:102400 log:fill",
+			minSize: (1 + 50 + 20480 + 102400 + 2048) * mib,
+		},
+		{
+			name:       "encrypted",
+			encryption: config.Encryption{Passphrase: "passphrase"},
+			env:        "boot:50 kernel:1024 state:fill",
+			minSize:    (1 + 50 + 1024 + 20480) * mib,
+		},
+		{
+			name: "encrypted with a smaller kernel partition",
+			partitions: config.Partitions{
+				KernelSize: 512,
+			},
+			encryption: config.Encryption{KeyFile: "/harvester.key"},
+			env:        "boot:50 kernel:512 state:fill",
+			minSize:    (1 + 50 + 512 + 20480) * mib,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			install := config.Install{Partitions: tc.partitions, Encryption: tc.encryption}
+			assert.Equal(t, tc.env, getPartitionsEnv(install))
+			assert.Equal(t, tc.minSize, getMinDiskSize(install))
+		})
+	}
+}
+
+func TestCheckPartitions(t *testing.T) {
+	assert.Nil(t, checkPartitions(config.Partitions{}))
+	assert.Nil(t, checkPartitions(config.Partitions{StateSize: 10240, RancherSize: 1024, Fill: partitionLog}))
+
+	err := checkPartitions(config.Partitions{Fill: "home"})
+	assert.EqualError(t, err, ErrMsgPartitionFillUnknown+": home")
+
+	err = checkPartitions(config.Partitions{BootSize: 16})
+	assert.EqualError(t, err, ErrMsgPartitionTooSmall+": boot partition has 16 MiB, at least 32 MiB is required")
+
+	err = checkPartitions(config.Partitions{StateSize: 4096})
+	assert.EqualError(t, err, ErrMsgPartitionTooSmall+": state partition has 4096 MiB, at least 8192 MiB is required")
+
+	err = checkPartitions(config.Partitions{LogSize: 100})
+	assert.EqualError(t, err, ErrMsgPartitionTooSmall+": log partition has 100 MiB, at least 1024 MiB is required")
+
+	err = checkPartitions(config.Partitions{KernelSize: 256})
+	assert.EqualError(t, err, ErrMsgPartitionTooSmall+": kernel partition has 256 MiB, at least 512 MiB is required")
+}
+
+func TestCheckDiskSize(t *testing.T) {
+	d := disk.Disk{Path: "/dev/sda", Size: 32 * 1024 * mib}
+	assert.Nil(t, checkDiskSize(d, config.Install{}))
+
+	err := checkDiskSize(d, config.Install{Partitions: config.Partitions{StateSize: 30720, LogSize: 4096}})
+	assert.EqualError(t, err, ErrMsgDeviceTooSmall+": /dev/sda has 32.0 GiB, at least 34.0 GiB is required")
+}
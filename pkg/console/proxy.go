@@ -0,0 +1,130 @@
+package console
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+	"github.com/harvester/harvester-installer/pkg/network"
+)
+
+const (
+	httpProxyEnv  = "HTTP_PROXY"
+	httpsProxyEnv = "HTTPS_PROXY"
+	noProxyEnv    = "NO_PROXY"
+)
+
+// hosts that are always reached directly on the installed system, besides
+// the cluster networks
+var defaultNoProxy = []string{
+	"localhost",
+	"127.0.0.1",
+	"0.0.0.0",
+	".svc",
+}
+
+func hasProxy(proxy config.Proxy) bool {
+	return proxy.HTTP != "" || proxy.HTTPS != ""
+}
+
+// setProxyEnv sets the proxy of the installer process, which is passed on to
+// the k3os installation
+func setProxyEnv(proxy config.Proxy) {
+	for key, value := range map[string]string{
+		httpProxyEnv:  proxy.HTTP,
+		httpsProxyEnv: proxy.HTTPS,
+		noProxyEnv:    strings.Join(proxy.NoProxy, ","),
+	} {
+		if value != "" {
+			os.Setenv(key, value)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+// getProxyEnv returns the proxy variables of the installed system, where the
+// cluster and service CIDRs and the addresses of the node are reached directly
+func getProxyEnv(cfg *config.HarvesterConfig) map[string]string {
+	if !hasProxy(cfg.Proxy) {
+		return nil
+	}
+	env := map[string]string{
+		noProxyEnv: strings.Join(getNoProxy(cfg), ","),
+	}
+	if cfg.Proxy.HTTP != "" {
+		env[httpProxyEnv] = cfg.Proxy.HTTP
+	}
+	if cfg.Proxy.HTTPS != "" {
+		env[httpsProxyEnv] = cfg.Proxy.HTTPS
+	}
+	return env
+}
+
+func getNoProxy(cfg *config.HarvesterConfig) []string {
+	noProxy := append(append([]string{}, cfg.Proxy.NoProxy...), defaultNoProxy...)
+	noProxy = append(noProxy, getClusterCIDR(cfg), getServiceCIDR(cfg), "."+getClusterDomain(cfg))
+	if mgmt, ok := getMgmtNetwork(cfg); ok {
+		if mgmt.Method == networkMethodStatic {
+			noProxy = append(noProxy, mgmt.IP)
+		} else if ip, err := getInterfaceIP(mgmt.LinkName()); err == nil && ip != nil {
+			// the address leased to the installer
+			noProxy = append(noProxy, ip.String())
+		}
+	}
+	if cfg.VIP != "" {
+		noProxy = append(noProxy, cfg.VIP)
+	}
+
+	var result []string
+	seen := map[string]bool{}
+	for _, host := range noProxy {
+		if host != "" && !seen[host] {
+			seen[host] = true
+			result = append(result, host)
+		}
+	}
+	return result
+}
+
+// getProxyCheckURLs returns the URLs to fetch through the proxy to check it,
+// which are the config and ISO URLs if there are
+func getProxyCheckURLs(cfg *config.HarvesterConfig) []string {
+	if urls := getDiagnosticTargets(cfg).URLs; len(urls) > 0 {
+		return urls
+	}
+	return []string{"https://" + network.DefaultLookupHost}
+}
+
+// checkProxyReachable fetches the URLs through the proxy
+func checkProxyReachable(proxy config.Proxy, urls []string) error {
+	proxyFunc := (&httpproxy.Config{
+		HTTPProxy:  proxy.HTTP,
+		HTTPSProxy: proxy.HTTPS,
+		NoProxy:    strings.Join(proxy.NoProxy, ","),
+	}).ProxyFunc()
+	client := http.Client{
+		Timeout: defaultHTTPTimeout,
+		Transport: &http.Transport{
+			Proxy: func(req *http.Request) (*url.URL, error) {
+				return proxyFunc(req.URL)
+			},
+		},
+	}
+	for _, u := range urls {
+		resp, err := client.Get(u)
+		if err != nil {
+			return prettyError(ErrMsgProxyUnreachable, err.Error())
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			return prettyError(ErrMsgProxyUnreachable, fmt.Sprintf("%s: %s", u, resp.Status))
+		}
+	}
+	return nil
+}
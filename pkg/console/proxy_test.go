@@ -0,0 +1,70 @@
+package console
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+)
+
+func TestGetProxyEnv(t *testing.T) {
+	cfg := &config.HarvesterConfig{
+		VIP: "10.0.0.100",
+		Proxy: config.Proxy{
+			HTTP:    "http://proxy.example.com:3128",
+			NoProxy: []string{"example.com", "localhost"},
+		},
+	}
+	cfg.Install.MgmtInterface = "eth0"
+	cfg.Install.Networks = []config.Network{
+		{Interface: "eth0", Method: networkMethodStatic, IP: "10.0.0.2", SubnetMask: "255.255.255.0"},
+	}
+
+	assert.Equal(t, map[string]string{
+		httpProxyEnv: "http://proxy.example.com:3128",
+		noProxyEnv:   "example.com,localhost,127.0.0.1,0.0.0.0,.svc,10.52.0.0/16,10.53.0.0/16,.cluster.local,10.0.0.2,10.0.0.100",
+	}, getProxyEnv(cfg))
+
+	assert.Nil(t, getProxyEnv(&config.HarvesterConfig{}))
+}
+
+func TestCheckProxyReachable(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		if r.URL.Host == "denied.example.com" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer proxy.Close()
+
+	p := config.Proxy{HTTP: proxy.URL}
+	assert.Nil(t, checkProxyReachable(p, []string{"http://harvester.example.com/config.yaml"}))
+	assert.Equal(t, []string{"http://harvester.example.com/config.yaml"}, proxied)
+
+	err := checkProxyReachable(p, []string{"http://denied.example.com/config.yaml"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), ErrMsgProxyUnreachable)
+}
+
+func TestToCloudConfigProxy(t *testing.T) {
+	cfg := &config.HarvesterConfig{
+		Proxy: config.Proxy{
+			HTTP:  "http://proxy.example.com:3128",
+			HTTPS: "http://proxy.example.com:3128",
+		},
+	}
+	cfg.Install.Mode = modeJoin
+	cfg.OS.Environment = map[string]string{"FOO": "bar"}
+
+	cloudConfig, err := toCloudConfig(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, "bar", cloudConfig.K3OS.Environment["FOO"])
+	assert.Equal(t, "http://proxy.example.com:3128", cloudConfig.K3OS.Environment[httpProxyEnv])
+	assert.Equal(t, "http://proxy.example.com:3128", cloudConfig.K3OS.Environment[httpsProxyEnv])
+	assert.Contains(t, cloudConfig.K3OS.Environment[noProxyEnv], defaultServiceCIDR)
+	assert.Equal(t, map[string]string{"FOO": "bar"}, cfg.OS.Environment)
+}
@@ -0,0 +1,76 @@
+package console
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+// signatureError is returned when a remote file is not signed by the
+// configured key, in which case the installation must not go on
+type signatureError struct {
+	url string
+	err error
+}
+
+func (e *signatureError) Error() string {
+	return fmt.Sprintf("fail to verify signature of %s: %s", e.url, e.err)
+}
+
+func (e *signatureError) Unwrap() error {
+	return e.err
+}
+
+// getConfigPublicKey returns the key that remote files must be signed with,
+// or nil if no key is configured and signatures are not required
+func getConfigPublicKey(cfg *config.HarvesterConfig) (ed25519.PublicKey, error) {
+	s := cfg.Install.ConfigPublicKey
+	if s == "" {
+		b, err := ioutil.ReadFile(configPublicKeyFile)
+		if os.IsNotExist(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		s = string(b)
+	}
+	return util.ParseSigningKey(s)
+}
+
+func getSignatureURL(fileURL string) (string, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return "", err
+	}
+	u.Path += signatureSuffix
+	return u.String(), nil
+}
+
+// verifyRemoteFile verifies data fetched from fileURL against the detached
+// signature next to it, e.g. config.yaml.sig for config.yaml
+func verifyRemoteFile(client http.Client, fileURL string, data []byte, key ed25519.PublicKey) error {
+	if key == nil {
+		return nil
+	}
+	sigURL, err := getSignatureURL(fileURL)
+	if err != nil {
+		return &signatureError{url: fileURL, err: err}
+	}
+	sig, err := getURL(client, sigURL)
+	if err != nil {
+		return &signatureError{url: fileURL, err: err}
+	}
+	if err := util.VerifySignature(key, data, sig); err != nil {
+		return &signatureError{url: fileURL, err: err}
+	}
+	logrus.Infof("verified the signature of %s", fileURL)
+	return nil
+}
@@ -2,14 +2,17 @@ package console
 
 import (
 	"bufio"
+	"crypto/ed25519"
 	"crypto/tls"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,10 +26,14 @@ import (
 	"k8s.io/apimachinery/pkg/util/rand"
 
 	"github.com/harvester/harvester-installer/pkg/config"
+	"github.com/harvester/harvester-installer/pkg/disk"
+	"github.com/harvester/harvester-installer/pkg/network"
 )
 
 const (
 	defaultHTTPTimeout = 15 * time.Second
+	// connman takes a lease on the links it gets back from the configurator
+	dhcpAddressTimeout = 10 * time.Second
 	harvesterNodePort  = "30443"
 	automaticCmdline   = "harvester.automatic"
 )
@@ -95,12 +102,15 @@ func retryOnError(retryNum, retryInterval int64, process func() error) error {
 	}
 }
 
-func getRemoteSSHKeys(url string) ([]string, error) {
+func getRemoteSSHKeys(url string, signingKey ed25519.PublicKey) ([]string, error) {
 	client := newProxyClient()
 	b, err := getURL(client, url)
 	if err != nil {
 		return nil, err
 	}
+	if err := verifyRemoteFile(client, url, b, signingKey); err != nil {
+		return nil, err
+	}
 
 	var keys []string
 	lines := strings.Split(string(b), "\n")
@@ -126,7 +136,7 @@ func getFormattedServerURL(addr string) (string, error) {
 	if ipErr != nil && domainErr != nil {
 		return "", fmt.Errorf("%s is not a valid ip/domain", addr)
 	}
-	return fmt.Sprintf("https://%s:6443", addr), nil
+	return fmt.Sprintf("https://%s", net.JoinHostPort(addr, "6443")), nil
 }
 
 func getServerURLFromEnvData(data []byte) (string, error) {
@@ -166,21 +176,150 @@ func showNext(c *Console, names ...string) error {
 	return nil
 }
 
+// indent prefixes every non-empty line of s
+func indent(s, prefix string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 func generateHostName() string {
 	return "harvester-" + rand.String(5)
 }
 
-func getConfigureNetworkCMD(network config.Network) string {
-	if network.Method == networkMethodStatic {
-		return fmt.Sprintf("/sbin/harvester-configure-network %s %s %s %s %s %s",
-			network.Interface,
-			network.Method,
-			network.IP,
-			network.SubnetMask,
-			network.Gateway,
-			strings.Join(network.DNSNameservers, " "))
+// getDiagnosticTargets returns the NTP servers and the remote files that the
+// installation needs to reach
+func getDiagnosticTargets(cfg *config.HarvesterConfig) network.DiagnosticTargets {
+	targets := network.DiagnosticTargets{
+		NTPServers: cfg.OS.NTPServers,
+	}
+	for _, rawURL := range []string{cfg.Install.ConfigURL, cfg.Install.ISOURL} {
+		u, err := url.Parse(rawURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		targets.URLs = append(targets.URLs, rawURL)
+		if targets.LookupHost == "" && net.ParseIP(u.Hostname()) == nil {
+			targets.LookupHost = u.Hostname()
+		}
+	}
+	return targets
+}
+
+// parseRoutes parses a comma separated list of routes in the form of
+// "<destination> via <gateway> [metric <metric>]"
+func parseRoutes(s string) ([]config.Route, error) {
+	var routes []config.Route
+	for _, item := range splitList(s) {
+		fields := strings.Fields(item)
+		if (len(fields) != 3 && len(fields) != 5) || fields[1] != "via" || (len(fields) == 5 && fields[3] != "metric") {
+			return nil, fmt.Errorf("%q is not in the form of \"<destination> via <gateway> [metric <metric>]\"", item)
+		}
+		route := config.Route{
+			Destination: fields[0],
+			Gateway:     fields[2],
+		}
+		if len(fields) == 5 {
+			metric, err := strconv.Atoi(fields[4])
+			if err != nil {
+				return nil, fmt.Errorf("%s is not a valid metric", fields[4])
+			}
+			route.Metric = metric
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// splitList splits a comma separated list of user input
+func splitList(s string) []string {
+	var result []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getNetworksFile returns the file that saves the networks to configure on
+// every boot of the installed system
+func getNetworksFile(networks []config.Network) (*k3os.File, error) {
+	b, err := yaml.Marshal(networks)
+	if err != nil {
+		return nil, err
+	}
+	return &k3os.File{
+		Content:            string(b),
+		Owner:              "root",
+		Path:               networksFile,
+		RawFilePermissions: "0600",
+	}, nil
+}
+
+// getMgmtLinkName returns the interface that carries the management network,
+// which is the VLAN interface if the management network is tagged
+func getMgmtLinkName(cfg *config.HarvesterConfig) string {
+	mgmt, _ := getMgmtNetwork(cfg)
+	return mgmt.LinkName()
+}
+
+// getMgmtNetwork returns the management network, which is configured by
+// connman with DHCP if it is not in the networks
+func getMgmtNetwork(cfg *config.HarvesterConfig) (config.Network, bool) {
+	if cfg.Install.MgmtInterface == "" {
+		return config.Network{}, false
+	}
+	for _, n := range cfg.Install.Networks {
+		if n.Interface == cfg.Install.MgmtInterface {
+			return n, true
+		}
+	}
+	return config.Network{Interface: cfg.Install.MgmtInterface}, true
+}
+
+func getClusterCIDR(cfg *config.HarvesterConfig) string {
+	if cfg.ClusterCIDR != "" {
+		return cfg.ClusterCIDR
 	}
-	return fmt.Sprintf("/sbin/harvester-configure-network %s %s", network.Interface, networkMethodDHCP)
+	return defaultClusterCIDR
+}
+
+func getServiceCIDR(cfg *config.HarvesterConfig) string {
+	if cfg.ServiceCIDR != "" {
+		return cfg.ServiceCIDR
+	}
+	return defaultServiceCIDR
+}
+
+func getClusterDomain(cfg *config.HarvesterConfig) string {
+	if cfg.ClusterDomain != "" {
+		return cfg.ClusterDomain
+	}
+	return defaultClusterDomain
+}
+
+// getClusterDNS returns the address of the cluster DNS in the service CIDR
+func getClusterDNS(serviceCIDR string) (string, error) {
+	_, subnet, err := net.ParseCIDR(serviceCIDR)
+	if err != nil {
+		return "", err
+	}
+	ip := make(net.IP, len(subnet.IP))
+	copy(ip, subnet.IP)
+	for i, carry := len(ip)-1, clusterDNSOffset; i >= 0 && carry > 0; i-- {
+		sum := int(ip[i]) + carry
+		ip[i] = byte(sum)
+		carry = sum >> 8
+	}
+	if !subnet.Contains(ip) {
+		return "", fmt.Errorf("service CIDR %s is too small", serviceCIDR)
+	}
+	return ip.String(), nil
 }
 
 func toCloudConfig(cfg *config.HarvesterConfig) (*k3os.CloudConfig, error) {
@@ -192,10 +331,49 @@ func toCloudConfig(cfg *config.HarvesterConfig) (*k3os.CloudConfig, error) {
 	// remove the /dev/loop directory as the workaround for https://github.com/harvester/harvester/issues/665
 	cloudConfig.Runcmd = append(cloudConfig.Runcmd, "rm -rf /dev/loop")
 
-	for _, network := range cfg.Install.Networks {
-		if network.Method == networkMethodStatic {
-			cloudConfig.Runcmd = append(cloudConfig.Runcmd, getConfigureNetworkCMD(network))
+	var networks []config.Network
+	var links []string
+	for _, n := range cfg.Install.Networks {
+		if network.NeedsConfiguration(n) {
+			networks = append(networks, n)
+			links = append(links, network.Links(n)...)
+		}
+	}
+	if len(networks) > 0 {
+		networksFile, err := getNetworksFile(networks)
+		if err != nil {
+			return nil, err
+		}
+		// keep connman from configuring the links from the start
+		connmanConf := network.ConnmanConf(links)
+		if len(cfg.OS.Wifi) > 0 {
+			// the file replaces the one the boot script asks for wifi in
+			connmanConf += connmanWantWifi + "\n"
 		}
+		cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, *networksFile, k3os.File{
+			Content:            connmanConf,
+			Owner:              "root",
+			Path:               connmanConfFile,
+			RawFilePermissions: "0644",
+		})
+		cloudConfig.Runcmd = append(cloudConfig.Runcmd, fmt.Sprintf("k3os network apply %s", networksFile.Path))
+	}
+
+	// mount the data disk before k3s starts Longhorn
+	if cfg.Install.DataDisk != "" {
+		cloudConfig.Bootcmd = append(cloudConfig.Bootcmd, fmt.Sprintf("k3os disk mount-data %s", disk.DataMountPoint))
+	}
+
+	// k3os reads the proxy of k3s and containerd from the environment
+	if proxyEnv := getProxyEnv(cfg); proxyEnv != nil {
+		env := map[string]string{}
+		for key, value := range cloudConfig.K3OS.Environment {
+			env[key] = value
+		}
+		for key, value := range proxyEnv {
+			env[key] = value
+		}
+		cloudConfig.K3OS.Environment = env
 	}
 
 	// k3os & k3s
@@ -205,7 +383,7 @@ func toCloudConfig(cfg *config.HarvesterConfig) (*k3os.CloudConfig, error) {
 
 	var extraK3sArgs []string
 	if cfg.Install.MgmtInterface != "" {
-		extraK3sArgs = []string{"--flannel-iface", cfg.Install.MgmtInterface}
+		extraK3sArgs = []string{"--flannel-iface", getMgmtLinkName(cfg)}
 	}
 
 	if cfg.Install.Mode == modeJoin {
@@ -213,6 +391,13 @@ func toCloudConfig(cfg *config.HarvesterConfig) (*k3os.CloudConfig, error) {
 		return cloudConfig, nil
 	}
 
+	clusterDNS, err := getClusterDNS(getServiceCIDR(cfg))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ClusterDomain != "" {
+		extraK3sArgs = append(extraK3sArgs, "--cluster-domain", cfg.ClusterDomain)
+	}
 	cloudConfig.K3OS.K3sArgs = append([]string{
 		"server",
 		"--cluster-init",
@@ -223,13 +408,23 @@ func toCloudConfig(cfg *config.HarvesterConfig) (*k3os.CloudConfig, error) {
 		"--disable",
 		"traefik",
 		"--cluster-cidr",
-		"10.52.0.0/16",
+		getClusterCIDR(cfg),
 		"--service-cidr",
-		"10.53.0.0/16",
+		getServiceCIDR(cfg),
 		"--cluster-dns",
-		"10.53.0.10",
+		clusterDNS,
 	}, extraK3sArgs...)
 
+	if cfg.VIP != "" {
+		vipManifest, err := getVIPManifestFile(cfg.VIP)
+		if err != nil {
+			return nil, err
+		}
+		cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, *vipManifest)
+		cloudConfig.K3OS.K3sArgs = append(cloudConfig.K3OS.K3sArgs, "--tls-san", cfg.VIP)
+		cloudConfig.K3OS.Labels[vipNodeLabel] = cfg.VIP
+	}
+
 	return cloudConfig, nil
 }
 
@@ -261,7 +456,55 @@ func execute(g *gocui.Gui, env []string, cmdName string) error {
 	return cmd.Wait()
 }
 
-func doInstall(g *gocui.Gui, cloudConfig *k3os.CloudConfig, webhooks RendererWebhooks) error {
+// getNTPServers returns the NTP servers of a config, or the default server if
+// it has none and the default is kept, which automatic installations and the
+// NTP page left as it is do
+func getNTPServers(cfg *config.HarvesterConfig, keepDefault bool) []string {
+	if len(cfg.OS.NTPServers) > 0 || !(keepDefault || cfg.Install.Automatic) {
+		return cfg.OS.NTPServers
+	}
+	return []string{defaultNTPServer}
+}
+
+// getInstallEnv returns the install options that aren't part of the install
+// config of k3os, for the k3os installer
+func getInstallEnv(cfg *config.HarvesterConfig) []string {
+	env := []string{fmt.Sprintf("%s=%s", partitionsEnv, getPartitionsEnv(cfg.Install))}
+	if cfg.Install.MirrorDevice != "" {
+		env = append(env, fmt.Sprintf("%s=%s", mirrorDeviceEnv, cfg.Install.MirrorDevice))
+	}
+	if cfg.Install.DataDisk != "" {
+		env = append(env, fmt.Sprintf("%s=%s", dataDeviceEnv, cfg.Install.DataDisk))
+	}
+	if encryption := cfg.Install.Encryption; encryption.KeyFile != "" {
+		keyLabel := encryption.KeyLabel
+		if keyLabel == "" {
+			keyLabel = defaultEncryptionKeyLabel
+		}
+		env = append(env,
+			fmt.Sprintf("%s=%s", encryptionKeyFileEnv, encryption.KeyFile),
+			fmt.Sprintf("%s=%s", encryptionKeyLabelEnv, keyLabel),
+		)
+	}
+	return env
+}
+
+// writePassphraseFile writes the encryption passphrase to a file only root
+// can read, for the k3os installer
+func writePassphraseFile(passphrase string) (string, error) {
+	f, err := ioutil.TempFile("/tmp", "passphrase.*")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(passphrase); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func doInstall(g *gocui.Gui, cloudConfig *k3os.CloudConfig, installEnv []string, webhooks RendererWebhooks) error {
 	webhooks.Handle(EventInstallStarted)
 
 	var (
@@ -297,6 +540,7 @@ func doInstall(g *gocui.Gui, cloudConfig *k3os.CloudConfig, webhooks RendererWeb
 	}
 
 	env := append(os.Environ(), ev...)
+	env = append(env, installEnv...)
 	if err := execute(g, env, "/usr/libexec/k3os/install"); err != nil {
 		webhooks.Handle(EventInstallFailed)
 		return err
@@ -364,28 +608,62 @@ func printToPanel(g *gocui.Gui, message string, panelName string) {
 	<-ch
 }
 
-func getRemoteConfig(configURL string) (*config.HarvesterConfig, error) {
-	client := newProxyClient()
-	b, err := getURL(client, configURL)
+// loadRemoteConfig loads a fetched config for this machine, rendering it as a
+// template first if asked to by the local config. In strict mode unknown keys
+// fail the loading with a config.UnknownKeysError, and the config is still
+// returned so that its FAILED webhooks can be fired.
+func loadRemoteConfig(b []byte, local *config.HarvesterConfig) (*config.HarvesterConfig, error) {
+	facts := getHostFacts()
+	if local.Install.ConfigTemplate {
+		rendered, err := config.RenderHarvesterConfig(b, facts)
+		if err != nil {
+			return nil, err
+		}
+		b = rendered
+	}
+	harvestCfg, err := config.LoadHarvesterConfigForHost(b, facts)
 	if err != nil {
 		return nil, err
 	}
-	harvestCfg, err := config.LoadHarvesterConfig(b)
+	if err := config.CheckUnknownKeys(b); err != nil {
+		if local.StrictConfig() {
+			return harvestCfg, err
+		}
+		logrus.Warnf("remote config has unknown keys:\n%s", err)
+	}
+	return harvestCfg, nil
+}
+
+func getRemoteConfig(local *config.HarvesterConfig) (*config.HarvesterConfig, error) {
+	signingKey, err := getConfigPublicKey(local)
 	if err != nil {
 		return nil, err
 	}
-	return harvestCfg, nil
+	client := newProxyClient()
+	b, err := getURL(client, local.Install.ConfigURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyRemoteFile(client, local.Install.ConfigURL, b, signingKey); err != nil {
+		return nil, err
+	}
+	return loadRemoteConfig(b, local)
 }
 
-func retryRemoteConfig(configURL string, g *gocui.Gui) (*config.HarvesterConfig, error) {
+func retryRemoteConfig(local *config.HarvesterConfig, g *gocui.Gui) (*config.HarvesterConfig, error) {
+	signingKey, err := getConfigPublicKey(local)
+	if err != nil {
+		return nil, fmt.Errorf("Fail to load config public key: %w", err)
+	}
+
 	var confData []byte
 	client := newProxyClient()
 
 	retries := 30
 	interval := 10
-	err := retryOnError(int64(retries), int64(interval), func() error {
+	err = retryOnError(int64(retries), int64(interval), func() error {
 		var e error
-		confData, e = getURL(client, configURL)
+		confData, e = getURL(client, local.Install.ConfigURL)
 		if e != nil {
 			logrus.Error(e)
 			printToPanel(g, e.Error(), installPanel)
@@ -398,23 +676,29 @@ func retryRemoteConfig(configURL string, g *gocui.Gui) (*config.HarvesterConfig,
 	if err != nil {
 		return nil, fmt.Errorf("Fail to fetch config: %w", err)
 	}
+	if err := verifyRemoteFile(client, local.Install.ConfigURL, confData, signingKey); err != nil {
+		return nil, err
+	}
 
-	harvestCfg, err := config.LoadHarvesterConfig(confData)
+	harvestCfg, err := loadRemoteConfig(confData, local)
 	if err != nil {
-		return nil, fmt.Errorf("Fail to load config: %w", err)
+		return harvestCfg, fmt.Errorf("Fail to load config: %w", err)
 	}
 	return harvestCfg, nil
 }
 
-// harvesterInstalled check existing harvester installation by partition label
+// harvesterInstalled checks for an existing Harvester installation on the
+// disks, mirrored ones included
 func harvesterInstalled() (bool, error) {
-	output, err := exec.Command("blkid", "-L", "HARVESTER_STATE").CombinedOutput()
+	disks, err := disk.List()
 	if err != nil {
 		return false, err
 	}
-	if string(output) != "" {
-		return true, nil
+	for _, d := range disks {
+		// upgrading from the ISO can't unlock an encrypted installation
+		if d.HasHarvester() && !d.Encrypted() {
+			return true, nil
+		}
 	}
-
 	return false, nil
 }
@@ -1,6 +1,8 @@
 package console
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"net"
@@ -8,9 +10,11 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/ghodss/yaml"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/harvester/harvester-installer/pkg/config"
+	"github.com/harvester/harvester-installer/pkg/network"
 	"github.com/harvester/harvester-installer/pkg/util"
 )
 
@@ -45,7 +49,7 @@ func TestGetSSHKeysFromURL(t *testing.T) {
 			}))
 			defer ts.Close()
 
-			pubKeys, err := getRemoteSSHKeys(ts.URL)
+			pubKeys, err := getRemoteSSHKeys(ts.URL, nil)
 			if testCase.expectError != "" {
 				assert.EqualError(t, err, testCase.expectError)
 			} else {
@@ -74,6 +78,12 @@ func TestGetFormattedServerURL(t *testing.T) {
 			output: "https://1.2.3.4:6443",
 			err:    nil,
 		},
+		{
+			Name:   "ipv6",
+			input:  "2001:db8::1",
+			output: "https://[2001:db8::1]:6443",
+			err:    nil,
+		},
 		{
 			Name:   "domain name",
 			input:  "example.org",
@@ -138,6 +148,218 @@ func TestGetServerURLFromEnvData(t *testing.T) {
 	}
 }
 
+func TestToCloudConfigNetworks(t *testing.T) {
+	cfg := &config.HarvesterConfig{}
+	cfg.Install.Mode = modeJoin
+	cfg.Install.MgmtInterface = "bond0"
+	cfg.Install.Networks = []config.Network{
+		{
+			Interface: "eth2",
+			Method:    networkMethodDHCP,
+		},
+		{
+			Interface: "bond0",
+			Method:    networkMethodDHCP,
+			Bond: &config.Bond{
+				Members: []string{"eth0", "eth1"},
+				Mode:    "802.3ad",
+			},
+			VLANID: 100,
+			MTU:    9000,
+			Routes: []config.Route{
+				{Destination: "10.10.0.0/16", Gateway: "10.0.0.254", Metric: 100},
+			},
+		},
+	}
+
+	cloudConfig, err := toCloudConfig(cfg)
+	assert.Nil(t, err)
+	assert.Contains(t, cloudConfig.Runcmd, "k3os network apply "+networksFile)
+	assert.Equal(t, []string{"agent", "--flannel-iface", "bond0.100"}, cloudConfig.K3OS.K3sArgs)
+
+	files := map[string]string{}
+	for _, f := range cloudConfig.WriteFiles {
+		files[f.Path] = f.Content
+	}
+	assert.Equal(t, "command_args=\"-r --nodevice=eth0,eth1,bond0,bond0.100\"\n", files[connmanConfFile])
+
+	cfg.OS.Wifi = []config.Wifi{{Name: "home", Passphrase: "passphrase"}}
+	cloudConfig, err = toCloudConfig(cfg)
+	assert.Nil(t, err)
+	for _, f := range cloudConfig.WriteFiles {
+		if f.Path == connmanConfFile {
+			assert.Equal(t, "command_args=\"-r --nodevice=eth0,eth1,bond0,bond0.100\"\nrc_want=\"wpa_supplicant\"\n", f.Content)
+		}
+	}
+
+	// only the networks connman can't configure are saved
+	var networks []config.Network
+	assert.Nil(t, yaml.Unmarshal([]byte(files[networksFile]), &networks))
+	assert.Equal(t, cfg.Install.Networks[1:], networks)
+}
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := parseRoutes("10.10.0.0/16 via 10.0.0.254 metric 100, 2001:db8:1::/48 via 2001:db8::1")
+	assert.Nil(t, err)
+	assert.Equal(t, []config.Route{
+		{Destination: "10.10.0.0/16", Gateway: "10.0.0.254", Metric: 100},
+		{Destination: "2001:db8:1::/48", Gateway: "2001:db8::1"},
+	}, routes)
+
+	routes, err = parseRoutes("")
+	assert.Nil(t, err)
+	assert.Nil(t, routes)
+
+	_, err = parseRoutes("10.10.0.0/16 10.0.0.254")
+	assert.NotNil(t, err)
+	_, err = parseRoutes("10.10.0.0/16 via 10.0.0.254 metric high")
+	assert.NotNil(t, err)
+}
+
+func TestGetMgmtLinkName(t *testing.T) {
+	cfg := &config.HarvesterConfig{}
+	cfg.Install.MgmtInterface = "bond0"
+	assert.Equal(t, "bond0", getMgmtLinkName(cfg))
+
+	cfg.Install.Networks = []config.Network{
+		{Interface: "eth2", VLANID: 200},
+		{Interface: "bond0", VLANID: 100},
+	}
+	assert.Equal(t, "bond0.100", getMgmtLinkName(cfg))
+}
+
+func TestGetDiagnosticTargets(t *testing.T) {
+	cfg := &config.HarvesterConfig{}
+	cfg.OS.NTPServers = []string{"ntp.example.com"}
+	cfg.Install.ConfigURL = "http://10.0.0.2/config.yaml"
+	cfg.Install.ISOURL = "https://releases.example.com/harvester.iso"
+	assert.Equal(t, network.DiagnosticTargets{
+		NTPServers: []string{"ntp.example.com"},
+		URLs:       []string{"http://10.0.0.2/config.yaml", "https://releases.example.com/harvester.iso"},
+		LookupHost: "releases.example.com",
+	}, getDiagnosticTargets(cfg))
+
+	cfg.Install.ConfigURL = ""
+	cfg.Install.ISOURL = "/dev/sr0"
+	assert.Equal(t, network.DiagnosticTargets{
+		NTPServers: []string{"ntp.example.com"},
+	}, getDiagnosticTargets(cfg))
+}
+
+func TestToCloudConfigVIP(t *testing.T) {
+	cfg := &config.HarvesterConfig{VIP: "10.0.0.100"}
+	cfg.Install.Mode = modeCreate
+	cfg.Install.MgmtInterface = "eth0"
+
+	cloudConfig, err := toCloudConfig(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"--tls-san", "10.0.0.100"}, cloudConfig.K3OS.K3sArgs[len(cloudConfig.K3OS.K3sArgs)-2:])
+	assert.Equal(t, "10.0.0.100", cloudConfig.K3OS.Labels[vipNodeLabel])
+
+	files := map[string]string{}
+	for _, f := range cloudConfig.WriteFiles {
+		files[f.Path] = f.Content
+	}
+	assert.Contains(t, files[vipManifestFile], "value: 10.0.0.100\n")
+	assert.NotContains(t, files[vipManifestFile], "vip_interface")
+}
+
+func TestToCloudConfigDataDisk(t *testing.T) {
+	cfg := &config.HarvesterConfig{}
+	cfg.Install.Mode = modeJoin
+	cloudConfig, err := toCloudConfig(cfg)
+	assert.Nil(t, err)
+	assert.Empty(t, cloudConfig.Bootcmd)
+
+	cfg.Install.DataDisk = "/dev/sdb"
+	cloudConfig, err = toCloudConfig(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"k3os disk mount-data /var/lib/longhorn"}, cloudConfig.Bootcmd)
+}
+
+func TestGetNTPServers(t *testing.T) {
+	cfg := &config.HarvesterConfig{}
+	assert.Equal(t, []string{defaultNTPServer}, getNTPServers(cfg, true))
+	// the NTP page was cleared to skip NTP
+	assert.Nil(t, getNTPServers(cfg, false))
+
+	cfg.Install.Automatic = true
+	assert.Equal(t, []string{defaultNTPServer}, getNTPServers(cfg, false))
+
+	// servers of the user or the remote config replace the default
+	cfg.OS.NTPServers = []string{"ntp.example.com"}
+	assert.Equal(t, []string{"ntp.example.com"}, getNTPServers(cfg, true))
+}
+
+func TestGetInstallEnv(t *testing.T) {
+	cfg := &config.HarvesterConfig{}
+	assert.Equal(t, []string{"K3OS_INSTALL_PARTITIONS=boot:50 state:fill"}, getInstallEnv(cfg))
+
+	cfg.Install.MirrorDevice = "/dev/sdb"
+	assert.Equal(t, []string{
+		"K3OS_INSTALL_PARTITIONS=boot:50 state:fill",
+		"K3OS_INSTALL_MIRROR_DEVICE=/dev/sdb",
+	}, getInstallEnv(cfg))
+
+	cfg.Install.MirrorDevice = ""
+	cfg.Install.DataDisk = "/dev/sdc"
+	assert.Equal(t, []string{
+		"K3OS_INSTALL_PARTITIONS=boot:50 state:fill",
+		"K3OS_INSTALL_DATA_DEVICE=/dev/sdc",
+	}, getInstallEnv(cfg))
+
+	cfg.Install.DataDisk = ""
+	cfg.Install.Encryption.KeyFile = "/harvester.key"
+	assert.Equal(t, []string{
+		"K3OS_INSTALL_PARTITIONS=boot:50 kernel:1024 state:fill",
+		"K3OS_INSTALL_ENCRYPTION_KEY_FILE=/harvester.key",
+		"K3OS_INSTALL_ENCRYPTION_KEY_LABEL=HARVESTER_KEY",
+	}, getInstallEnv(cfg))
+}
+
+func TestGetClusterDNS(t *testing.T) {
+	dns, err := getClusterDNS(defaultServiceCIDR)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.53.0.10", dns)
+
+	dns, err = getClusterDNS("172.16.255.0/24")
+	assert.Nil(t, err)
+	assert.Equal(t, "172.16.255.10", dns)
+
+	_, err = getClusterDNS("172.16.255.0/29")
+	assert.NotNil(t, err)
+}
+
+func TestToCloudConfigClusterNetworks(t *testing.T) {
+	cfg := &config.HarvesterConfig{
+		ClusterCIDR:   "172.20.0.0/16",
+		ServiceCIDR:   "172.21.0.0/16",
+		ClusterDomain: "harvester.local",
+	}
+	cfg.Install.Mode = modeCreate
+
+	cloudConfig, err := toCloudConfig(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"server",
+		"--cluster-init",
+		"--disable",
+		"local-storage",
+		"--disable",
+		"servicelb",
+		"--disable",
+		"traefik",
+		"--cluster-cidr",
+		"172.20.0.0/16",
+		"--service-cidr",
+		"172.21.0.0/16",
+		"--cluster-dns",
+		"172.21.0.10",
+		"--cluster-domain",
+		"harvester.local",
+	}, cloudConfig.K3OS.K3sArgs)
+}
+
 func TestToCloudConfig(t *testing.T) {
 	testCases := []struct {
 		name       string
@@ -171,3 +393,63 @@ func TestToCloudConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRemoteConfigSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	configData := []byte("token: TOKEN_VALUE\n")
+
+	testCases := []struct {
+		name      string
+		signature []byte
+		publicKey string
+		sigError  bool
+	}{
+		{
+			name:      "valid signature",
+			signature: ed25519.Sign(priv, configData),
+			publicKey: base64.StdEncoding.EncodeToString(pub),
+		},
+		{
+			name:      "invalid signature",
+			signature: ed25519.Sign(priv, []byte("token: OTHER\n")),
+			publicKey: base64.StdEncoding.EncodeToString(pub),
+			sigError:  true,
+		},
+		{
+			name:      "missing signature",
+			publicKey: base64.StdEncoding.EncodeToString(pub),
+			sigError:  true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/config.yaml":
+					w.Write(configData)
+				case "/config.yaml.sig":
+					if testCase.signature == nil {
+						http.NotFound(w, r)
+						return
+					}
+					w.Write(testCase.signature)
+				}
+			}))
+			defer ts.Close()
+
+			local := config.NewHarvesterConfig()
+			local.Install.ConfigURL = ts.URL + "/config.yaml"
+			local.Install.ConfigPublicKey = testCase.publicKey
+			remote, err := getRemoteConfig(local)
+			if testCase.sigError {
+				var sigErr *signatureError
+				assert.True(t, errors.As(err, &sigErr), "expect a signature error, got %v", err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "TOKEN_VALUE", remote.Token)
+		})
+	}
+}
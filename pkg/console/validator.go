@@ -3,12 +3,19 @@ package console
 import (
 	"fmt"
 	"net"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/util/validation"
 
 	"github.com/harvester/harvester-installer/pkg/config"
+	"github.com/harvester/harvester-installer/pkg/disk"
+	"github.com/harvester/harvester-installer/pkg/network"
+	"github.com/harvester/harvester-installer/pkg/util"
 )
 
 var (
@@ -16,6 +23,7 @@ var (
 	ErrMsgModeJoinServerURLNotSpecified = fmt.Sprintf("ServerURL can't empty in %s mode", modeJoin)
 	ErrMsgModeUnknown                   = "unknown mode"
 	ErrMsgTokenNotSpecified             = "token not specified"
+	ErrMsgModeJoinContainsVIP           = fmt.Sprintf("VIP can only be set in %s mode", modeCreate)
 
 	ErrMsgMgmtInterfaceNotSpecified = "no management interface specified"
 	ErrMsgInterfaceNotSpecified     = "no interface specified"
@@ -23,9 +31,42 @@ var (
 	ErrMsgInterfaceIsLoop           = "interface is a loopback interface"
 	ErrMsgDeviceNotSpecified        = "no device specified"
 	ErrMsgDeviceNotFound            = "device not found"
+	ErrMsgDeviceTooSmall            = "device is too small"
+	ErrMsgDeviceNotEmpty            = "device is not empty"
+	ErrMsgDeviceSelectorInvalid     = "invalid device selector"
+	ErrMsgPartitionFillUnknown      = "partition to fill the disk must be one of state, rancher or log"
+	ErrMsgPartitionTooSmall         = "partition is too small"
+	ErrMsgMirrorIsDevice            = "mirror device must not be the installation device"
+	ErrMsgMirrorNoFormat            = "mirrored installations can't skip formatting"
+	ErrMsgDataDiskIsDevice          = "data disk must not be the installation device"
+	ErrMsgDataDiskNotFound          = "data disk not found"
+	ErrMsgEncryptionNoFormat        = "encrypted installations can't skip formatting"
+	ErrMsgEncryptionKeyFileInvalid  = "key file must be an absolute path without spaces"
+	ErrMsgEncryptionKeyLabelInvalid = "key label must not contain spaces"
+	ErrMsgEncryptionKeyNotFound     = "key device not found"
 	ErrMsgNoCredentials             = "no SSH authorized keys or passwords are set"
 
 	ErrMsgNetworkMethodUnknown = "unknown network method"
+	ErrMsgNetworkDisabled      = "both IPv4 and IPv6 are disabled"
+	ErrMsgBondNoMembers        = "no bond members specified"
+	ErrMsgBondModeUnknown      = "unknown bond mode"
+	ErrMsgBondMiimonInvalid    = "bond miimon must not be negative"
+	ErrMsgBondMemberInvalid    = "invalid bond member"
+	ErrMsgVLANIDInvalid        = "VLAN ID must be between 1 and 4094"
+	ErrMsgMTUInvalid           = fmt.Sprintf("MTU must be between %d and %d", minMTU, maxMTU)
+	ErrMsgIPv6MTUInvalid       = fmt.Sprintf("MTU must be at least %d with IPv6", minIPv6MTU)
+	ErrMsgRouteInvalid         = "invalid route"
+	ErrMsgNTPServerInvalid     = "NTP server must be an IP address or a domain"
+	ErrMsgVIPInvalid           = "VIP must be an IPv4 address"
+	ErrMsgVIPNotInSubnet       = "VIP is not in the management subnet"
+	ErrMsgVIPInUse             = "VIP is in use"
+	ErrMsgProxyInvalid         = "proxy must be in the form of http://[[user][:pass]@]host[:port]"
+	ErrMsgNoProxyInvalid       = "invalid host to reach without the proxy"
+	ErrMsgProxyUnreachable     = "fail to fetch through the proxy"
+	ErrMsgCIDRInvalid          = "invalid CIDR"
+	ErrMsgServiceCIDRTooSmall  = fmt.Sprintf("service CIDR must have a prefix length of at most %d", maxServiceCIDRPrefix)
+	ErrMsgCIDROverlap          = "cluster networks overlap"
+	ErrMsgClusterDomainInvalid = "invalid cluster domain"
 )
 
 type ValidatorInterface interface {
@@ -35,6 +76,11 @@ type ValidatorInterface interface {
 type ConfigValidator struct {
 }
 
+// OfflineValidator only runs the checks that don't depend on the hardware of
+// the machine being installed, so configs can be linted anywhere.
+type OfflineValidator struct {
+}
+
 func prettyError(errMsg string, value string) error {
 	return errors.Errorf("%s: %s", errMsg, value)
 }
@@ -58,20 +104,129 @@ func checkInterface(name string) error {
 	return prettyError(ErrMsgInterfaceNotFound, name)
 }
 
-func checkDevice(device string) error {
+func checkDevice(device string, install config.Install) error {
 	if device == "" {
 		return errors.New(ErrMsgDeviceNotSpecified)
 	}
-	options, err := getDiskOptions()
+	d, err := disk.Find(device)
 	if err != nil {
 		return err
 	}
-	for _, option := range options {
-		if device == option.Value {
-			return nil
+	if d == nil {
+		return prettyError(ErrMsgDeviceNotFound, device)
+	}
+	return checkDiskSize(*d, install)
+}
+
+// checkDataDisk checks the data disk exists and isn't an installation device
+func checkDataDisk(dataDisk string, devices ...string) error {
+	for _, device := range devices {
+		if dataDisk == device {
+			return prettyError(ErrMsgDataDiskIsDevice, dataDisk)
+		}
+	}
+	d, err := disk.Find(dataDisk)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		return prettyError(ErrMsgDataDiskNotFound, dataDisk)
+	}
+	return nil
+}
+
+// checkEncryption checks the encryption can be set up, the key file being
+// looked for when the installation runs
+func checkEncryption(install config.Install) error {
+	encryption := install.Encryption
+	if !encryption.Enabled() {
+		return nil
+	}
+	if install.NoFormat {
+		return errors.New(ErrMsgEncryptionNoFormat)
+	}
+	// the key file and its label are passed on the kernel command line
+	if encryption.KeyFile != "" && (!filepath.IsAbs(encryption.KeyFile) || strings.ContainsAny(encryption.KeyFile, " \t")) {
+		return prettyError(ErrMsgEncryptionKeyFileInvalid, encryption.KeyFile)
+	}
+	if strings.ContainsAny(encryption.KeyLabel, " \t") {
+		return prettyError(ErrMsgEncryptionKeyLabelInvalid, encryption.KeyLabel)
+	}
+	return nil
+}
+
+// checkEncryptionKey checks the device holding the key file is plugged in
+func checkEncryptionKey(encryption config.Encryption) error {
+	if encryption.KeyFile == "" {
+		return nil
+	}
+	label := encryption.KeyLabel
+	if label == "" {
+		label = defaultEncryptionKeyLabel
+	}
+	device, err := disk.FindLabel(label)
+	if err != nil {
+		return err
+	}
+	if device == "" {
+		return prettyError(ErrMsgEncryptionKeyNotFound, fmt.Sprintf("no filesystem is labeled %s", label))
+	}
+	return nil
+}
+
+// checkDeviceSelectors checks the syntax of the disks given by selectors
+func checkDeviceSelectors(install config.Install) error {
+	for _, device := range []string{install.Device, install.MirrorDevice, install.DataDisk} {
+		if !disk.IsSelector(device) {
+			continue
+		}
+		if _, err := disk.ParseSelector(device); err != nil {
+			return prettyError(ErrMsgDeviceSelectorInvalid, err.Error())
+		}
+	}
+	return nil
+}
+
+// checkDiskSize checks the disk can hold the partition layout
+func checkDiskSize(d disk.Disk, install config.Install) error {
+	if minSize := getMinDiskSize(install); d.Size < minSize {
+		return prettyError(ErrMsgDeviceTooSmall, fmt.Sprintf("%s has %s, at least %s is required", d.Path, disk.FormatSize(d.Size), disk.FormatSize(minSize)))
+	}
+	return nil
+}
+
+// checkWipe checks there is nothing on the disk to lose by wiping it
+func checkWipe(d disk.Disk) error {
+	if d.InUse() {
+		return prettyError(ErrMsgDeviceNotEmpty, fmt.Sprintf("%s has %s, set install.force to wipe it", d.Path, d.Contents()))
+	}
+	return nil
+}
+
+// checkDisksEmpty checks the disks to be wiped by the installation are empty.
+// A data disk that is already formatted is kept as it is.
+func checkDisksEmpty(install config.Install) error {
+	var devices []string
+	if !install.NoFormat {
+		devices = append(devices, install.Device)
+	}
+	devices = append(devices, install.MirrorDevice, install.DataDisk)
+	for _, device := range devices {
+		if device == "" {
+			continue
+		}
+		d, err := disk.Find(device)
+		if err != nil {
+			return err
+		}
+		if d == nil || (device == install.DataDisk && d.HasData()) {
+			continue
+		}
+		if err := checkWipe(*d); err != nil {
+			return err
 		}
 	}
-	return prettyError(ErrMsgDeviceNotFound, device)
+	return nil
 }
 
 func checkStaticRequiredString(field, value string) error {
@@ -96,12 +251,34 @@ func checkDomain(domain string) error {
 }
 
 func checkIP(addr string) error {
-	if ip := net.ParseIP(addr); ip == nil || ip.To4() == nil {
+	if ip := net.ParseIP(addr); ip == nil {
 		return fmt.Errorf("%s is not a valid IP address", addr)
 	}
 	return nil
 }
 
+func checkIPv4(addr string) error {
+	if ip := net.ParseIP(addr); ip == nil || ip.To4() == nil {
+		return fmt.Errorf("%s is not a valid IPv4 address", addr)
+	}
+	return nil
+}
+
+func checkIPv6(addr string) error {
+	if ip := net.ParseIP(addr); ip == nil || ip.To4() != nil {
+		return fmt.Errorf("%s is not a valid IPv6 address", addr)
+	}
+	return nil
+}
+
+func checkIPv6CIDR(cidr string) error {
+	ip, _, err := net.ParseCIDR(cidr)
+	if err != nil || ip.To4() != nil {
+		return fmt.Errorf("%s is not a valid IPv6 address with prefix length", cidr)
+	}
+	return nil
+}
+
 func checkIPList(ipList []string) error {
 	for _, ip := range ipList {
 		if err := checkIP(ip); err != nil {
@@ -111,41 +288,172 @@ func checkIPList(ipList []string) error {
 	return nil
 }
 
+func checkNetwork(network config.Network) error {
+	if network.Interface == "" {
+		return errors.New(ErrMsgInterfaceNotSpecified)
+	}
+	if network.Method == networkMethodNone && (network.IPv6Method == "" || network.IPv6Method == networkMethodNone) {
+		return prettyError(ErrMsgNetworkDisabled, network.Interface)
+	}
+	if network.Bond != nil {
+		if err := checkBond(network.Interface, *network.Bond); err != nil {
+			return err
+		}
+	}
+	if network.VLANID < 0 || network.VLANID > maxVLANID {
+		return prettyError(ErrMsgVLANIDInvalid, strconv.Itoa(network.VLANID))
+	}
+	if err := checkMTU(network); err != nil {
+		return err
+	}
+	if err := checkRoutes(network.Routes); err != nil {
+		return err
+	}
+	switch networkMethod := network.Method; networkMethod {
+	case networkMethodDHCP, networkMethodNone, "":
+	case networkMethodStatic:
+		if err := checkStaticRequiredString("ip", network.IP); err != nil {
+			return err
+		}
+		if err := checkIPv4(network.IP); err != nil {
+			return err
+		}
+		if err := checkStaticRequiredString("subnetMask", network.SubnetMask); err != nil {
+			return err
+		}
+		if err := checkIPv4(network.SubnetMask); err != nil {
+			return err
+		}
+		if err := checkStaticRequiredString("gateway", network.Gateway); err != nil {
+			return err
+		}
+		if err := checkIPv4(network.Gateway); err != nil {
+			return err
+		}
+		if err := checkStaticRequiredSlice("dns servers", network.DNSNameservers); err != nil {
+			return err
+		}
+		if err := checkIPList(network.DNSNameservers); err != nil {
+			return err
+		}
+	default:
+		return prettyError(ErrMsgNetworkMethodUnknown, networkMethod)
+	}
+	return checkIPv6Network(network)
+}
+
+func checkIPv6Network(network config.Network) error {
+	switch networkMethod := network.IPv6Method; networkMethod {
+	case networkMethodSLAAC, networkMethodDHCPv6, networkMethodNone, "":
+	case networkMethodStatic:
+		if err := checkStaticRequiredString("ipv6", network.IPv6); err != nil {
+			return err
+		}
+		if err := checkIPv6CIDR(network.IPv6); err != nil {
+			return err
+		}
+		if err := checkStaticRequiredString("ipv6Gateway", network.IPv6Gateway); err != nil {
+			return err
+		}
+		if err := checkIPv6(network.IPv6Gateway); err != nil {
+			return err
+		}
+		if err := checkStaticRequiredSlice("dns servers", network.DNSNameservers); err != nil {
+			return err
+		}
+		if err := checkIPList(network.DNSNameservers); err != nil {
+			return err
+		}
+	default:
+		return prettyError(ErrMsgNetworkMethodUnknown, networkMethod)
+	}
+	return nil
+}
+
+func checkMTU(network config.Network) error {
+	if network.MTU == 0 {
+		return nil
+	}
+	if network.MTU < minMTU || network.MTU > maxMTU {
+		return prettyError(ErrMsgMTUInvalid, strconv.Itoa(network.MTU))
+	}
+	if network.MTU < minIPv6MTU && network.IPv6Method != "" && network.IPv6Method != networkMethodNone {
+		return prettyError(ErrMsgIPv6MTUInvalid, strconv.Itoa(network.MTU))
+	}
+	return nil
+}
+
+func checkRoutes(routes []config.Route) error {
+	for _, route := range routes {
+		_, dst, err := net.ParseCIDR(route.Destination)
+		if err != nil {
+			return prettyError(ErrMsgRouteInvalid, fmt.Sprintf("%s is not a valid destination", route.Destination))
+		}
+		gw := net.ParseIP(route.Gateway)
+		if gw == nil {
+			return prettyError(ErrMsgRouteInvalid, fmt.Sprintf("%s is not a valid gateway", route.Gateway))
+		}
+		if (dst.IP.To4() == nil) != (gw.To4() == nil) {
+			return prettyError(ErrMsgRouteInvalid, fmt.Sprintf("gateway %s is not of the family of %s", route.Gateway, route.Destination))
+		}
+		if route.Metric < 0 {
+			return prettyError(ErrMsgRouteInvalid, fmt.Sprintf("metric %d is negative", route.Metric))
+		}
+	}
+	return nil
+}
+
+func checkBond(name string, bond config.Bond) error {
+	if len(bond.Members) == 0 {
+		return prettyError(ErrMsgBondNoMembers, name)
+	}
+	if bond.Mode != "" && !util.StringSliceContains(bondModes, bond.Mode) {
+		return prettyError(ErrMsgBondModeUnknown, bond.Mode)
+	}
+	if bond.Miimon < 0 {
+		return prettyError(ErrMsgBondMiimonInvalid, strconv.Itoa(bond.Miimon))
+	}
+	seen := map[string]bool{}
+	for _, member := range bond.Members {
+		if member == "" || member == name || seen[member] {
+			return prettyError(ErrMsgBondMemberInvalid, member)
+		}
+		seen[member] = true
+	}
+	return nil
+}
+
+// checkNetworkInterfaces checks the NICs a network is built on exist, that is
+// the bond members for a bond
+func checkNetworkInterfaces(network config.Network) error {
+	if network.Bond == nil {
+		return checkInterface(network.Interface)
+	}
+	for _, member := range network.Bond.Members {
+		if err := checkInterface(member); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isBondInterface reports whether name is a bond created by one of networks
+func isBondInterface(networks []config.Network, name string) bool {
+	for _, network := range networks {
+		if network.Bond != nil && network.Interface == name {
+			return true
+		}
+	}
+	return false
+}
+
 func checkNetworks(networks []config.Network) error {
 	for _, network := range networks {
-		if err := checkInterface(network.Interface); err != nil {
+		if err := checkNetworkInterfaces(network); err != nil {
 			return err
 		}
-		switch networkMethod := network.Method; networkMethod {
-		case networkMethodDHCP, "":
-			return nil
-		case networkMethodStatic:
-			if err := checkStaticRequiredString("ip", network.IP); err != nil {
-				return err
-			}
-			if err := checkIP(network.IP); err != nil {
-				return err
-			}
-			if err := checkStaticRequiredString("subnetMask", network.SubnetMask); err != nil {
-				return err
-			}
-			if err := checkIP(network.SubnetMask); err != nil {
-				return err
-			}
-			if err := checkStaticRequiredString("gateway", network.Gateway); err != nil {
-				return err
-			}
-			if err := checkIP(network.Gateway); err != nil {
-				return err
-			}
-			if err := checkStaticRequiredSlice("dns servers", network.DNSNameservers); err != nil {
-				return err
-			}
-			if err := checkIPList(network.DNSNameservers); err != nil {
-				return err
-			}
-		default:
-			return prettyError(ErrMsgNetworkMethodUnknown, networkMethod)
+		if err := checkNetwork(network); err != nil {
+			return err
 		}
 	}
 
@@ -157,18 +465,84 @@ func (v ConfigValidator) Validate(cfg *config.HarvesterConfig) error {
 		return errors.New(ErrMsgMgmtInterfaceNotSpecified)
 	}
 
-	if err := checkInterface(cfg.Install.MgmtInterface); err != nil {
+	if !isBondInterface(cfg.Install.Networks, cfg.Install.MgmtInterface) {
+		if err := checkInterface(cfg.Install.MgmtInterface); err != nil {
+			return err
+		}
+	}
+
+	if err := checkDevice(cfg.Install.Device, cfg.Install); err != nil {
 		return err
 	}
 
-	if err := checkDevice(cfg.Install.Device); err != nil {
+	if cfg.Install.MirrorDevice != "" {
+		if err := checkDevice(cfg.Install.MirrorDevice, cfg.Install); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Install.DataDisk != "" {
+		if err := checkDataDisk(cfg.Install.DataDisk, cfg.Install.Device, cfg.Install.MirrorDevice); err != nil {
+			return err
+		}
+	}
+
+	if err := checkEncryptionKey(cfg.Install.Encryption); err != nil {
 		return err
 	}
 
+	// the installer asks before wiping disks interactively
+	if cfg.Install.Automatic && !cfg.Install.Force {
+		if err := checkDisksEmpty(cfg.Install); err != nil {
+			return err
+		}
+	}
+
 	if err := checkNetworks(cfg.Install.Networks); err != nil {
 		return err
 	}
 
+	if cfg.VIP != "" {
+		mgmt, _ := getMgmtNetwork(cfg)
+		if err := checkVIPAvailable(cfg.VIP, mgmt); err != nil {
+			return err
+		}
+	}
+
+	if err := checkClusterNetworks(cfg, getLinkSubnets(cfg)); err != nil {
+		return err
+	}
+
+	if hasProxy(cfg.Proxy) {
+		if err := checkProxyReachable(cfg.Proxy, getProxyCheckURLs(cfg)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (v OfflineValidator) Validate(cfg *config.HarvesterConfig) error {
+	if cfg.Install.MgmtInterface == "" {
+		return errors.New(ErrMsgMgmtInterfaceNotSpecified)
+	}
+
+	if cfg.Install.Device == "" {
+		return errors.New(ErrMsgDeviceNotSpecified)
+	}
+
+	for _, network := range cfg.Install.Networks {
+		if err := checkNetwork(network); err != nil {
+			return err
+		}
+	}
+
+	for _, webhook := range cfg.Install.Webhooks {
+		if _, err := prepareWebhook(webhook, map[string]string{}); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -181,10 +555,19 @@ func commonCheck(cfg *config.HarvesterConfig) error {
 		if cfg.ServerURL != "" {
 			return errors.New(ErrMsgModeCreateContainsServerURL)
 		}
+		if cfg.VIP != "" {
+			mgmt, _ := getMgmtNetwork(cfg)
+			if err := checkVIP(cfg.VIP, mgmt); err != nil {
+				return err
+			}
+		}
 	case modeJoin:
 		if cfg.ServerURL == "" {
 			return errors.New(ErrMsgModeJoinServerURLNotSpecified)
 		}
+		if cfg.VIP != "" {
+			return errors.New(ErrMsgModeJoinContainsVIP)
+		}
 	default:
 		return prettyError(ErrMsgModeUnknown, mode)
 	}
@@ -196,9 +579,219 @@ func commonCheck(cfg *config.HarvesterConfig) error {
 	if len(cfg.SSHAuthorizedKeys) == 0 && cfg.Password == "" {
 		return errors.New(ErrMsgNoCredentials)
 	}
+
+	if err := checkPartitions(cfg.Install.Partitions); err != nil {
+		return err
+	}
+
+	if err := checkDeviceSelectors(cfg.Install); err != nil {
+		return err
+	}
+
+	if cfg.Install.MirrorDevice != "" {
+		// the same selector picks different disks
+		if cfg.Install.MirrorDevice == cfg.Install.Device && !disk.IsSelector(cfg.Install.Device) {
+			return prettyError(ErrMsgMirrorIsDevice, cfg.Install.MirrorDevice)
+		}
+		if cfg.Install.NoFormat {
+			return errors.New(ErrMsgMirrorNoFormat)
+		}
+	}
+
+	if err := checkEncryption(cfg.Install); err != nil {
+		return err
+	}
+
+	if dataDisk := cfg.Install.DataDisk; dataDisk != "" && !disk.IsSelector(dataDisk) && (dataDisk == cfg.Install.Device || dataDisk == cfg.Install.MirrorDevice) {
+		return prettyError(ErrMsgDataDiskIsDevice, dataDisk)
+	}
+
+	if err := checkProxy(cfg.Proxy); err != nil {
+		return err
+	}
+
+	if err := checkClusterNetworks(cfg, nil); err != nil {
+		return err
+	}
+
+	return checkNTPServers(cfg.NTPServers)
+}
+
+// checkClusterNetworks checks the cluster and service CIDRs don't overlap each
+// other or the networks of the node, that are the subnets of the static
+// networks, the routes and the subnets of the links, and don't contain the
+// gateways, DNS servers and VIP
+func checkClusterNetworks(cfg *config.HarvesterConfig, linkSubnets []*net.IPNet) error {
+	var cidrs []*net.IPNet
+	for _, cidr := range []string{getClusterCIDR(cfg), getServiceCIDR(cfg)} {
+		ip, subnet, err := net.ParseCIDR(cidr)
+		if err != nil || ip.To4() == nil {
+			return prettyError(ErrMsgCIDRInvalid, cidr)
+		}
+		cidrs = append(cidrs, subnet)
+	}
+	if ones, _ := cidrs[1].Mask.Size(); ones > maxServiceCIDRPrefix {
+		return prettyError(ErrMsgServiceCIDRTooSmall, cidrs[1].String())
+	}
+	if cfg.ClusterDomain != "" && checkDomain(cfg.ClusterDomain) != nil {
+		return prettyError(ErrMsgClusterDomainInvalid, cfg.ClusterDomain)
+	}
+	if overlaps(cidrs[0], cidrs[1]) {
+		return prettyError(ErrMsgCIDROverlap, fmt.Sprintf("%s and %s", cidrs[0], cidrs[1]))
+	}
+
+	subnets := append([]*net.IPNet{}, linkSubnets...)
+	addrs := append([]string{cfg.VIP}, cfg.OS.DNSNameservers...)
+	for _, n := range cfg.Install.Networks {
+		if n.Method == networkMethodStatic {
+			ip := net.ParseIP(n.IP).To4()
+			mask := net.ParseIP(n.SubnetMask).To4()
+			if ip != nil && mask != nil {
+				subnets = append(subnets, &net.IPNet{IP: ip.Mask(net.IPMask(mask)), Mask: net.IPMask(mask)})
+			}
+		}
+		addrs = append(addrs, n.Gateway)
+		addrs = append(addrs, n.DNSNameservers...)
+		for _, route := range n.Routes {
+			// a default route overlaps everything, only its gateway is checked
+			if _, dst, err := net.ParseCIDR(route.Destination); err == nil && !isDefaultRoute(dst) {
+				subnets = append(subnets, dst)
+			}
+			addrs = append(addrs, route.Gateway)
+		}
+	}
+	for _, cidr := range cidrs {
+		for _, subnet := range subnets {
+			if overlaps(cidr, subnet) {
+				return prettyError(ErrMsgCIDROverlap, fmt.Sprintf("%s and %s of the node", cidr, subnet))
+			}
+		}
+		for _, addr := range addrs {
+			if ip := net.ParseIP(addr); ip != nil && cidr.Contains(ip) {
+				return prettyError(ErrMsgCIDROverlap, fmt.Sprintf("%s contains %s", cidr, addr))
+			}
+		}
+	}
+	return nil
+}
+
+func isDefaultRoute(dst *net.IPNet) bool {
+	ones, _ := dst.Mask.Size()
+	return ones == 0
+}
+
+func overlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// getLinkSubnets returns the subnets of the addresses of the management link
+func getLinkSubnets(cfg *config.HarvesterConfig) []*net.IPNet {
+	iface, err := net.InterfaceByName(getMgmtLinkName(cfg))
+	if err != nil {
+		return nil
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+	var subnets []*net.IPNet
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() {
+			subnets = append(subnets, &net.IPNet{IP: ipNet.IP.Mask(ipNet.Mask), Mask: ipNet.Mask})
+		}
+	}
+	return subnets
+}
+
+// checkProxy checks the proxy URLs, which are not shown in the errors as they
+// may contain passwords
+func checkProxy(proxy config.Proxy) error {
+	for field, value := range map[string]string{"http": proxy.HTTP, "https": proxy.HTTPS} {
+		if value == "" {
+			continue
+		}
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			return prettyError(ErrMsgProxyInvalid, "proxy."+field)
+		}
+	}
+	for _, host := range proxy.NoProxy {
+		if host == "" || strings.ContainsAny(host, " \t") {
+			return prettyError(ErrMsgNoProxyInvalid, host)
+		}
+		if strings.Contains(host, "/") {
+			if _, _, err := net.ParseCIDR(host); err != nil {
+				return prettyError(ErrMsgNoProxyInvalid, host)
+			}
+		}
+	}
 	return nil
 }
 
+func checkNTPServers(servers []string) error {
+	for _, server := range servers {
+		if checkIP(server) != nil && checkDomain(server) != nil {
+			return prettyError(ErrMsgNTPServerInvalid, server)
+		}
+	}
+	return nil
+}
+
+// checkVIP checks the VIP is an IPv4 address in the subnet of the management
+// network if its address is static
+func checkVIP(vip string, mgmt config.Network) error {
+	ip := net.ParseIP(vip)
+	if ip == nil || ip.To4() == nil {
+		return prettyError(ErrMsgVIPInvalid, vip)
+	}
+	mgmtIP := net.ParseIP(mgmt.IP).To4()
+	mask := net.ParseIP(mgmt.SubnetMask).To4()
+	if mgmt.Method != networkMethodStatic || mgmtIP == nil || mask == nil {
+		// the network is checked on its own
+		return nil
+	}
+	if ip.Equal(mgmtIP) {
+		return prettyError(ErrMsgVIPInUse, vip)
+	}
+	subnet := &net.IPNet{IP: mgmtIP.Mask(net.IPMask(mask)), Mask: net.IPMask(mask)}
+	if !subnet.Contains(ip) {
+		return prettyError(ErrMsgVIPNotInSubnet, vip)
+	}
+	return nil
+}
+
+// checkVIPAvailable checks the VIP is in a subnet of the management link and
+// no host answers it
+func checkVIPAvailable(vip string, mgmt config.Network) error {
+	ip := net.ParseIP(vip)
+	if mgmt.Method != networkMethodStatic {
+		iface, err := net.InterfaceByName(mgmt.LinkName())
+		if err != nil {
+			return err
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return err
+		}
+		if !inSubnets(ip, addrs) {
+			return prettyError(ErrMsgVIPNotInSubnet, vip)
+		}
+	}
+	if err := network.Ping(ip, vipPingTimeout); err == nil {
+		return prettyError(ErrMsgVIPInUse, vip)
+	}
+	return nil
+}
+
+func inSubnets(ip net.IP, addrs []net.Addr) bool {
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 func validateConfig(v ValidatorInterface, cfg *config.HarvesterConfig) error {
 	logrus.Debug("Validating config: ", cfg)
 	if err := commonCheck(cfg); err != nil {
@@ -206,3 +799,8 @@ func validateConfig(v ValidatorInterface, cfg *config.HarvesterConfig) error {
 	}
 	return v.Validate(cfg)
 }
+
+// ValidateConfigOffline validates a config without touching the local hardware
+func ValidateConfigOffline(cfg *config.HarvesterConfig) error {
+	return validateConfig(OfflineValidator{}, cfg)
+}
@@ -0,0 +1,148 @@
+package console
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+
+	k3os "github.com/rancher/k3os/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// vipNodeLabel marks the node that created the cluster with the VIP, so every
+	// node can find the VIP with the node permissions of its kubelet
+	vipNodeLabel = "harvesterhci.io/managementVIP"
+	// kube-vip is applied by k3s next to the manifests of the ISO
+	vipManifestFile = "/var/lib/rancher/k3s/server/manifests/kube-vip.yaml"
+	// kube-vip announces the VIP on the link of the default route of each node
+	// when no vip_interface is set, the node that takes over the VIP may name
+	// its management link differently than the one that created the cluster
+	kubeVIPImage = "ghcr.io/kube-vip/kube-vip:v0.4.1"
+	// a VIP that doesn't answer within the timeout is taken as unused
+	vipPingTimeout = time.Second
+)
+
+var vipManifestTemplate = template.Must(template.New("kube-vip").Parse(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: kube-vip
+  namespace: kube-system
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: system:kube-vip-role
+rules:
+- apiGroups: [""]
+  resources: ["services", "services/status", "nodes", "endpoints"]
+  verbs: ["list", "get", "watch", "update"]
+- apiGroups: ["coordination.k8s.io"]
+  resources: ["leases"]
+  verbs: ["list", "get", "watch", "update", "create"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: system:kube-vip-binding
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: system:kube-vip-role
+subjects:
+- kind: ServiceAccount
+  name: kube-vip
+  namespace: kube-system
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: kube-vip
+  namespace: kube-system
+  labels:
+    app.kubernetes.io/name: kube-vip
+spec:
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: kube-vip
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: kube-vip
+    spec:
+      nodeSelector:
+        node-role.kubernetes.io/master: "true"
+      tolerations:
+      - operator: Exists
+      hostNetwork: true
+      serviceAccountName: kube-vip
+      containers:
+      - name: kube-vip
+        image: {{ .Image }}
+        imagePullPolicy: IfNotPresent
+        args:
+        - manager
+        env:
+        - name: vip_arp
+          value: "true"
+        - name: port
+          value: "6443"
+        - name: vip_cidr
+          value: "32"
+        - name: cp_enable
+          value: "true"
+        - name: cp_namespace
+          value: kube-system
+        - name: vip_leaderelection
+          value: "true"
+        - name: vip_leaseduration
+          value: "5"
+        - name: vip_renewdeadline
+          value: "3"
+        - name: vip_retryperiod
+          value: "1"
+        - name: address
+          value: {{ .VIP }}
+        securityContext:
+          capabilities:
+            add:
+            - NET_ADMIN
+            - NET_RAW
+            - SYS_TIME
+`))
+
+// getVIPManifestFile returns the kube-vip manifest that announces the VIP on
+// the management link of the master nodes
+func getVIPManifestFile(vip string) (*k3os.File, error) {
+	var b bytes.Buffer
+	err := vipManifestTemplate.Execute(&b, map[string]string{
+		"Image": kubeVIPImage,
+		"VIP":   vip,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &k3os.File{
+		Content:            b.String(),
+		Owner:              "root",
+		Path:               vipManifestFile,
+		RawFilePermissions: "0600",
+	}, nil
+}
+
+// getVIP returns the VIP of the cluster, or an empty string if the cluster
+// has none
+func getVIP() string {
+	cmd := exec.Command("/bin/sh", "-c", `kubectl get no -l '`+vipNodeLabel+`' \
+-o jsonpath='{range .items[*]}{@.metadata.labels.harvesterhci\.io/managementVIP}{"\n"}{end}' 2>/dev/null | head -n 1`)
+	cmd.Env = os.Environ()
+	output, err := cmd.Output()
+	if err != nil {
+		logrus.Error(err, string(output))
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
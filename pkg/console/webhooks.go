@@ -8,6 +8,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -16,6 +17,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/harvester/harvester-installer/pkg/config"
+	"github.com/harvester/harvester-installer/pkg/network"
 	"github.com/harvester/harvester-installer/pkg/util"
 )
 
@@ -222,29 +224,68 @@ func (hooks RendererWebhooks) Handle(event string) {
 
 func getIPAddr(iface *net.Interface, v6 bool) string {
 	addrs, err := iface.Addrs()
-	if err == nil {
-		for _, addr := range addrs {
-			var ip net.IP
-			switch t := addr.(type) {
-			case *net.IPNet:
-				ip = t.IP
-			case *net.IPAddr:
-				ip = t.IP
-			}
+	if err != nil {
+		return ""
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		switch t := addr.(type) {
+		case *net.IPNet:
+			ips = append(ips, t.IP)
+		case *net.IPAddr:
+			ips = append(ips, t.IP)
+		}
+	}
+	return selectIPAddr(ips, v6)
+}
 
-			// looks like IPv4 address is represented as IPv6 by default
-			if ip != nil && len(ip) == net.IPv6len {
-				r := ip.To4()
-				if r != nil && !v6 {
-					return r.String()
-				}
-				if r == nil && v6 {
-					return ip.String()
-				}
+// selectIPAddr picks the first IPv4 or IPv6 address, preferring IPv6 global
+// addresses over link-local ones
+func selectIPAddr(ips []net.IP, v6 bool) string {
+	var linkLocal string
+	for _, ip := range ips {
+		// looks like IPv4 address is represented as IPv6 by default
+		if ip == nil || len(ip) != net.IPv6len {
+			continue
+		}
+		r := ip.To4()
+		if r != nil && !v6 {
+			return r.String()
+		}
+		if r == nil && v6 {
+			if !ip.IsLinkLocalUnicast() {
+				return ip.String()
+			}
+			if linkLocal == "" {
+				linkLocal = ip.String()
 			}
 		}
 	}
-	return ""
+	return linkLocal
+}
+
+// notifyInstallFailed fires the FAILED webhooks of cfg for an error that stops
+// the installation before it starts. The error is available to the webhook
+// templates as {{ .Error }}.
+func notifyInstallFailed(cfg *config.HarvesterConfig, err error) {
+	context := getWebhookContext(cfg)
+	context["Error"] = err.Error()
+	webhooks, e := PrepareWebhooks(cfg.Webhooks, context)
+	if e != nil {
+		logrus.Errorf("fail to prepare webhooks: %s", e)
+		return
+	}
+	webhooks.Handle(EventInstallFailed)
+}
+
+// setDiagnosticsContext makes the network diagnostics available to the webhook
+// templates as {{ .Diagnostics }} and {{ .DiagnosticsPassed }}
+func setDiagnosticsContext(context map[string]string, diagnostics network.Diagnostics) {
+	if diagnostics == nil {
+		return
+	}
+	context["Diagnostics"] = diagnostics.Summary()
+	context["DiagnosticsPassed"] = strconv.FormatBool(diagnostics.Passed())
 }
 
 func getWebhookContext(cfg *config.HarvesterConfig) map[string]string {
@@ -253,8 +294,13 @@ func getWebhookContext(cfg *config.HarvesterConfig) map[string]string {
 		"Hostname": cfg.Hostname,
 	}
 
+	// disks, as resolved from stable identifiers and selectors
+	m["Device"] = cfg.Install.Device
+	m["MirrorDevice"] = cfg.Install.MirrorDevice
+	m["DataDisk"] = cfg.Install.DataDisk
+
 	// MAC address and IP addresses
-	if iface, err := net.InterfaceByName(cfg.Install.MgmtInterface); err == nil {
+	if iface, err := net.InterfaceByName(getMgmtLinkName(cfg)); err == nil {
 		m["MACAddr"] = iface.HardwareAddr.String()
 		m["IPAddrV4"] = getIPAddr(iface, false)
 		m["IPAddrV6"] = getIPAddr(iface, true)
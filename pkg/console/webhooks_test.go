@@ -2,6 +2,7 @@ package console
 
 import (
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -9,6 +10,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/harvester/harvester-installer/pkg/config"
+	"github.com/harvester/harvester-installer/pkg/network"
 )
 
 func TestParseWebhook(t *testing.T) {
@@ -181,3 +183,30 @@ func TestParsedWebhook_Send(t *testing.T) {
 		})
 	}
 }
+
+func TestSelectIPAddr(t *testing.T) {
+	ips := []net.IP{
+		net.ParseIP("fe80::1"),
+		net.ParseIP("10.0.0.10"),
+		net.ParseIP("2001:db8::10"),
+	}
+	assert.Equal(t, "10.0.0.10", selectIPAddr(ips, false))
+	assert.Equal(t, "2001:db8::10", selectIPAddr(ips, true))
+	assert.Equal(t, "fe80::1", selectIPAddr(ips[:1], true))
+	assert.Equal(t, "", selectIPAddr(ips[:1], false))
+}
+
+func TestSetDiagnosticsContext(t *testing.T) {
+	context := map[string]string{}
+	setDiagnosticsContext(context, nil)
+	assert.Empty(t, context)
+
+	setDiagnosticsContext(context, network.Diagnostics{
+		{Check: network.CheckGateway, Target: "10.0.0.1", Status: network.StatusPass},
+		{Check: network.CheckNTP, Target: "ntp.example.com", Status: network.StatusFail, Detail: "no reply"},
+	})
+	assert.Equal(t, map[string]string{
+		"Diagnostics":       "gateway 10.0.0.1 PASS; NTP ntp.example.com FAIL: no reply",
+		"DiagnosticsPassed": "false",
+	}, context)
+}
@@ -0,0 +1,102 @@
+package disk
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DataLabel is the filesystem label of the partition of the data disk
+	DataLabel = "HARVESTER_DATA"
+	// DataMountPoint is the default data path of Longhorn, where VM images and
+	// volumes are stored
+	DataMountPoint = "/var/lib/longhorn"
+)
+
+// DataDisk mounts the data partition, which the installer creates on the data
+// disk
+type DataDisk struct {
+	// Run runs a command and returns its combined output
+	Run func(name string, args ...string) ([]byte, error)
+	// FindLabel returns the device of a filesystem label, empty if not found
+	FindLabel func(label string) (string, error)
+	Mounts    string
+}
+
+func NewDataDisk() *DataDisk {
+	return &DataDisk{
+		Run: func(name string, args ...string) ([]byte, error) {
+			return exec.Command(name, args...).CombinedOutput()
+		},
+		FindLabel: FindLabel,
+		Mounts:    "/proc/mounts",
+	}
+}
+
+// MountData mounts the partition labeled HARVESTER_DATA at the mount point.
+// The partition is only found by its label, device names may change between
+// boots, and it is never formatted on boot.
+func MountData(mountPoint string) error {
+	return NewDataDisk().Mount(mountPoint)
+}
+
+func (d *DataDisk) Mount(mountPoint string) error {
+	mounted, err := d.mounted(mountPoint)
+	if err != nil {
+		return err
+	}
+	if mounted {
+		return nil
+	}
+	partition, err := d.FindLabel(DataLabel)
+	if err != nil {
+		return err
+	}
+	if partition == "" {
+		return fmt.Errorf("no partition is labeled %s", DataLabel)
+	}
+	if err := os.MkdirAll(mountPoint, 0755); err != nil {
+		return err
+	}
+	logrus.Infof("Mounting %s at %s", partition, mountPoint)
+	if output, err := d.Run("mount", partition, mountPoint); err != nil {
+		return errors.Wrapf(err, "fail to mount %s: %s", partition, output)
+	}
+	return nil
+}
+
+func (d *DataDisk) mounted(mountPoint string) (bool, error) {
+	b, err := ioutil.ReadFile(d.Mounts)
+	if err != nil {
+		return false, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 && fields[1] == mountPoint {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FindLabel returns the device of a filesystem label, empty if not found
+func FindLabel(label string) (string, error) {
+	output, err := exec.Command("blkid", "-L", label).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 2 {
+			// not found
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
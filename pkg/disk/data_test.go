@@ -0,0 +1,75 @@
+package disk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDataDisk records the commands run on the data disk
+func fakeDataDisk(t *testing.T, mounts string, label string) (*DataDisk, *[]string) {
+	dir, err := ioutil.TempDir("", "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	mountsFile := filepath.Join(dir, "mounts")
+	if err := ioutil.WriteFile(mountsFile, []byte(mounts), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var commands []string
+	return &DataDisk{
+		Run: func(name string, args ...string) ([]byte, error) {
+			commands = append(commands, strings.Join(append([]string{name}, args...), " "))
+			return nil, nil
+		},
+		FindLabel: func(string) (string, error) { return label, nil },
+		Mounts:    mountsFile,
+	}, &commands
+}
+
+func TestDataDisk_Mount(t *testing.T) {
+	mountPoint := filepath.Join(os.TempDir(), "harvester-data-test")
+	defer os.RemoveAll(mountPoint)
+
+	testCases := []struct {
+		name     string
+		mounts   string
+		label    string
+		commands []string
+		err      string
+	}{
+		{
+			name:     "labeled",
+			label:    "/dev/sdb1",
+			commands: []string{"mount /dev/sdb1 " + mountPoint},
+		},
+		{
+			name:   "mounted",
+			mounts: "/dev/sdb1 " + mountPoint + " ext4 rw,relatime 0 0\n",
+			label:  "/dev/sdb1",
+		},
+		{
+			// the data disk is never formatted on boot
+			name: "no data partition",
+			err:  "no partition is labeled HARVESTER_DATA",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, commands := fakeDataDisk(t, tc.mounts, tc.label)
+			err := d.Mount(mountPoint)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, tc.commands, *commands)
+		})
+	}
+}
@@ -0,0 +1,387 @@
+package disk
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// StateLabel is the filesystem label of the partition Harvester is installed on
+	StateLabel = "HARVESTER_STATE"
+	// BootLabel is the filesystem label of the EFI partition of Harvester
+	BootLabel = "K3OS_GRUB"
+	// EncryptedStateLabel is the LUKS label of the encrypted state partition
+	EncryptedStateLabel = StateLabel + "_CRYPT"
+	// LUKSType is the type of LUKS encrypted partitions
+	LUKSType = "crypto_LUKS"
+
+	TransportNVMe   = "nvme"
+	TransportSATA   = "sata"
+	TransportSAS    = "sas"
+	TransportUSB    = "usb"
+	TransportVirtIO = "virtio"
+	TransportSCSI   = "scsi"
+
+	sectorSize = 512
+	// SCSI peripheral device type of CD-ROMs
+	scsiTypeROM = "5"
+)
+
+// virtual and removable media devices that are never installation targets
+var ignoredPrefixes = []string{"loop", "ram", "sr", "fd", "zram", "dm-", "md", "nbd"}
+
+// Disk is a block device that Harvester can be installed on
+type Disk struct {
+	// Name is the kernel name, e.g. sda
+	Name string
+	// Path is the device node, e.g. /dev/sda
+	Path string
+	// Size in bytes
+	Size       uint64
+	Model      string
+	Serial     string
+	WWN        string
+	Transport  string
+	Rotational bool
+	Removable  bool
+	// PartitionTable is gpt or dos, empty if there is none
+	PartitionTable string
+	// FSType is the filesystem on the whole disk, if any
+	FSType     string
+	Partitions []Partition
+}
+
+type Partition struct {
+	Name   string
+	Path   string
+	Size   uint64
+	FSType string
+	Label  string
+}
+
+// HasHarvester reports whether a partition of the disk holds a Harvester
+// installation, or is a member of its mirrored state partition
+func (d Disk) HasHarvester() bool {
+	for _, p := range d.Partitions {
+		if p.Label == StateLabel || p.Label == EncryptedStateLabel {
+			return true
+		}
+		// the label of a member is the name of its array, prefixed by the
+		// host it was created on
+		if p.FSType == RAIDMemberType && (p.Label == StateArrayName || strings.HasSuffix(p.Label, ":"+StateArrayName)) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasData reports whether a partition of the disk is the data partition of
+// Harvester, which is mounted as it is
+func (d Disk) HasData() bool {
+	for _, p := range d.Partitions {
+		if p.Label == DataLabel {
+			return true
+		}
+	}
+	return false
+}
+
+// Encrypted reports whether a partition of the disk is encrypted with LUKS
+func (d Disk) Encrypted() bool {
+	for _, p := range d.Partitions {
+		if p.FSType == LUKSType {
+			return true
+		}
+	}
+	return false
+}
+
+// InUse reports whether the disk has a partition table, partitions or a
+// filesystem
+func (d Disk) InUse() bool {
+	return d.PartitionTable != "" || d.FSType != "" || len(d.Partitions) > 0
+}
+
+// Contents describes what is on the disk, e.g. "gpt partition table,
+// 2 partitions (vfat K3OS_GRUB, ext4 HARVESTER_STATE)", empty if it is empty
+func (d Disk) Contents() string {
+	var contents []string
+	if d.HasHarvester() {
+		contents = append(contents, "Harvester installation")
+	}
+	if d.PartitionTable != "" {
+		contents = append(contents, fmt.Sprintf("%s partition table", d.PartitionTable))
+	}
+	if d.FSType != "" {
+		contents = append(contents, fmt.Sprintf("%s filesystem", d.FSType))
+	}
+	if n := len(d.Partitions); n > 0 {
+		var partitions []string
+		for _, p := range d.Partitions {
+			partitions = append(partitions, strings.TrimSpace(firstOf(p.FSType, "unknown")+" "+p.Label))
+		}
+		noun := "partitions"
+		if n == 1 {
+			noun = "partition"
+		}
+		contents = append(contents, fmt.Sprintf("%d %s (%s)", n, noun, strings.Join(partitions, ", ")))
+	}
+	return strings.Join(contents, ", ")
+}
+
+// Description describes the disk in one line, e.g.
+// "100 GiB, SATA SSD, Samsung SSD 860 (S3Z9NB0K123456)"
+func (d Disk) Description() string {
+	kind := "HDD"
+	if !d.Rotational {
+		kind = "SSD"
+	}
+	parts := []string{FormatSize(d.Size), strings.TrimSpace(strings.ToUpper(d.Transport) + " " + kind)}
+	if d.Model != "" {
+		model := d.Model
+		if d.Serial != "" {
+			model += fmt.Sprintf(" (%s)", d.Serial)
+		}
+		parts = append(parts, model)
+	}
+	if d.HasHarvester() {
+		parts = append(parts, "Harvester installed")
+	} else if n := len(d.Partitions); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d partitions", n))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// FormatSize formats a size in bytes with binary units
+func FormatSize(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// Inventory lists the disks from sysfs and the udev database
+type Inventory struct {
+	SysBlockPath string
+	UdevDataPath string
+	DevPath      string
+	// Probe returns the udev style properties of a device, e.g. ID_FS_LABEL,
+	// when the udev database doesn't have them
+	Probe func(path string) map[string]string
+}
+
+func NewInventory() *Inventory {
+	return &Inventory{
+		SysBlockPath: "/sys/block",
+		UdevDataPath: "/run/udev/data",
+		DevPath:      "/dev",
+		Probe:        blkid,
+	}
+}
+
+// List returns the disks of the machine sorted by name
+func List() ([]Disk, error) {
+	return NewInventory().List()
+}
+
+// Find returns the disk of a device path
+func Find(path string) (*Disk, error) {
+	disks, err := List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range disks {
+		if disks[i].Path == path {
+			return &disks[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (inv *Inventory) List() ([]Disk, error) {
+	entries, err := ioutil.ReadDir(inv.SysBlockPath)
+	if err != nil {
+		return nil, err
+	}
+	var disks []Disk
+	for _, entry := range entries {
+		name := entry.Name()
+		if isIgnored(name) {
+			continue
+		}
+		dir := filepath.Join(inv.SysBlockPath, name)
+		if readString(filepath.Join(dir, "device", "type")) == scsiTypeROM {
+			continue
+		}
+		size := readUint(filepath.Join(dir, "size")) * sectorSize
+		if size == 0 {
+			continue
+		}
+		disk := Disk{
+			Name:       name,
+			Path:       filepath.Join(inv.DevPath, name),
+			Size:       size,
+			Rotational: readString(filepath.Join(dir, "queue", "rotational")) == "1",
+			Removable:  readString(filepath.Join(dir, "removable")) == "1",
+		}
+		props := inv.properties(dir, disk.Path)
+		disk.Model = firstOf(strings.Replace(props["ID_MODEL"], "_", " ", -1), readString(filepath.Join(dir, "device", "model")))
+		disk.Serial = firstOf(props["ID_SERIAL_SHORT"], readString(filepath.Join(dir, "device", "serial")))
+		disk.WWN = firstOf(props["ID_WWN"], readString(filepath.Join(dir, "wwid")), readString(filepath.Join(dir, "device", "wwid")))
+		disk.PartitionTable = props["ID_PART_TABLE_TYPE"]
+		disk.FSType = props["ID_FS_TYPE"]
+		disk.Transport = inv.transport(dir, name, props)
+		disk.Partitions = inv.partitions(dir)
+		disks = append(disks, disk)
+	}
+	sort.Slice(disks, func(i, j int) bool {
+		return disks[i].Name < disks[j].Name
+	})
+	return disks, nil
+}
+
+func (inv *Inventory) partitions(diskDir string) []Partition {
+	entries, err := ioutil.ReadDir(diskDir)
+	if err != nil {
+		return nil
+	}
+	var partitions []Partition
+	for _, entry := range entries {
+		dir := filepath.Join(diskDir, entry.Name())
+		if _, err := os.Stat(filepath.Join(dir, "partition")); err != nil {
+			continue
+		}
+		path := filepath.Join(inv.DevPath, entry.Name())
+		props := inv.properties(dir, path)
+		partitions = append(partitions, Partition{
+			Name:   entry.Name(),
+			Path:   path,
+			Size:   readUint(filepath.Join(dir, "size")) * sectorSize,
+			FSType: props["ID_FS_TYPE"],
+			Label:  props["ID_FS_LABEL"],
+		})
+	}
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].Name < partitions[j].Name
+	})
+	return partitions
+}
+
+// properties reads the udev database entry of a device, which is named after
+// its major and minor numbers
+func (inv *Inventory) properties(dir, path string) map[string]string {
+	props := map[string]string{}
+	if dev := readString(filepath.Join(dir, "dev")); dev != "" {
+		if b, err := ioutil.ReadFile(filepath.Join(inv.UdevDataPath, "b"+dev)); err == nil {
+			scanner := bufio.NewScanner(bytes.NewReader(b))
+			for scanner.Scan() {
+				line := scanner.Text()
+				if !strings.HasPrefix(line, "E:") {
+					continue
+				}
+				if kv := strings.SplitN(line[2:], "=", 2); len(kv) == 2 {
+					props[kv[0]] = kv[1]
+				}
+			}
+		}
+	}
+	if _, ok := props["ID_FS_TYPE"]; !ok && inv.Probe != nil {
+		for k, v := range inv.Probe(path) {
+			if _, ok := props[k]; !ok {
+				props[k] = v
+			}
+		}
+	}
+	return props
+}
+
+func (inv *Inventory) transport(dir, name string, props map[string]string) string {
+	if strings.HasPrefix(name, "nvme") {
+		return TransportNVMe
+	}
+	if strings.HasPrefix(name, "vd") {
+		return TransportVirtIO
+	}
+	devicePath, _ := filepath.EvalSymlinks(filepath.Join(dir, "device"))
+	switch {
+	case props["ID_BUS"] == "usb" || strings.Contains(devicePath, "/usb"):
+		return TransportUSB
+	case props["ID_BUS"] == "ata" || strings.Contains(devicePath, "/ata"):
+		return TransportSATA
+	case strings.Contains(props["ID_PATH"], "-sas-") || strings.Contains(devicePath, "/sas_") || strings.Contains(devicePath, "/end_device-"):
+		return TransportSAS
+	case strings.Contains(devicePath, "/virtio"):
+		return TransportVirtIO
+	}
+	return TransportSCSI
+}
+
+// blkid probes the filesystem and partition table of a device, in the names
+// of the udev properties
+func blkid(path string) map[string]string {
+	output, err := exec.Command("blkid", "-p", "-o", "export", path).Output()
+	if err != nil {
+		return nil
+	}
+	names := map[string]string{
+		"TYPE":   "ID_FS_TYPE",
+		"LABEL":  "ID_FS_LABEL",
+		"PTTYPE": "ID_PART_TABLE_TYPE",
+	}
+	props := map[string]string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if name, ok := names[kv[0]]; ok {
+			props[name] = kv[1]
+		}
+	}
+	return props
+}
+
+func isIgnored(name string) bool {
+	for _, prefix := range ignoredPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func readString(path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func readUint(path string) uint64 {
+	n, _ := strconv.ParseUint(readString(path), 10, 64)
+	return n
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+package disk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeInventory builds a sysfs and udev database with the files, relative to
+// the root of the inventory
+func fakeInventory(t *testing.T, files map[string]string) *Inventory {
+	dir, err := ioutil.TempDir("", "disk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &Inventory{
+		SysBlockPath: filepath.Join(dir, "sys/block"),
+		UdevDataPath: filepath.Join(dir, "run/udev/data"),
+		DevPath:      "/dev",
+	}
+}
+
+func TestInventory_List(t *testing.T) {
+	inv := fakeInventory(t, map[string]string{
+		"sys/block/sda/size":             "209715200",
+		"sys/block/sda/dev":              "8:0",
+		"sys/block/sda/queue/rotational": "0",
+		"sys/block/sda/removable":        "0",
+		"sys/block/sda/device/type":      "0",
+		"sys/block/sda/sda1/partition":   "1",
+		"sys/block/sda/sda1/size":        "97656",
+		"sys/block/sda/sda1/dev":         "8:1",
+		"sys/block/sda/sda2/partition":   "2",
+		"sys/block/sda/sda2/size":        "39905280",
+		"sys/block/sda/sda2/dev":         "8:2",
+		"run/udev/data/b8:0":             "E:ID_BUS=ata\nE:ID_MODEL=Samsung_SSD_860\nE:ID_SERIAL_SHORT=S3Z9NB0K123456\nE:ID_WWN=0x5002538e40a1b2c3\nE:ID_PART_TABLE_TYPE=gpt",
+		"run/udev/data/b8:1":             "E:ID_FS_TYPE=vfat\nE:ID_FS_LABEL=K3OS_GRUB",
+		"run/udev/data/b8:2":             "E:ID_FS_TYPE=ext4\nE:ID_FS_LABEL=HARVESTER_STATE",
+
+		"sys/block/nvme0n1/size":             "1953525168",
+		"sys/block/nvme0n1/dev":              "259:0",
+		"sys/block/nvme0n1/wwid":             "eui.0025388b91b2c3d4",
+		"sys/block/nvme0n1/queue/rotational": "0",
+		"sys/block/nvme0n1/device/model":     "SAMSUNG MZVLB1T0",
+		"sys/block/nvme0n1/device/serial":    "S4EMNX0R123456",
+
+		"sys/block/sdb/size":             "0",
+		"sys/block/sdc/size":             "2097152",
+		"sys/block/sdc/device/type":      "5",
+		"sys/block/loop0/size":           "2097152",
+		"sys/block/sr0/size":             "2097152",
+		"sys/block/vda/size":             "104857600",
+		"sys/block/vda/queue/rotational": "1",
+	})
+
+	disks, err := inv.List()
+	assert.Nil(t, err)
+	assert.Equal(t, []Disk{
+		{
+			Name:       "nvme0n1",
+			Path:       "/dev/nvme0n1",
+			Size:       1953525168 * sectorSize,
+			Model:      "SAMSUNG MZVLB1T0",
+			Serial:     "S4EMNX0R123456",
+			WWN:        "eui.0025388b91b2c3d4",
+			Transport:  TransportNVMe,
+			Rotational: false,
+		},
+		{
+			Name:           "sda",
+			Path:           "/dev/sda",
+			Size:           209715200 * sectorSize,
+			Model:          "Samsung SSD 860",
+			Serial:         "S3Z9NB0K123456",
+			WWN:            "0x5002538e40a1b2c3",
+			Transport:      TransportSATA,
+			PartitionTable: "gpt",
+			Partitions: []Partition{
+				{Name: "sda1", Path: "/dev/sda1", Size: 97656 * sectorSize, FSType: "vfat", Label: BootLabel},
+				{Name: "sda2", Path: "/dev/sda2", Size: 39905280 * sectorSize, FSType: "ext4", Label: StateLabel},
+			},
+		},
+		{
+			Name:       "vda",
+			Path:       "/dev/vda",
+			Size:       104857600 * sectorSize,
+			Transport:  TransportVirtIO,
+			Rotational: true,
+		},
+	}, disks)
+
+	assert.False(t, disks[0].HasHarvester())
+	assert.False(t, disks[0].InUse())
+	assert.True(t, disks[1].HasHarvester())
+	assert.True(t, disks[1].InUse())
+}
+
+func TestDisk_Description(t *testing.T) {
+	d := Disk{
+		Size:      100 * 1024 * 1024 * 1024,
+		Model:     "Samsung SSD 860",
+		Serial:    "S3Z9NB0K123456",
+		Transport: TransportSATA,
+	}
+	assert.Equal(t, "100.0 GiB, SATA SSD, Samsung SSD 860 (S3Z9NB0K123456)", d.Description())
+
+	d.Partitions = []Partition{{Name: "sda1"}, {Name: "sda2"}}
+	assert.Equal(t, "100.0 GiB, SATA SSD, Samsung SSD 860 (S3Z9NB0K123456), 2 partitions", d.Description())
+
+	d.Partitions[1].Label = StateLabel
+	assert.Equal(t, "100.0 GiB, SATA SSD, Samsung SSD 860 (S3Z9NB0K123456), Harvester installed", d.Description())
+}
+
+func TestDisk_Contents(t *testing.T) {
+	d := Disk{}
+	assert.Equal(t, "", d.Contents())
+
+	d.FSType = "xfs"
+	assert.Equal(t, "xfs filesystem", d.Contents())
+
+	d = Disk{
+		PartitionTable: "gpt",
+		Partitions:     []Partition{{FSType: "vfat", Label: BootLabel}, {FSType: "ext4", Label: StateLabel}},
+	}
+	assert.Equal(t, "Harvester installation, gpt partition table, 2 partitions (vfat K3OS_GRUB, ext4 HARVESTER_STATE)", d.Contents())
+
+	d = Disk{PartitionTable: "dos", Partitions: []Partition{{}}}
+	assert.Equal(t, "dos partition table, 1 partition (unknown)", d.Contents())
+}
+
+func TestDisk_Encrypted(t *testing.T) {
+	d := Disk{Partitions: []Partition{{FSType: "vfat", Label: BootLabel}, {FSType: "ext4", Label: "HARVESTER_KERNEL"}}}
+	assert.False(t, d.Encrypted())
+	assert.False(t, d.HasHarvester())
+
+	d.Partitions = append(d.Partitions, Partition{FSType: LUKSType, Label: EncryptedStateLabel})
+	assert.True(t, d.Encrypted())
+	assert.True(t, d.HasHarvester())
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "512 B", FormatSize(512))
+	assert.Equal(t, "1.5 KiB", FormatSize(1536))
+	assert.Equal(t, "20.0 GiB", FormatSize(20*1024*1024*1024))
+	assert.Equal(t, "1.8 TiB", FormatSize(2000398934016))
+}
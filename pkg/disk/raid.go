@@ -0,0 +1,81 @@
+package disk
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	// StateArrayName is the name of the RAID1 array of a mirrored
+	// HARVESTER_STATE partition
+	StateArrayName = "harvester-state"
+	// RAIDMemberType is the filesystem type of the members of a RAID array
+	RAIDMemberType = "linux_raid_member"
+
+	mdstatPath = "/proc/mdstat"
+)
+
+// the status of the members of an array, e.g. [2/1] [U_]
+var mdstatStatus = regexp.MustCompile(`\[\d+/\d+\] \[([U_]+)\]`)
+
+// Array is a software RAID array
+type Array struct {
+	// Name is the kernel name, e.g. md127
+	Name   string
+	Active bool
+	Level  string
+	// Members are the kernel names of the member devices
+	Members []string
+	// Status has a U for every member that is up and an underscore for every
+	// missing member, e.g. U_
+	Status string
+}
+
+// Degraded reports whether the array is inactive or misses members
+func (a Array) Degraded() bool {
+	return !a.Active || strings.Contains(a.Status, "_")
+}
+
+// Arrays returns the software RAID arrays of the machine
+func Arrays() ([]Array, error) {
+	b, err := ioutil.ReadFile(mdstatPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return parseMDStat(b), nil
+}
+
+// parseMDStat parses /proc/mdstat, where an array is described by a line like
+// "md127 : active raid1 sdb2[1] sda2[0]" followed by its status
+func parseMDStat(b []byte) []Array {
+	var arrays []Array
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if fields := strings.Fields(line); len(fields) > 2 && strings.HasPrefix(fields[0], "md") && fields[1] == ":" {
+			array := Array{
+				Name:   fields[0],
+				Active: fields[2] == "active",
+			}
+			for _, field := range fields[3:] {
+				if i := strings.Index(field, "["); i > 0 {
+					array.Members = append(array.Members, field[:i])
+				} else if array.Level == "" && array.Active && !strings.HasPrefix(field, "(") {
+					array.Level = field
+				}
+			}
+			arrays = append(arrays, array)
+			continue
+		}
+		if m := mdstatStatus.FindStringSubmatch(line); m != nil && len(arrays) > 0 {
+			arrays[len(arrays)-1].Status = m[1]
+		}
+	}
+	return arrays
+}
@@ -0,0 +1,40 @@
+package disk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMDStat(t *testing.T) {
+	mdstat := `Personalities : [raid1]
+md126 : active raid1 sdb3[1] sda3[0]
+      104320 blocks super 1.0 [2/2] [UU]
+
+md127 : active (auto-read-only) raid1 sda2[0] sdb2[1](F)
+      20955136 blocks super 1.0 [2/1] [U_]
+      bitmap: 1/1 pages [4KB], 65536KB chunk
+
+md125 : inactive sdc1[0](S)
+      1047552 blocks super 1.0
+
+unused devices: <none>
+`
+	arrays := parseMDStat([]byte(mdstat))
+	assert.Equal(t, []Array{
+		{Name: "md126", Active: true, Level: "raid1", Members: []string{"sdb3", "sda3"}, Status: "UU"},
+		{Name: "md127", Active: true, Level: "raid1", Members: []string{"sda2", "sdb2"}, Status: "U_"},
+		{Name: "md125", Members: []string{"sdc1"}},
+	}, arrays)
+	assert.False(t, arrays[0].Degraded())
+	assert.True(t, arrays[1].Degraded())
+	assert.True(t, arrays[2].Degraded())
+}
+
+func TestDisk_HasHarvesterMirrored(t *testing.T) {
+	d := Disk{Partitions: []Partition{{FSType: "vfat", Label: BootLabel}, {FSType: RAIDMemberType, Label: "any:" + StateArrayName}}}
+	assert.True(t, d.HasHarvester())
+
+	d.Partitions[1].Label = "any:data"
+	assert.False(t, d.HasHarvester())
+}
@@ -0,0 +1,254 @@
+package disk
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	PickFirst    = "first"
+	PickSmallest = "smallest"
+	PickLargest  = "largest"
+)
+
+// operators of selector terms, the two-character ones first
+var operators = []string{"!=", ">=", "<=", "=", ">", "<"}
+
+var sizeUnits = map[string]uint64{
+	"":    1,
+	"B":   1,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+}
+
+// Selector picks a disk by its properties, e.g.
+// "rotational=false,transport!=usb,size>=200GiB,pick=smallest". A selector
+// matching a single disk such as "serial=S3Z9NB0K123456" identifies it
+// whatever its device name.
+type Selector struct {
+	Terms []Term
+	// Pick is the disk to pick when several match, the first by name by
+	// default
+	Pick string
+}
+
+// Term is a condition on a property of the disk, e.g. size>=200GiB
+type Term struct {
+	Key   string
+	Op    string
+	Value string
+}
+
+// IsSelector reports whether an installation device is a selector rather
+// than a device path
+func IsSelector(device string) bool {
+	return device != "" && !strings.HasPrefix(device, "/")
+}
+
+// ParseSelector parses comma separated terms. String properties (name,
+// model, serial, wwn, transport) match shell patterns, rotational and
+// removable are booleans and size is compared with units, e.g. 200GiB.
+func ParseSelector(s string) (*Selector, error) {
+	selector := &Selector{Pick: PickFirst}
+	for _, t := range strings.Split(s, ",") {
+		term, err := parseTerm(strings.TrimSpace(t))
+		if err != nil {
+			return nil, err
+		}
+		if term.Key == "pick" {
+			selector.Pick = term.Value
+			continue
+		}
+		selector.Terms = append(selector.Terms, term)
+	}
+	return selector, nil
+}
+
+func parseTerm(s string) (Term, error) {
+	i := strings.IndexAny(s, "!=<>")
+	if i <= 0 {
+		return Term{}, fmt.Errorf("invalid selector term %q, must be in the form of key=value", s)
+	}
+	term := Term{Key: s[:i]}
+	for _, op := range operators {
+		if strings.HasPrefix(s[i:], op) {
+			term.Op = op
+			term.Value = s[i+len(op):]
+			break
+		}
+	}
+	if term.Op == "" || term.Value == "" {
+		return Term{}, fmt.Errorf("invalid selector term %q, must be in the form of key=value", s)
+	}
+
+	equality := term.Op == "=" || term.Op == "!="
+	switch term.Key {
+	case "name", "model", "serial", "wwn", "transport":
+		if _, err := filepath.Match(term.Value, ""); err != nil {
+			return Term{}, fmt.Errorf("invalid pattern in selector term %q", s)
+		}
+	case "rotational", "removable":
+		if _, err := strconv.ParseBool(term.Value); err != nil {
+			return Term{}, fmt.Errorf("invalid boolean in selector term %q", s)
+		}
+	case "size":
+		if _, err := ParseSize(term.Value); err != nil {
+			return Term{}, fmt.Errorf("invalid size in selector term %q", s)
+		}
+		equality = true
+	case "pick":
+		if term.Op != "=" || (term.Value != PickFirst && term.Value != PickSmallest && term.Value != PickLargest) {
+			return Term{}, fmt.Errorf("invalid selector term %q, pick must be one of first, smallest or largest", s)
+		}
+	default:
+		return Term{}, fmt.Errorf("unknown key in selector term %q", s)
+	}
+	if !equality {
+		return Term{}, fmt.Errorf("invalid operator in selector term %q, only size can be compared", s)
+	}
+	return term, nil
+}
+
+// Matches reports whether the disk meets all the terms
+func (s *Selector) Matches(d Disk) bool {
+	for _, term := range s.Terms {
+		if !term.matches(d) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t Term) matches(d Disk) bool {
+	var match bool
+	switch t.Key {
+	case "size":
+		size, _ := ParseSize(t.Value)
+		switch t.Op {
+		case ">=":
+			return d.Size >= size
+		case "<=":
+			return d.Size <= size
+		case ">":
+			return d.Size > size
+		case "<":
+			return d.Size < size
+		}
+		match = d.Size == size
+	case "rotational":
+		value, _ := strconv.ParseBool(t.Value)
+		match = d.Rotational == value
+	case "removable":
+		value, _ := strconv.ParseBool(t.Value)
+		match = d.Removable == value
+	default:
+		match, _ = filepath.Match(t.Value, map[string]string{
+			"name":      d.Name,
+			"model":     d.Model,
+			"serial":    d.Serial,
+			"wwn":       d.WWN,
+			"transport": d.Transport,
+		}[t.Key])
+	}
+	if t.Op == "!=" {
+		return !match
+	}
+	return match
+}
+
+// Select picks a matching disk but the excluded devices, nil if none matches
+func (s *Selector) Select(disks []Disk, exclude ...string) *Disk {
+	var candidates []Disk
+	for _, d := range disks {
+		if s.Matches(d) && !contains(exclude, d.Path) {
+			candidates = append(candidates, d)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	switch s.Pick {
+	case PickSmallest:
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Size < candidates[j].Size
+		})
+	case PickLargest:
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Size > candidates[j].Size
+		})
+	}
+	return &candidates[0]
+}
+
+// Resolve returns the disk of an installation device, nil if not found. The
+// device is a device path, a link to it such as /dev/disk/by-id/... or
+// /dev/disk/by-path/..., or a selector, which doesn't pick the excluded
+// devices.
+func Resolve(device string, exclude ...string) (*Disk, error) {
+	return NewInventory().Resolve(device, exclude...)
+}
+
+func (inv *Inventory) Resolve(device string, exclude ...string) (*Disk, error) {
+	disks, err := inv.List()
+	if err != nil {
+		return nil, err
+	}
+	if IsSelector(device) {
+		selector, err := ParseSelector(device)
+		if err != nil {
+			return nil, err
+		}
+		return selector.Select(disks, exclude...), nil
+	}
+	path, err := filepath.EvalSymlinks(device)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for i := range disks {
+		if disks[i].Path == path {
+			return &disks[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// ParseSize parses a size in bytes with an optional unit, e.g. 200GiB or
+// 500GB
+func ParseSize(s string) (uint64, error) {
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	unit, ok := sizeUnits[strings.TrimSpace(s[i:])]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit of size %s", s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %s", s)
+	}
+	return uint64(n * float64(unit)), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package disk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSelector(t *testing.T) {
+	selector, err := ParseSelector("rotational=false, transport!=usb,size>=200GiB,pick=smallest")
+	assert.Nil(t, err)
+	assert.Equal(t, &Selector{
+		Terms: []Term{
+			{Key: "rotational", Op: "=", Value: "false"},
+			{Key: "transport", Op: "!=", Value: "usb"},
+			{Key: "size", Op: ">=", Value: "200GiB"},
+		},
+		Pick: PickSmallest,
+	}, selector)
+
+	testCases := []struct {
+		selector string
+		err      string
+	}{
+		{
+			selector: "sda",
+			err:      `invalid selector term "sda", must be in the form of key=value`,
+		},
+		{
+			selector: "serial=",
+			err:      `invalid selector term "serial=", must be in the form of key=value`,
+		},
+		{
+			selector: "color=red",
+			err:      `unknown key in selector term "color=red"`,
+		},
+		{
+			selector: "model>Samsung",
+			err:      `invalid operator in selector term "model>Samsung", only size can be compared`,
+		},
+		{
+			selector: "size>=200GiBs",
+			err:      `invalid size in selector term "size>=200GiBs"`,
+		},
+		{
+			selector: "rotational=no",
+			err:      `invalid boolean in selector term "rotational=no"`,
+		},
+		{
+			selector: "pick=fastest",
+			err:      `invalid selector term "pick=fastest", pick must be one of first, smallest or largest`,
+		},
+	}
+	for _, tc := range testCases {
+		_, err := ParseSelector(tc.selector)
+		assert.EqualError(t, err, tc.err)
+	}
+}
+
+func TestSelector_Select(t *testing.T) {
+	disks := []Disk{
+		{Name: "nvme0n1", Path: "/dev/nvme0n1", Size: 1024 << 30, Transport: TransportNVMe, Serial: "S4EMNX0R123456"},
+		{Name: "sda", Path: "/dev/sda", Size: 240 << 30, Transport: TransportSATA, Model: "Samsung SSD 860", WWN: "0x5002538e40a1b2c3"},
+		{Name: "sdb", Path: "/dev/sdb", Size: 4096 << 30, Transport: TransportSATA, Rotational: true},
+		{Name: "sdc", Path: "/dev/sdc", Size: 256 << 30, Transport: TransportUSB, Removable: true},
+		{Name: "sdd", Path: "/dev/sdd", Size: 100 << 30, Transport: TransportSATA},
+	}
+
+	testCases := []struct {
+		selector string
+		exclude  []string
+		disk     string
+	}{
+		{
+			selector: "serial=S4EMNX0R123456",
+			disk:     "/dev/nvme0n1",
+		},
+		{
+			selector: "wwn=0x5002538e40a1b2c3",
+			disk:     "/dev/sda",
+		},
+		{
+			selector: "model=Samsung*",
+			disk:     "/dev/sda",
+		},
+		{
+			selector: "rotational=false,transport!=usb,size>=200GiB,pick=smallest",
+			disk:     "/dev/sda",
+		},
+		{
+			selector: "rotational=false,transport!=usb,size>=200GiB,pick=smallest",
+			exclude:  []string{"/dev/sda"},
+			disk:     "/dev/nvme0n1",
+		},
+		{
+			selector: "pick=largest",
+			disk:     "/dev/sdb",
+		},
+		{
+			selector: "transport=sata",
+			disk:     "/dev/sda",
+		},
+		{
+			selector: "removable=true,size<200GiB",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.selector, func(t *testing.T) {
+			selector, err := ParseSelector(tc.selector)
+			assert.Nil(t, err)
+			d := selector.Select(disks, tc.exclude...)
+			if tc.disk == "" {
+				assert.Nil(t, d)
+			} else if assert.NotNil(t, d) {
+				assert.Equal(t, tc.disk, d.Path)
+			}
+		})
+	}
+}
+
+func TestInventory_Resolve(t *testing.T) {
+	inv := fakeInventory(t, map[string]string{
+		"sys/block/sda/size":  "209715200",
+		"sys/block/sda/dev":   "8:0",
+		"run/udev/data/b8:0":  "E:ID_BUS=ata\nE:ID_SERIAL_SHORT=S3Z9NB0K123456",
+		"sys/block/sdb/size":  "419430400",
+		"sys/block/sdb/dev":   "8:16",
+		"run/udev/data/b8:16": "E:ID_BUS=usb",
+	})
+	dev, err := ioutil.TempDir("", "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dev)
+	inv.DevPath = dev
+	if err := ioutil.WriteFile(filepath.Join(dev, "sda"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	byID := filepath.Join(dev, "disk", "by-id")
+	if err := os.MkdirAll(byID, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../sda", filepath.Join(byID, "ata-S3Z9NB0K123456")); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		device string
+		disk   string
+		err    string
+	}{
+		{
+			device: filepath.Join(dev, "sda"),
+			disk:   filepath.Join(dev, "sda"),
+		},
+		{
+			device: filepath.Join(byID, "ata-S3Z9NB0K123456"),
+			disk:   filepath.Join(dev, "sda"),
+		},
+		{
+			device: filepath.Join(byID, "ata-missing"),
+		},
+		{
+			device: "serial=S3Z9NB0K123456",
+			disk:   filepath.Join(dev, "sda"),
+		},
+		{
+			device: "transport!=usb,size>=150GiB",
+		},
+		{
+			device: "size>=150GiB",
+			disk:   filepath.Join(dev, "sdb"),
+		},
+		{
+			device: "sdb",
+			err:    `invalid selector term "sdb", must be in the form of key=value`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.device, func(t *testing.T) {
+			d, err := inv.Resolve(tc.device)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.Nil(t, err)
+			if tc.disk == "" {
+				assert.Nil(t, d)
+			} else if assert.NotNil(t, d) {
+				assert.Equal(t, tc.disk, d.Path)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	testCases := map[string]uint64{
+		"512":    512,
+		"200GiB": 200 << 30,
+		"1.5TiB": 3 << 39,
+		"500GB":  500e9,
+		"64 MiB": 64 << 20,
+	}
+	for s, size := range testCases {
+		n, err := ParseSize(s)
+		assert.Nil(t, err)
+		assert.Equal(t, size, n, s)
+	}
+	_, err := ParseSize("1PiB")
+	assert.EqualError(t, err, "unknown unit of size 1PiB")
+}
@@ -0,0 +1,104 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	dhcpPidDir = "/run"
+	// the client gives up a request after 5 attempts 2 seconds apart
+	dhcpTimeout      = 15 * time.Second
+	dhcpRespawnDelay = "5"
+)
+
+// runDHCPClient runs the busybox DHCP client on a link under supervise-daemon,
+// like the services of k3os, so the lease is renewed for as long as the system
+// runs. The default script of the client configures the lease on the link.
+func runDHCPClient(link string, v6 bool) error {
+	client := dhcpClient(v6)
+	path, err := exec.LookPath(client)
+	if err != nil {
+		return err
+	}
+	if err := stopDHCPClient(link, v6); err != nil {
+		return err
+	}
+	name := dhcpServiceName(link, v6)
+	output, err := exec.Command("supervise-daemon", name, "--start",
+		"--pidfile", dhcpPidFile(name),
+		"--respawn-delay", dhcpRespawnDelay,
+		"--respawn-max", "0",
+		path, "--", "-f", "-i", link, "-t", "5", "-T", "2").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("fail to start %s: %s: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	if err := waitForLease(link, v6, dhcpTimeout); err != nil {
+		_ = stopDHCPClient(link, v6)
+		return err
+	}
+	return nil
+}
+
+// stopDHCPClients stops the DHCP clients left running on a link
+func stopDHCPClients(link string) error {
+	for _, v6 := range []bool{false, true} {
+		if err := stopDHCPClient(link, v6); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func stopDHCPClient(link string, v6 bool) error {
+	name := dhcpServiceName(link, v6)
+	pidFile := dhcpPidFile(name)
+	if _, err := os.Stat(pidFile); os.IsNotExist(err) {
+		return nil
+	}
+	output, err := exec.Command("supervise-daemon", name, "--stop", "--pidfile", pidFile).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("fail to stop %s: %s: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// waitForLease waits for the client to add a global address of the family to
+// the link
+func waitForLease(link string, v6 bool, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		if iface, err := net.InterfaceByName(link); err == nil {
+			addrs, _ := iface.Addrs()
+			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() && (ipNet.IP.To4() == nil) == v6 {
+					return nil
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("no lease within %s", timeout)
+		}
+		time.Sleep(time.Second / 2)
+	}
+}
+
+func dhcpClient(v6 bool) string {
+	if v6 {
+		return "udhcpc6"
+	}
+	return "udhcpc"
+}
+
+func dhcpServiceName(link string, v6 bool) string {
+	return fmt.Sprintf("%s.%s", dhcpClient(v6), link)
+}
+
+func dhcpPidFile(name string) string {
+	return filepath.Join(dhcpPidDir, name+".pid")
+}
@@ -0,0 +1,419 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/net/http/httpproxy"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+)
+
+const (
+	CheckGateway = "gateway"
+	CheckMTU     = "path MTU"
+	CheckDNS     = "DNS"
+	CheckNTP     = "NTP"
+	CheckHTTP    = "HTTP"
+	CheckClock   = "clock"
+
+	StatusPass = "PASS"
+	StatusFail = "FAIL"
+	StatusSkip = "SKIP"
+	StatusWarn = "WARN"
+
+	// MaxClockSkew is how far the clock may be off before it is warned about
+	MaxClockSkew = time.Minute
+
+	// DefaultLookupHost is resolved when no remote URL is configured. A
+	// server that answers that the host doesn't exist passes as well.
+	DefaultLookupHost = "harvesterhci.io"
+
+	lookupTimeout = 5 * time.Second
+	ntpTimeout    = 5 * time.Second
+	httpTimeout   = 15 * time.Second
+	probeTimeout  = time.Second
+)
+
+// Diagnosis is the result of a check of a target
+type Diagnosis struct {
+	Check  string `json:"check"`
+	Target string `json:"target"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func (d Diagnosis) String() string {
+	s := fmt.Sprintf("%s %s %s", d.Check, d.Target, d.Status)
+	if d.Detail != "" {
+		s += ": " + d.Detail
+	}
+	return s
+}
+
+// Diagnostics are the results of diagnosing a network
+type Diagnostics []Diagnosis
+
+// Passed reports whether no check failed
+func (ds Diagnostics) Passed() bool {
+	for _, d := range ds {
+		if d.Status == StatusFail {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders the results as a table
+func (ds Diagnostics) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tTARGET\tRESULT\tDETAIL")
+	for _, d := range ds {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.Check, d.Target, d.Status, d.Detail)
+	}
+	w.Flush()
+	return b.String()
+}
+
+// Replace returns the results with those of a check replaced by others, e.g.
+// the HTTP checks run again through a proxy
+func (ds Diagnostics) Replace(check string, results Diagnostics) Diagnostics {
+	var replaced Diagnostics
+	for _, d := range ds {
+		if d.Check != check {
+			replaced = append(replaced, d)
+		}
+	}
+	return append(replaced, results...)
+}
+
+// Summary renders the results on one line
+func (ds Diagnostics) Summary() string {
+	results := make([]string, 0, len(ds))
+	for _, d := range ds {
+		results = append(results, d.String())
+	}
+	return strings.Join(results, "; ")
+}
+
+// DiagnosticTargets are what the diagnostics try to reach besides the
+// gateways and DNS servers of the network
+type DiagnosticTargets struct {
+	NTPServers []string
+	// URLs are fetched through the proxy of the environment
+	URLs []string
+	// LookupHost is resolved by each DNS server
+	LookupHost string
+}
+
+// Diagnoser checks that a configured network reaches what the installation
+// needs
+type Diagnoser struct {
+	// ResolvConf is read for the DNS servers if the network has none
+	ResolvConf string
+	// Gateways returns the default gateways of a link
+	Gateways func(link string) ([]net.IP, error)
+	Ping     func(ip net.IP) error
+	// LinkMTU returns the MTU of a link
+	LinkMTU func(link string) (int, error)
+	// PathMTU returns the path MTU to ip, up to the link MTU
+	PathMTU func(ip net.IP, linkMTU int) (int, error)
+	// Lookup resolves host with a DNS server
+	Lookup func(server, host string) error
+	// NTPOffset returns the offset of the local clock to an NTP server
+	NTPOffset func(server string) (time.Duration, error)
+	// Get fetches a URL
+	Get func(url string) error
+	// Proxy returns the proxy a URL is fetched through
+	Proxy func(u *url.URL) (*url.URL, error)
+	// SetClock steps the system clock by offset
+	SetClock func(offset time.Duration) error
+}
+
+func NewDiagnoser() *Diagnoser {
+	return &Diagnoser{
+		ResolvConf: defaultResolvConf,
+		Gateways:   linkGateways,
+		Ping:       pingGateway,
+		LinkMTU:    linkMTU,
+		PathMTU: func(ip net.IP, mtu int) (int, error) {
+			return PathMTU(ip, mtu, probeTimeout)
+		},
+		Lookup: lookup,
+		NTPOffset: func(server string) (time.Duration, error) {
+			return NTPOffset(server, ntpTimeout)
+		},
+		Get:      httpGet,
+		Proxy:    proxyFromEnvironment,
+		SetClock: setClock,
+	}
+}
+
+// Diagnose runs every check against a network that is already configured.
+// Checks that depend on a failed one are skipped.
+func (d *Diagnoser) Diagnose(network config.Network, targets DiagnosticTargets) Diagnostics {
+	var results Diagnostics
+	name := network.LinkName()
+
+	reachable, gatewayResults := d.checkGateways(name)
+	results = append(results, gatewayResults...)
+	results = append(results, d.checkMTU(name, reachable))
+	results = append(results, d.checkDNS(network, targets)...)
+	for _, server := range targets.NTPServers {
+		results = append(results, d.checkNTP(server))
+	}
+	return append(results, d.CheckURLs(targets.URLs)...)
+}
+
+// CheckURLs fetches the URLs through the proxy of the environment
+func (d *Diagnoser) CheckURLs(urls []string) Diagnostics {
+	var results Diagnostics
+	for _, u := range urls {
+		results = append(results, d.checkHTTP(u))
+	}
+	return results
+}
+
+// SyncClock steps the clock to the time of the first NTP server that answers,
+// warning if the clock was far off
+func (d *Diagnoser) SyncClock(servers []string) Diagnosis {
+	if len(servers) == 0 {
+		return Diagnosis{Check: CheckClock, Status: StatusSkip, Detail: "no NTP server"}
+	}
+	var errs []string
+	for _, server := range servers {
+		offset, err := d.NTPOffset(server)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", server, err))
+			continue
+		}
+		offset = offset.Round(time.Millisecond)
+		if err := d.SetClock(offset); err != nil {
+			return Diagnosis{Check: CheckClock, Target: server, Status: StatusFail, Detail: fmt.Sprintf("fail to correct the offset %s: %s", offset, err)}
+		}
+		if offset > MaxClockSkew || offset < -MaxClockSkew {
+			return Diagnosis{Check: CheckClock, Target: server, Status: StatusWarn, Detail: fmt.Sprintf("corrected the large offset %s", offset)}
+		}
+		return Diagnosis{Check: CheckClock, Target: server, Status: StatusPass, Detail: fmt.Sprintf("corrected the offset %s", offset)}
+	}
+	return Diagnosis{Check: CheckClock, Target: strings.Join(servers, ","), Status: StatusFail, Detail: strings.Join(errs, ", ")}
+}
+
+func (d *Diagnoser) checkGateways(link string) ([]net.IP, Diagnostics) {
+	gateways, err := d.Gateways(link)
+	if err != nil {
+		return nil, Diagnostics{{Check: CheckGateway, Target: link, Status: StatusFail, Detail: err.Error()}}
+	}
+	if len(gateways) == 0 {
+		return nil, Diagnostics{{Check: CheckGateway, Target: link, Status: StatusFail, Detail: "no default gateway"}}
+	}
+	var (
+		reachable []net.IP
+		results   Diagnostics
+	)
+	for _, gw := range gateways {
+		var err error
+		for i := 0; i < pingAttempts; i++ {
+			if err = d.Ping(gw); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			results = append(results, Diagnosis{Check: CheckGateway, Target: gw.String(), Status: StatusFail, Detail: err.Error()})
+			continue
+		}
+		reachable = append(reachable, gw)
+		results = append(results, Diagnosis{Check: CheckGateway, Target: gw.String(), Status: StatusPass})
+	}
+	return reachable, results
+}
+
+func (d *Diagnoser) checkMTU(link string, gateways []net.IP) Diagnosis {
+	if len(gateways) == 0 {
+		return Diagnosis{Check: CheckMTU, Target: link, Status: StatusSkip, Detail: "no reachable gateway"}
+	}
+	gw := gateways[0]
+	result := Diagnosis{Check: CheckMTU, Target: gw.String()}
+	mtu, err := d.LinkMTU(link)
+	if err != nil {
+		result.Status, result.Detail = StatusFail, err.Error()
+		return result
+	}
+	pmtu, err := d.PathMTU(gw, mtu)
+	if err != nil {
+		result.Status, result.Detail = StatusFail, err.Error()
+		return result
+	}
+	if pmtu < mtu {
+		result.Status = StatusFail
+		result.Detail = fmt.Sprintf("path MTU %d is less than the MTU %d of %s", pmtu, mtu, link)
+		return result
+	}
+	result.Status, result.Detail = StatusPass, fmt.Sprintf("%d", pmtu)
+	return result
+}
+
+func (d *Diagnoser) checkDNS(network config.Network, targets DiagnosticTargets) Diagnostics {
+	servers := network.DNSNameservers
+	if len(servers) == 0 {
+		var err error
+		if servers, err = readNameservers(d.ResolvConf); err != nil {
+			return Diagnostics{{Check: CheckDNS, Target: d.ResolvConf, Status: StatusFail, Detail: err.Error()}}
+		}
+	}
+	if len(servers) == 0 {
+		return Diagnostics{{Check: CheckDNS, Target: d.ResolvConf, Status: StatusFail, Detail: "no DNS server"}}
+	}
+	host := targets.LookupHost
+	if host == "" {
+		host = DefaultLookupHost
+	}
+	var results Diagnostics
+	for _, server := range servers {
+		result := Diagnosis{Check: CheckDNS, Target: server, Status: StatusPass, Detail: host}
+		if err := d.Lookup(server, host); err != nil {
+			result.Status, result.Detail = StatusFail, err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (d *Diagnoser) checkNTP(server string) Diagnosis {
+	result := Diagnosis{Check: CheckNTP, Target: server}
+	offset, err := d.NTPOffset(server)
+	if err != nil {
+		result.Status, result.Detail = StatusFail, err.Error()
+		return result
+	}
+	result.Status, result.Detail = StatusPass, fmt.Sprintf("clock offset %s", offset.Round(time.Millisecond))
+	return result
+}
+
+func (d *Diagnoser) checkHTTP(rawURL string) Diagnosis {
+	result := Diagnosis{Check: CheckHTTP, Target: rawURL, Status: StatusPass}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		result.Status, result.Detail = StatusFail, err.Error()
+		return result
+	}
+	proxy, err := d.Proxy(u)
+	if err != nil {
+		result.Status, result.Detail = StatusFail, err.Error()
+		return result
+	}
+	if proxy != nil {
+		// the credentials of the proxy are not reported
+		proxy.User = nil
+		result.Detail = "via proxy " + proxy.String()
+	}
+	if err := d.Get(rawURL); err != nil {
+		result.Status = StatusFail
+		if result.Detail != "" {
+			result.Detail += ": "
+		}
+		result.Detail += err.Error()
+	}
+	return result
+}
+
+// linkGateways returns the gateways of the default routes of a link
+func linkGateways(link string) ([]net.IP, error) {
+	l, err := netlink.LinkByName(link)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := netlink.RouteList(l, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+	var gateways []net.IP
+	for _, route := range routes {
+		if route.Dst == nil && route.Gw != nil {
+			gateways = append(gateways, route.Gw)
+		}
+	}
+	return gateways, nil
+}
+
+func linkMTU(link string) (int, error) {
+	iface, err := net.InterfaceByName(link)
+	if err != nil {
+		return 0, err
+	}
+	return iface.MTU, nil
+}
+
+// lookup resolves host with a DNS server. The server is working if it
+// answers that the host doesn't exist.
+func lookup(server, host string) error {
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, net.JoinHostPort(server, "53"))
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	_, err := r.LookupHost(ctx, host)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil
+	}
+	return err
+}
+
+func proxyFromEnvironment(u *url.URL) (*url.URL, error) {
+	return httpproxy.FromEnvironment().ProxyFunc()(u)
+}
+
+func httpGet(rawURL string) error {
+	client := http.Client{
+		Timeout: httpTimeout,
+		Transport: &http.Transport{
+			Proxy: func(req *http.Request) (*url.URL, error) {
+				return proxyFromEnvironment(req.URL)
+			},
+		},
+	}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return err
+	}
+	// only the status matters, the body may be as large as an ISO
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("got %d status code", resp.StatusCode)
+	}
+	return nil
+}
+
+// readNameservers returns the name servers of a resolv.conf
+func readNameservers(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var servers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers, scanner.Err()
+}
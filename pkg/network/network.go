@@ -0,0 +1,671 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+const (
+	MethodDHCP   = "dhcp"
+	MethodStatic = "static"
+	MethodNone   = "none"
+	MethodSLAAC  = "slaac"
+	MethodDHCPv6 = "dhcpv6"
+
+	DefaultBondMode   = "active-backup"
+	DefaultBondMiimon = 100
+
+	defaultResolvConf  = "/etc/resolv.conf"
+	defaultConnmanConf = "/etc/conf.d/connman"
+	connmanArgsKey     = "command_args="
+	connmanNoDevice    = "--nodevice="
+	ipv6ConfPath       = "/proc/sys/net/ipv6/conf"
+	pingTimeout        = 2 * time.Second
+	pingAttempts       = 3
+)
+
+// Error is a failed step of applying a network
+type Error struct {
+	Op   string
+	Link string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("fail to %s on %s: %s", e.Op, e.Link, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// netlinkHandle is the part of netlink.Handle the configurator uses
+type netlinkHandle interface {
+	LinkByName(name string) (netlink.Link, error)
+	LinkAdd(link netlink.Link) error
+	LinkDel(link netlink.Link) error
+	LinkSetUp(link netlink.Link) error
+	LinkSetDown(link netlink.Link) error
+	LinkSetMasterByIndex(link netlink.Link, masterIndex int) error
+	LinkSetNoMaster(link netlink.Link) error
+	LinkSetMTU(link netlink.Link, mtu int) error
+	AddrList(link netlink.Link, family int) ([]netlink.Addr, error)
+	AddrReplace(link netlink.Link, addr *netlink.Addr) error
+	AddrDel(link netlink.Link, addr *netlink.Addr) error
+	RouteList(link netlink.Link, family int) ([]netlink.Route, error)
+	RouteReplace(route *netlink.Route) error
+	RouteDel(route *netlink.Route) error
+}
+
+// Configurator applies networks with netlink. When the gateway of a network
+// is not reachable afterwards, the links, addresses, routes and DNS servers
+// are rolled back to what they were before.
+type Configurator struct {
+	handle netlinkHandle
+
+	ResolvConf string
+	// ConnmanConf is the connman service config, which is updated to keep
+	// connman away from the configured links. Empty to leave connman alone.
+	ConnmanConf string
+	// Ping checks whether a gateway is reachable
+	Ping func(ip net.IP) error
+	// DHCP starts a DHCP client on a link, which keeps renewing the lease,
+	// and returns once it gets a lease
+	DHCP func(link string, v6 bool) error
+	// StopDHCP stops the DHCP clients of a link
+	StopDHCP func(link string) error
+	// SetIPv6Conf sets an IPv6 sysctl of a link, e.g. accept_ra
+	SetIPv6Conf func(link, key, value string) error
+	// RestartConnman restarts connman after ConnmanConf is changed
+	RestartConnman func() error
+}
+
+func NewConfigurator() *Configurator {
+	return &Configurator{
+		handle:         &netlink.Handle{},
+		ResolvConf:     defaultResolvConf,
+		ConnmanConf:    defaultConnmanConf,
+		Ping:           pingGateway,
+		DHCP:           runDHCPClient,
+		StopDHCP:       stopDHCPClients,
+		SetIPv6Conf:    setIPv6Conf,
+		RestartConnman: restartConnman,
+	}
+}
+
+// NeedsConfiguration reports whether a network differs from the DHCP
+// configuration connman applies to every NIC by default
+func NeedsConfiguration(network config.Network) bool {
+	return network.Method == MethodStatic ||
+		network.Method == MethodNone ||
+		network.IPv6Method != "" ||
+		network.Bond != nil ||
+		network.VLANID != 0 ||
+		network.MTU != 0 ||
+		len(network.Routes) > 0
+}
+
+// Links returns the links a network is built from and on, e.g. the bond
+// members, the bond and its VLAN interface
+func Links(network config.Network) []string {
+	var links []string
+	if network.Bond != nil {
+		links = append(links, network.Bond.Members...)
+	}
+	links = append(links, network.Interface)
+	if network.VLANID != 0 {
+		links = append(links, network.LinkName())
+	}
+	return links
+}
+
+// LoadNetworks loads the networks saved by the installer
+func LoadNetworks(path string) ([]config.Network, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var networks []config.Network
+	if err := yaml.Unmarshal(b, &networks); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", path, err)
+	}
+	return networks, nil
+}
+
+// ApplyFile applies the networks saved by the installer, on every boot of the
+// installed system
+func ApplyFile(path string) error {
+	networks, err := LoadNetworks(path)
+	if err != nil {
+		return err
+	}
+	return NewConfigurator().ApplyAll(networks)
+}
+
+// ApplyAll applies the networks one by one, having connman release the links
+// of all of them and take back the links of plain DHCP networks at once
+// beforehand
+func (c *Configurator) ApplyAll(networks []config.Network) error {
+	var configured, plain []string
+	for _, network := range networks {
+		if NeedsConfiguration(network) {
+			configured = append(configured, Links(network)...)
+		} else {
+			plain = append(plain, Links(network)...)
+		}
+	}
+	if err := c.updateConnmanLinks(configured, plain); err != nil {
+		return err
+	}
+	for _, network := range networks {
+		if err := c.Apply(network); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply configures a network and verifies its gateways are reachable,
+// restoring the previous state if they are not
+func (c *Configurator) Apply(network config.Network) error {
+	if !NeedsConfiguration(network) {
+		// connman does it, once it has the links back
+		return c.updateConnmanLinks(nil, Links(network))
+	}
+	snap, err := c.takeSnapshot(network)
+	if err != nil {
+		return err
+	}
+	err = c.updateConnmanLinks(Links(network), nil)
+	if err == nil {
+		err = c.apply(network, snap)
+	}
+	if err == nil {
+		err = c.check(network)
+	}
+	if err != nil {
+		logrus.Errorf("rolling back network %s: %s", network.LinkName(), err)
+		if rollbackErr := c.rollback(snap); rollbackErr != nil {
+			logrus.Errorf("fail to roll back network %s: %s", network.LinkName(), rollbackErr)
+		}
+		return err
+	}
+	logrus.Infof("configured network %s", network.LinkName())
+	return nil
+}
+
+func (c *Configurator) apply(network config.Network, snap *snapshot) error {
+	link, err := c.setupLinks(network, snap)
+	if err != nil {
+		return err
+	}
+	name := network.LinkName()
+	// the clients of a previous DHCP configuration would undo this one
+	if err := c.StopDHCP(name); err != nil {
+		return &Error{Op: "stop DHCP clients", Link: name, Err: err}
+	}
+	if err := c.setMTU(network); err != nil {
+		return err
+	}
+
+	switch network.Method {
+	case MethodStatic:
+		addr, err := ipv4Addr(network.IP, network.SubnetMask)
+		if err != nil {
+			return &Error{Op: "parse address", Link: name, Err: err}
+		}
+		if err := c.flushAddrs(link, netlink.FAMILY_V4); err != nil {
+			return err
+		}
+		if err := c.handle.AddrReplace(link, addr); err != nil {
+			return &Error{Op: "add address " + addr.IPNet.String(), Link: name, Err: err}
+		}
+		if err := c.replaceDefaultRoute(link, network.Gateway); err != nil {
+			return err
+		}
+	case MethodNone:
+		if err := c.flushAddrs(link, netlink.FAMILY_V4); err != nil {
+			return err
+		}
+	default:
+		if err := c.flushAddrs(link, netlink.FAMILY_V4); err != nil {
+			return err
+		}
+		if err := c.DHCP(name, false); err != nil {
+			return &Error{Op: "get DHCP lease", Link: name, Err: err}
+		}
+	}
+
+	if err := c.applyIPv6(network, link); err != nil {
+		return err
+	}
+
+	for _, route := range network.Routes {
+		if err := c.addRoute(link, route); err != nil {
+			return err
+		}
+	}
+
+	if len(network.DNSNameservers) > 0 {
+		if err := writeResolvConf(c.ResolvConf, network.DNSNameservers); err != nil {
+			return &Error{Op: "write " + c.ResolvConf, Link: name, Err: err}
+		}
+	}
+	return nil
+}
+
+func (c *Configurator) applyIPv6(network config.Network, link netlink.Link) error {
+	name := network.LinkName()
+	// setConf sets key value pairs in order, disable_ipv6 first
+	setConf := func(pairs ...string) error {
+		for i := 0; i+1 < len(pairs); i += 2 {
+			if err := c.SetIPv6Conf(name, pairs[i], pairs[i+1]); err != nil {
+				return &Error{Op: fmt.Sprintf("set IPv6 %s", pairs[i]), Link: name, Err: err}
+			}
+		}
+		return nil
+	}
+
+	switch network.IPv6Method {
+	case "":
+		return nil
+	case MethodNone:
+		return setConf("disable_ipv6", "1")
+	case MethodSLAAC:
+		return setConf("disable_ipv6", "0", "accept_ra", "1", "autoconf", "1")
+	case MethodDHCPv6:
+		if err := setConf("disable_ipv6", "0", "accept_ra", "1", "autoconf", "0"); err != nil {
+			return err
+		}
+		if err := c.DHCP(name, true); err != nil {
+			return &Error{Op: "get DHCPv6 lease", Link: name, Err: err}
+		}
+		return nil
+	case MethodStatic:
+		if err := setConf("disable_ipv6", "0", "accept_ra", "0", "autoconf", "0"); err != nil {
+			return err
+		}
+		ip, ipNet, err := net.ParseCIDR(network.IPv6)
+		if err != nil {
+			return &Error{Op: "parse IPv6 address", Link: name, Err: err}
+		}
+		addr := &netlink.Addr{IPNet: &net.IPNet{IP: ip, Mask: ipNet.Mask}}
+		if err := c.handle.AddrReplace(link, addr); err != nil {
+			return &Error{Op: "add address " + network.IPv6, Link: name, Err: err}
+		}
+		return c.replaceDefaultRoute(link, network.IPv6Gateway)
+	}
+	return &Error{Op: "configure IPv6", Link: name, Err: fmt.Errorf("unknown method %s", network.IPv6Method)}
+}
+
+// setupLinks creates the bond and VLAN of a network and brings them up. The
+// created links are recorded in the snapshot to be deleted on rollback.
+func (c *Configurator) setupLinks(network config.Network, snap *snapshot) (netlink.Link, error) {
+	if bond := network.Bond; bond != nil {
+		link, err := c.handle.LinkByName(network.Interface)
+		if err != nil {
+			mode, miimon := bond.Mode, bond.Miimon
+			if mode == "" {
+				mode = DefaultBondMode
+			}
+			if miimon == 0 {
+				miimon = DefaultBondMiimon
+			}
+			newBond := netlink.NewLinkBond(netlink.LinkAttrs{Name: network.Interface})
+			newBond.Mode = netlink.StringToBondMode(mode)
+			newBond.Miimon = miimon
+			if err := c.handle.LinkAdd(newBond); err != nil {
+				return nil, &Error{Op: "create bond", Link: network.Interface, Err: err}
+			}
+			snap.created = append(snap.created, network.Interface)
+			if link, err = c.handle.LinkByName(network.Interface); err != nil {
+				return nil, &Error{Op: "find bond", Link: network.Interface, Err: err}
+			}
+		}
+		for _, name := range bond.Members {
+			member, err := c.handle.LinkByName(name)
+			if err != nil {
+				return nil, &Error{Op: "find bond member", Link: name, Err: err}
+			}
+			if member.Attrs().MasterIndex == link.Attrs().Index {
+				continue
+			}
+			// a link must be down to be enslaved
+			if err := c.handle.LinkSetDown(member); err != nil {
+				return nil, &Error{Op: "set link down", Link: name, Err: err}
+			}
+			if err := c.flushAddrs(member, netlink.FAMILY_ALL); err != nil {
+				return nil, err
+			}
+			if err := c.handle.LinkSetMasterByIndex(member, link.Attrs().Index); err != nil {
+				return nil, &Error{Op: "add to bond " + network.Interface, Link: name, Err: err}
+			}
+		}
+	}
+
+	link, err := c.handle.LinkByName(network.Interface)
+	if err != nil {
+		return nil, &Error{Op: "find link", Link: network.Interface, Err: err}
+	}
+	if err := c.handle.LinkSetUp(link); err != nil {
+		return nil, &Error{Op: "set link up", Link: network.Interface, Err: err}
+	}
+	if network.VLANID == 0 {
+		return link, nil
+	}
+
+	name := network.LinkName()
+	vlan, err := c.handle.LinkByName(name)
+	if err != nil {
+		newVLAN := &netlink.Vlan{
+			LinkAttrs: netlink.LinkAttrs{Name: name, ParentIndex: link.Attrs().Index},
+			VlanId:    network.VLANID,
+		}
+		if err := c.handle.LinkAdd(newVLAN); err != nil {
+			return nil, &Error{Op: "create VLAN", Link: name, Err: err}
+		}
+		snap.created = append(snap.created, name)
+		if vlan, err = c.handle.LinkByName(name); err != nil {
+			return nil, &Error{Op: "find VLAN", Link: name, Err: err}
+		}
+	}
+	if err := c.handle.LinkSetUp(vlan); err != nil {
+		return nil, &Error{Op: "set link up", Link: name, Err: err}
+	}
+	return vlan, nil
+}
+
+// setMTU sets the MTU of the interface of a network, which passes it on to
+// the bond members, and then of the VLAN interface
+func (c *Configurator) setMTU(network config.Network) error {
+	if network.MTU == 0 {
+		return nil
+	}
+	names := []string{network.Interface}
+	if network.VLANID != 0 {
+		names = append(names, network.LinkName())
+	}
+	for _, name := range names {
+		link, err := c.handle.LinkByName(name)
+		if err != nil {
+			return &Error{Op: "find link", Link: name, Err: err}
+		}
+		if link.Attrs().MTU == network.MTU {
+			continue
+		}
+		if err := c.handle.LinkSetMTU(link, network.MTU); err != nil {
+			return &Error{Op: fmt.Sprintf("set MTU %d", network.MTU), Link: name, Err: err}
+		}
+	}
+	return nil
+}
+
+func (c *Configurator) addRoute(link netlink.Link, route config.Route) error {
+	name := link.Attrs().Name
+	_, dst, err := net.ParseCIDR(route.Destination)
+	if err != nil {
+		return &Error{Op: "parse route destination", Link: name, Err: err}
+	}
+	gw := net.ParseIP(route.Gateway)
+	if gw == nil {
+		return &Error{Op: "add route to " + route.Destination, Link: name, Err: fmt.Errorf("invalid gateway %q", route.Gateway)}
+	}
+	r := &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       dst,
+		Gw:        gw,
+		Priority:  route.Metric,
+	}
+	if err := c.handle.RouteReplace(r); err != nil {
+		return &Error{Op: fmt.Sprintf("add route to %s via %s", route.Destination, route.Gateway), Link: name, Err: err}
+	}
+	return nil
+}
+
+func (c *Configurator) flushAddrs(link netlink.Link, family int) error {
+	addrs, err := c.handle.AddrList(link, family)
+	if err != nil {
+		return &Error{Op: "list addresses", Link: link.Attrs().Name, Err: err}
+	}
+	for i := range addrs {
+		if addrs[i].IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if err := c.handle.AddrDel(link, &addrs[i]); err != nil {
+			return &Error{Op: "delete address " + addrs[i].IPNet.String(), Link: link.Attrs().Name, Err: err}
+		}
+	}
+	return nil
+}
+
+func (c *Configurator) replaceDefaultRoute(link netlink.Link, gateway string) error {
+	gw := net.ParseIP(gateway)
+	if gw == nil {
+		return &Error{Op: "add default route", Link: link.Attrs().Name, Err: fmt.Errorf("invalid gateway %q", gateway)}
+	}
+	route := &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Gw:        gw,
+	}
+	if err := c.handle.RouteReplace(route); err != nil {
+		return &Error{Op: "add default route via " + gateway, Link: link.Attrs().Name, Err: err}
+	}
+	return nil
+}
+
+// check pings the gateways of a network. Gateways learned from DHCP or
+// router advertisements are read from the default routes.
+func (c *Configurator) check(network config.Network) error {
+	name := network.LinkName()
+	link, err := c.handle.LinkByName(name)
+	if err != nil {
+		return &Error{Op: "find link", Link: name, Err: err}
+	}
+	routes, err := c.handle.RouteList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return &Error{Op: "list routes", Link: name, Err: err}
+	}
+	for _, route := range routes {
+		if route.Dst != nil || route.Gw == nil {
+			continue
+		}
+		var err error
+		for i := 0; i < pingAttempts; i++ {
+			if err = c.Ping(route.Gw); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return &Error{Op: "reach gateway " + route.Gw.String(), Link: name, Err: err}
+		}
+	}
+	return nil
+}
+
+// updateConnmanLinks keeps connman from configuring the links to ignore, so
+// that it doesn't undo what the configurator does, and gives it back the links
+// to restore. The addresses, routes and DHCP clients the configurator left on
+// the restored links are removed so connman starts over with DHCP. The other
+// lines of the config, e.g. the rc_want of wifi, are kept.
+func (c *Configurator) updateConnmanLinks(ignore, restore []string) error {
+	if c.ConnmanConf == "" {
+		return nil
+	}
+	old, err := ioutil.ReadFile(c.ConnmanConf)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, name := range ignoredConnmanLinks(old) {
+		if util.StringSliceContains(restore, name) {
+			if err := c.resetLink(name); err != nil {
+				return err
+			}
+		}
+	}
+	return c.updateConnmanConf(setConnmanLinks(old, ignore, restore))
+}
+
+// resetLink removes the addresses and routes of a link, the link-local ones
+// and those the kernel adds with the addresses aside
+func (c *Configurator) resetLink(name string) error {
+	link, err := c.handle.LinkByName(name)
+	if err != nil {
+		// e.g. a VLAN interface that is gone
+		return nil
+	}
+	if err := c.StopDHCP(name); err != nil {
+		return &Error{Op: "stop DHCP clients", Link: name, Err: err}
+	}
+	routes, err := c.handle.RouteList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return &Error{Op: "list routes", Link: name, Err: err}
+	}
+	for i := range routes {
+		if routes[i].Protocol == unix.RTPROT_KERNEL {
+			continue
+		}
+		if err := c.handle.RouteDel(&routes[i]); err != nil {
+			return &Error{Op: "delete route", Link: name, Err: err}
+		}
+	}
+	return c.flushAddrs(link, netlink.FAMILY_ALL)
+}
+
+func (c *Configurator) updateConnmanConf(content []byte) error {
+	old, err := ioutil.ReadFile(c.ConnmanConf)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if bytes.Equal(old, content) {
+		return nil
+	}
+	if err := ioutil.WriteFile(c.ConnmanConf, content, 0644); err != nil {
+		return err
+	}
+	return c.RestartConnman()
+}
+
+// ConnmanConf returns the connman service config to ignore links
+func ConnmanConf(links []string) string {
+	return fmt.Sprintf("command_args=\"-r --nodevice=%s\"\n", strings.Join(links, ","))
+}
+
+// parseConnmanArgs splits the command_args line of a connman service config
+// into the links of its --nodevice option and the other arguments
+func parseConnmanArgs(line string) (args []string, ignored []string) {
+	for _, arg := range strings.Fields(strings.Trim(strings.TrimPrefix(line, connmanArgsKey), `"`)) {
+		if strings.HasPrefix(arg, connmanNoDevice) {
+			ignored = append(ignored, strings.Split(strings.TrimPrefix(arg, connmanNoDevice), ",")...)
+			continue
+		}
+		args = append(args, arg)
+	}
+	return args, ignored
+}
+
+// ignoredConnmanLinks returns the links of the --nodevice option of a connman
+// service config
+func ignoredConnmanLinks(conf []byte) []string {
+	for _, line := range strings.Split(string(conf), "\n") {
+		if strings.HasPrefix(line, connmanArgsKey) {
+			_, ignored := parseConnmanArgs(line)
+			return ignored
+		}
+	}
+	return nil
+}
+
+// setConnmanLinks adds the links to ignore to the --nodevice option of the
+// command_args line of a connman service config and removes the links to
+// restore from it, leaving the other lines and arguments as they are
+func setConnmanLinks(conf []byte, ignore, restore []string) []byte {
+	var (
+		lines []string
+		found bool
+	)
+	if len(conf) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(conf), "\n"), "\n")
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, connmanArgsKey) {
+			continue
+		}
+		found = true
+		args, ignored := parseConnmanArgs(line)
+		var links []string
+		for _, link := range append(ignored, ignore...) {
+			if !util.StringSliceContains(links, link) && !util.StringSliceContains(restore, link) {
+				links = append(links, link)
+			}
+		}
+		if len(links) > 0 {
+			args = append(args, connmanNoDevice+strings.Join(links, ","))
+		}
+		lines[i] = fmt.Sprintf("%s\"%s\"", connmanArgsKey, strings.Join(args, " "))
+	}
+	if !found && len(ignore) > 0 {
+		lines = append(lines, strings.TrimSuffix(ConnmanConf(ignore), "\n"))
+	}
+	if len(lines) == 0 {
+		return conf
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+func ipv4Addr(ip, mask string) (*netlink.Addr, error) {
+	parsedIP := net.ParseIP(ip).To4()
+	if parsedIP == nil {
+		return nil, fmt.Errorf("invalid IPv4 address %q", ip)
+	}
+	parsedMask := net.ParseIP(mask).To4()
+	if parsedMask == nil {
+		return nil, fmt.Errorf("invalid subnet mask %q", mask)
+	}
+	return &netlink.Addr{IPNet: &net.IPNet{IP: parsedIP, Mask: net.IPMask(parsedMask)}}, nil
+}
+
+func writeResolvConf(path string, nameservers []string) error {
+	var b strings.Builder
+	for _, ns := range nameservers {
+		fmt.Fprintf(&b, "nameserver %s\n", ns)
+	}
+	// resolv.conf may be a link to the one of connman
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(b.String()), 0644)
+}
+
+func pingGateway(ip net.IP) error {
+	return Ping(ip, pingTimeout)
+}
+
+func setIPv6Conf(link, key, value string) error {
+	return ioutil.WriteFile(filepath.Join(ipv6ConfPath, link, key), []byte(value), 0644)
+}
+
+func restartConnman() error {
+	if _, err := os.Stat("/etc/init.d/connman"); os.IsNotExist(err) {
+		return nil
+	}
+	output, err := exec.Command("rc-service", "connman", "restart").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("fail to restart connman: %s: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
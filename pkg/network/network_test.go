@@ -0,0 +1,490 @@
+package network
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+)
+
+// fakeHandle keeps links, addresses and routes in memory
+type fakeHandle struct {
+	links     map[string]netlink.Link
+	addrs     map[string][]netlink.Addr
+	routes    []netlink.Route
+	nextIndex int
+}
+
+func newFakeHandle(names ...string) *fakeHandle {
+	h := &fakeHandle{
+		links: map[string]netlink.Link{},
+		addrs: map[string][]netlink.Addr{},
+	}
+	for _, name := range names {
+		_ = h.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: name, Flags: net.FlagUp}})
+	}
+	return h
+}
+
+func (h *fakeHandle) LinkByName(name string) (netlink.Link, error) {
+	if link, ok := h.links[name]; ok {
+		return link, nil
+	}
+	return nil, errors.New("Link not found")
+}
+
+func (h *fakeHandle) LinkAdd(link netlink.Link) error {
+	if _, ok := h.links[link.Attrs().Name]; ok {
+		return errors.New("file exists")
+	}
+	h.nextIndex++
+	link.Attrs().Index = h.nextIndex
+	h.links[link.Attrs().Name] = link
+	return nil
+}
+
+func (h *fakeHandle) LinkDel(link netlink.Link) error {
+	delete(h.links, link.Attrs().Name)
+	delete(h.addrs, link.Attrs().Name)
+	return nil
+}
+
+func (h *fakeHandle) LinkSetUp(link netlink.Link) error {
+	link.Attrs().Flags |= net.FlagUp
+	return nil
+}
+
+func (h *fakeHandle) LinkSetDown(link netlink.Link) error {
+	link.Attrs().Flags &^= net.FlagUp
+	return nil
+}
+
+func (h *fakeHandle) LinkSetMasterByIndex(link netlink.Link, masterIndex int) error {
+	link.Attrs().MasterIndex = masterIndex
+	return nil
+}
+
+func (h *fakeHandle) LinkSetNoMaster(link netlink.Link) error {
+	link.Attrs().MasterIndex = 0
+	return nil
+}
+
+func (h *fakeHandle) LinkSetMTU(link netlink.Link, mtu int) error {
+	link.Attrs().MTU = mtu
+	return nil
+}
+
+func (h *fakeHandle) AddrList(link netlink.Link, family int) ([]netlink.Addr, error) {
+	var result []netlink.Addr
+	for _, addr := range h.addrs[link.Attrs().Name] {
+		if family == netlink.FAMILY_ALL || (family == netlink.FAMILY_V4) == (addr.IP.To4() != nil) {
+			result = append(result, addr)
+		}
+	}
+	return result, nil
+}
+
+func (h *fakeHandle) AddrReplace(link netlink.Link, addr *netlink.Addr) error {
+	_ = h.AddrDel(link, addr)
+	h.addrs[link.Attrs().Name] = append(h.addrs[link.Attrs().Name], *addr)
+	return nil
+}
+
+func (h *fakeHandle) AddrDel(link netlink.Link, addr *netlink.Addr) error {
+	addrs := h.addrs[link.Attrs().Name]
+	for i := range addrs {
+		if addrs[i].Equal(*addr) {
+			h.addrs[link.Attrs().Name] = append(addrs[:i], addrs[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("cannot assign requested address")
+}
+
+func (h *fakeHandle) RouteList(link netlink.Link, family int) ([]netlink.Route, error) {
+	var result []netlink.Route
+	for _, route := range h.routes {
+		if route.LinkIndex == link.Attrs().Index {
+			result = append(result, route)
+		}
+	}
+	return result, nil
+}
+
+func sameDestination(a, b netlink.Route) bool {
+	if a.Dst == nil || b.Dst == nil {
+		return a.Dst == nil && b.Dst == nil && (a.Gw.To4() == nil) == (b.Gw.To4() == nil)
+	}
+	return a.Dst.String() == b.Dst.String()
+}
+
+func (h *fakeHandle) RouteReplace(route *netlink.Route) error {
+	for i := range h.routes {
+		if h.routes[i].LinkIndex == route.LinkIndex && sameDestination(h.routes[i], *route) {
+			h.routes[i] = *route
+			return nil
+		}
+	}
+	h.routes = append(h.routes, *route)
+	return nil
+}
+
+func (h *fakeHandle) RouteDel(route *netlink.Route) error {
+	for i := range h.routes {
+		if h.routes[i].Equal(*route) {
+			h.routes = append(h.routes[:i], h.routes[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("no such process")
+}
+
+func newTestConfigurator(t *testing.T, h *fakeHandle, reachable ...string) *Configurator {
+	dir, err := ioutil.TempDir("", "network")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	resolvConf := filepath.Join(dir, "resolv.conf")
+	if err := ioutil.WriteFile(resolvConf, []byte("nameserver 192.168.1.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &Configurator{
+		handle:     h,
+		ResolvConf: resolvConf,
+		Ping: func(ip net.IP) error {
+			for _, r := range reachable {
+				if ip.Equal(net.ParseIP(r)) {
+					return nil
+				}
+			}
+			return errors.New("no reply")
+		},
+		DHCP: func(link string, v6 bool) error {
+			return errors.New("no lease")
+		},
+		StopDHCP: func(link string) error {
+			return nil
+		},
+		SetIPv6Conf: func(link, key, value string) error {
+			return nil
+		},
+	}
+}
+
+func addrStrings(addrs []netlink.Addr) []string {
+	var result []string
+	for _, addr := range addrs {
+		result = append(result, addr.IPNet.String())
+	}
+	return result
+}
+
+func mustParseAddr(t *testing.T, s string) netlink.Addr {
+	addr, err := netlink.ParseAddr(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *addr
+}
+
+func TestConfigurator_ApplyStatic(t *testing.T) {
+	h := newFakeHandle("eth0")
+	c := newTestConfigurator(t, h, "10.0.0.1")
+
+	err := c.Apply(config.Network{
+		Interface:      "eth0",
+		Method:         MethodStatic,
+		IP:             "10.0.0.10",
+		SubnetMask:     "255.255.255.0",
+		Gateway:        "10.0.0.1",
+		DNSNameservers: []string{"8.8.8.8"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.10/24"}, addrStrings(h.addrs["eth0"]))
+	assert.Len(t, h.routes, 1)
+	assert.Equal(t, "10.0.0.1", h.routes[0].Gw.String())
+	b, _ := ioutil.ReadFile(c.ResolvConf)
+	assert.Equal(t, "nameserver 8.8.8.8\n", string(b))
+}
+
+func TestConfigurator_ApplyRollback(t *testing.T) {
+	h := newFakeHandle("eth0")
+	eth0 := h.links["eth0"]
+	h.addrs["eth0"] = []netlink.Addr{mustParseAddr(t, "192.168.1.5/24")}
+	h.routes = []netlink.Route{{LinkIndex: eth0.Attrs().Index, Gw: net.ParseIP("192.168.1.1")}}
+	c := newTestConfigurator(t, h, "192.168.1.1")
+
+	err := c.Apply(config.Network{
+		Interface:      "eth0",
+		Method:         MethodStatic,
+		IP:             "10.0.0.10",
+		SubnetMask:     "255.255.255.0",
+		Gateway:        "10.0.0.1",
+		DNSNameservers: []string{"8.8.8.8"},
+	})
+	var networkErr *Error
+	if assert.True(t, errors.As(err, &networkErr)) {
+		assert.Equal(t, "reach gateway 10.0.0.1", networkErr.Op)
+		assert.Equal(t, "eth0", networkErr.Link)
+	}
+	assert.Equal(t, []string{"192.168.1.5/24"}, addrStrings(h.addrs["eth0"]))
+	assert.Len(t, h.routes, 1)
+	assert.Equal(t, "192.168.1.1", h.routes[0].Gw.String())
+	b, _ := ioutil.ReadFile(c.ResolvConf)
+	assert.Equal(t, "nameserver 192.168.1.1\n", string(b))
+}
+
+func TestConfigurator_ApplyBondVLAN(t *testing.T) {
+	network := config.Network{
+		Interface:  "bond0",
+		Method:     MethodStatic,
+		IP:         "10.0.0.10",
+		SubnetMask: "255.255.255.0",
+		Gateway:    "10.0.0.1",
+		Bond: &config.Bond{
+			Members: []string{"eth0", "eth1"},
+			Mode:    "802.3ad",
+		},
+		VLANID: 100,
+	}
+
+	t.Run("reachable", func(t *testing.T) {
+		h := newFakeHandle("eth0", "eth1")
+		c := newTestConfigurator(t, h, "10.0.0.1")
+		assert.Nil(t, c.Apply(network))
+
+		bond, ok := h.links["bond0"].(*netlink.Bond)
+		if assert.True(t, ok) {
+			assert.Equal(t, netlink.BOND_MODE_802_3AD, bond.Mode)
+			assert.Equal(t, DefaultBondMiimon, bond.Miimon)
+		}
+		assert.Equal(t, bond.Index, h.links["eth0"].Attrs().MasterIndex)
+		assert.Equal(t, bond.Index, h.links["eth1"].Attrs().MasterIndex)
+		vlan, ok := h.links["bond0.100"].(*netlink.Vlan)
+		if assert.True(t, ok) {
+			assert.Equal(t, 100, vlan.VlanId)
+			assert.Equal(t, bond.Index, vlan.ParentIndex)
+		}
+		assert.Equal(t, []string{"10.0.0.10/24"}, addrStrings(h.addrs["bond0.100"]))
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		h := newFakeHandle("eth0", "eth1")
+		h.addrs["eth0"] = []netlink.Addr{mustParseAddr(t, "192.168.1.5/24")}
+		c := newTestConfigurator(t, h)
+		assert.NotNil(t, c.Apply(network))
+
+		assert.NotContains(t, h.links, "bond0")
+		assert.NotContains(t, h.links, "bond0.100")
+		assert.Equal(t, 0, h.links["eth0"].Attrs().MasterIndex)
+		assert.Equal(t, 0, h.links["eth1"].Attrs().MasterIndex)
+		assert.Equal(t, []string{"192.168.1.5/24"}, addrStrings(h.addrs["eth0"]))
+	})
+}
+
+func TestConfigurator_ApplyMTURoutes(t *testing.T) {
+	network := config.Network{
+		Interface:  "eth0",
+		Method:     MethodStatic,
+		IP:         "10.0.0.10",
+		SubnetMask: "255.255.255.0",
+		Gateway:    "10.0.0.1",
+		VLANID:     100,
+		MTU:        9000,
+		Routes: []config.Route{
+			{Destination: "172.16.0.0/12", Gateway: "10.0.0.254", Metric: 100},
+		},
+	}
+
+	t.Run("reachable", func(t *testing.T) {
+		h := newFakeHandle("eth0")
+		c := newTestConfigurator(t, h, "10.0.0.1")
+		assert.Nil(t, c.Apply(network))
+
+		assert.Equal(t, 9000, h.links["eth0"].Attrs().MTU)
+		assert.Equal(t, 9000, h.links["eth0.100"].Attrs().MTU)
+		if assert.Len(t, h.routes, 2) {
+			assert.Equal(t, "172.16.0.0/12", h.routes[1].Dst.String())
+			assert.Equal(t, "10.0.0.254", h.routes[1].Gw.String())
+			assert.Equal(t, 100, h.routes[1].Priority)
+		}
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		h := newFakeHandle("eth0")
+		eth0 := h.links["eth0"]
+		eth0.Attrs().MTU = 1500
+		h.routes = []netlink.Route{{LinkIndex: eth0.Attrs().Index, Gw: net.ParseIP("192.168.1.1")}}
+		c := newTestConfigurator(t, h)
+		assert.NotNil(t, c.Apply(config.Network{
+			Interface:  "eth0",
+			Method:     MethodStatic,
+			IP:         "10.0.0.10",
+			SubnetMask: "255.255.255.0",
+			Gateway:    "10.0.0.1",
+			MTU:        9000,
+			Routes:     network.Routes,
+		}))
+
+		assert.Equal(t, 1500, eth0.Attrs().MTU)
+		if assert.Len(t, h.routes, 1) {
+			assert.Equal(t, "192.168.1.1", h.routes[0].Gw.String())
+		}
+	})
+}
+
+func TestConfigurator_ApplyDHCP(t *testing.T) {
+	h := newFakeHandle("eth0")
+	c := newTestConfigurator(t, h)
+
+	// connman configures DHCP on plain NICs
+	assert.Nil(t, c.Apply(config.Network{Interface: "eth0", Method: MethodDHCP}))
+
+	err := c.Apply(config.Network{Interface: "eth0", Method: MethodDHCP, VLANID: 10})
+	var networkErr *Error
+	if assert.True(t, errors.As(err, &networkErr)) {
+		assert.Equal(t, "get DHCP lease", networkErr.Op)
+		assert.Equal(t, "eth0.10", networkErr.Link)
+	}
+	assert.NotContains(t, h.links, "eth0.10")
+}
+
+func TestConfigurator_ApplyAll(t *testing.T) {
+	h := newFakeHandle("eth0", "eth1", "eth2")
+	c := newTestConfigurator(t, h, "10.0.0.1", "10.1.0.1")
+	c.ConnmanConf = filepath.Join(filepath.Dir(c.ResolvConf), "connman")
+	if err := ioutil.WriteFile(c.ConnmanConf, []byte("command_args=\"-r\"\nrc_want=\"wpa_supplicant\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	restarts := 0
+	c.RestartConnman = func() error {
+		restarts++
+		return nil
+	}
+
+	assert.Nil(t, c.ApplyAll([]config.Network{
+		{
+			Interface:  "bond0",
+			Method:     MethodStatic,
+			IP:         "10.0.0.10",
+			SubnetMask: "255.255.255.0",
+			Gateway:    "10.0.0.1",
+			Bond:       &config.Bond{Members: []string{"eth0", "eth1"}},
+		},
+		{
+			Interface:  "eth2",
+			Method:     MethodStatic,
+			IP:         "10.1.0.10",
+			SubnetMask: "255.255.255.0",
+			Gateway:    "10.1.0.1",
+			VLANID:     200,
+		},
+	}))
+	b, err := ioutil.ReadFile(c.ConnmanConf)
+	assert.Nil(t, err)
+	assert.Equal(t, "command_args=\"-r --nodevice=eth0,eth1,bond0,eth2,eth2.200\"\nrc_want=\"wpa_supplicant\"\n", string(b))
+	assert.Equal(t, 1, restarts)
+}
+
+func TestConfigurator_ApplyStaticToDHCP(t *testing.T) {
+	h := newFakeHandle("eth0", "eth1")
+	eth0 := h.links["eth0"]
+	h.addrs["eth0"] = []netlink.Addr{mustParseAddr(t, "10.0.0.10/24"), mustParseAddr(t, "fe80::1/64")}
+	_, dst, _ := net.ParseCIDR("172.16.0.0/12")
+	h.routes = []netlink.Route{
+		{LinkIndex: eth0.Attrs().Index, Gw: net.ParseIP("10.0.0.1")},
+		{LinkIndex: eth0.Attrs().Index, Dst: dst, Gw: net.ParseIP("10.0.0.254")},
+	}
+	c := newTestConfigurator(t, h)
+	c.ConnmanConf = filepath.Join(filepath.Dir(c.ResolvConf), "connman")
+	if err := ioutil.WriteFile(c.ConnmanConf, []byte("command_args=\"-r --nodevice=eth0,eth1\"\nrc_want=\"wpa_supplicant\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stopped []string
+	c.StopDHCP = func(link string) error {
+		stopped = append(stopped, link)
+		return nil
+	}
+	restarts := 0
+	c.RestartConnman = func() error {
+		restarts++
+		return nil
+	}
+
+	// eth0 was static and is left to connman again
+	assert.Nil(t, c.Apply(config.Network{Interface: "eth0", Method: MethodDHCP}))
+	b, err := ioutil.ReadFile(c.ConnmanConf)
+	assert.Nil(t, err)
+	assert.Equal(t, "command_args=\"-r --nodevice=eth1\"\nrc_want=\"wpa_supplicant\"\n", string(b))
+	assert.Equal(t, 1, restarts)
+	assert.Equal(t, []string{"eth0"}, stopped)
+	assert.Equal(t, []string{"fe80::1/64"}, addrStrings(h.addrs["eth0"]))
+	assert.Empty(t, h.routes)
+
+	// nothing to do once connman has it
+	assert.Nil(t, c.Apply(config.Network{Interface: "eth0", Method: MethodDHCP}))
+	assert.Equal(t, 1, restarts)
+	assert.Equal(t, []string{"eth0"}, stopped)
+}
+
+func TestSetConnmanLinks(t *testing.T) {
+	assert.Equal(t, "command_args=\"-r --nodevice=eth0\"\n", string(setConnmanLinks(nil, []string{"eth0"}, nil)))
+	assert.Equal(t, "rc_want=\"wpa_supplicant\"\ncommand_args=\"-r --nodevice=eth0\"\n",
+		string(setConnmanLinks([]byte("rc_want=\"wpa_supplicant\"\n"), []string{"eth0"}, nil)))
+	assert.Equal(t, "command_args=\"-r --nodevice=eth0,eth1\"\n",
+		string(setConnmanLinks([]byte("command_args=\"-r --nodevice=eth0\"\n"), []string{"eth1", "eth0"}, nil)))
+	assert.Equal(t, "command_args=\"-r --nodevice=eth1\"\n",
+		string(setConnmanLinks([]byte("command_args=\"-r --nodevice=eth0\"\n"), []string{"eth1"}, []string{"eth0"})))
+	assert.Equal(t, "command_args=\"-r\"\n",
+		string(setConnmanLinks([]byte("command_args=\"-r --nodevice=eth0\"\n"), nil, []string{"eth0"})))
+	assert.Nil(t, setConnmanLinks(nil, nil, []string{"eth0"}))
+}
+
+func TestLinks(t *testing.T) {
+	assert.Equal(t, []string{"eth0"}, Links(config.Network{Interface: "eth0"}))
+	assert.Equal(t, []string{"eth0", "eth1", "bond0", "bond0.100"}, Links(config.Network{
+		Interface: "bond0",
+		Bond:      &config.Bond{Members: []string{"eth0", "eth1"}},
+		VLANID:    100,
+	}))
+}
+
+func TestLoadNetworks(t *testing.T) {
+	f, err := ioutil.TempFile("", "networks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`
+- interface: bond0
+  method: dhcp
+  vlanId: 100
+  bond:
+    members:
+    - eth0
+    - eth1
+`)
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+
+	networks, err := LoadNetworks(f.Name())
+	assert.Nil(t, err)
+	assert.Equal(t, []config.Network{
+		{
+			Interface: "bond0",
+			Method:    MethodDHCP,
+			VLANID:    100,
+			Bond:      &config.Bond{Members: []string{"eth0", "eth1"}},
+		},
+	}, networks)
+}
@@ -0,0 +1,80 @@
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ntpPort      = "123"
+	ntpPacketLen = 48
+	// seconds from the NTP epoch 1900-01-01 to the Unix epoch
+	ntpEpochOffset = 2208988800
+	// LI 0, version 4, client mode
+	ntpClientHeader = 0x23
+	ntpModeServer   = 4
+)
+
+// NTPOffset asks an NTP server for the time with SNTP (RFC 4330) and returns
+// how far the local clock is behind it
+func NTPOffset(server string, timeout time.Duration) (time.Duration, error) {
+	return queryNTP(net.JoinHostPort(server, ntpPort), timeout)
+}
+
+func queryNTP(addr string, timeout time.Duration) (time.Duration, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, err
+	}
+
+	req := make([]byte, ntpPacketLen)
+	req[0] = ntpClientHeader
+	sent := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+	resp := make([]byte, ntpPacketLen)
+	n, err := conn.Read(resp)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return 0, errors.New("no reply")
+		}
+		return 0, err
+	}
+	received := time.Now()
+	if n < ntpPacketLen {
+		return 0, fmt.Errorf("short NTP reply of %d bytes", n)
+	}
+	if resp[0]&0x7 != ntpModeServer {
+		return 0, fmt.Errorf("unexpected NTP mode %d", resp[0]&0x7)
+	}
+	if resp[1] == 0 {
+		return 0, fmt.Errorf("kiss-of-death reply %q", resp[12:16])
+	}
+	serverReceived := ntpTime(resp[32:40])
+	serverSent := ntpTime(resp[40:48])
+	return (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2, nil
+}
+
+// ntpTime converts a 64-bit NTP timestamp
+func ntpTime(b []byte) time.Time {
+	secs := int64(binary.BigEndian.Uint32(b[0:4])) - ntpEpochOffset
+	frac := int64(binary.BigEndian.Uint32(b[4:8]))
+	return time.Unix(secs, frac*int64(time.Second)>>32)
+}
+
+// setClock steps the system clock by offset
+func setClock(offset time.Duration) error {
+	tv := unix.NsecToTimeval(time.Now().Add(offset).UnixNano())
+	return unix.Settimeofday(&tv)
+}
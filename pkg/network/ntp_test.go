@@ -0,0 +1,50 @@
+package network
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func putNTPTime(b []byte, t time.Time) {
+	binary.BigEndian.PutUint32(b[0:4], uint32(t.Unix()+ntpEpochOffset))
+	binary.BigEndian.PutUint32(b[4:8], uint32(int64(t.Nanosecond())<<32/int64(time.Second)))
+}
+
+func TestNTPTime(t *testing.T) {
+	now := time.Unix(1600000000, 500000000)
+	b := make([]byte, 8)
+	putNTPTime(b, now)
+	assert.Equal(t, now, ntpTime(b))
+}
+
+func TestQueryNTP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the server is an hour ahead
+	go func() {
+		req := make([]byte, ntpPacketLen)
+		_, addr, err := conn.ReadFrom(req)
+		if err != nil {
+			return
+		}
+		resp := make([]byte, ntpPacketLen)
+		resp[0] = 0x24
+		resp[1] = 2
+		now := time.Now().Add(time.Hour)
+		putNTPTime(resp[32:40], now)
+		putNTPTime(resp[40:48], now)
+		conn.WriteTo(resp, addr)
+	}()
+
+	offset, err := queryNTP(conn.LocalAddr().String(), time.Second)
+	assert.Nil(t, err)
+	assert.InDelta(t, float64(time.Hour), float64(offset), float64(time.Second))
+}
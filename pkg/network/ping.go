@@ -0,0 +1,173 @@
+package network
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	icmpv4EchoRequest = 8
+	icmpv4EchoReply   = 0
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+
+	icmpHeaderLen = 8
+	ipv4HeaderLen = 20
+	ipv6HeaderLen = 40
+	// the smallest MTUs every link must support
+	minIPv4MTU = 576
+	minIPv6MTU = 1280
+)
+
+var pingPayload = []byte("harvester")
+
+// Ping sends an ICMP echo request to ip and waits for the reply
+func Ping(ip net.IP, timeout time.Duration) error {
+	return ping(ip, pingPayload, false, timeout)
+}
+
+// PingDF sends an ICMP echo request of size bytes, IP header included, that
+// must not be fragmented on the way to ip
+func PingDF(ip net.IP, size int, timeout time.Duration) error {
+	headerLen := ipv4HeaderLen
+	if ip.To4() == nil {
+		headerLen = ipv6HeaderLen
+	}
+	n := size - headerLen - icmpHeaderLen
+	if n < 0 {
+		return fmt.Errorf("packet size %d is too small", size)
+	}
+	payload := bytes.Repeat(pingPayload, n/len(pingPayload)+1)[:n]
+	return ping(ip, payload, true, timeout)
+}
+
+// PathMTU finds the size of the largest packet that reaches ip unfragmented,
+// up to the MTU of the link
+func PathMTU(ip net.IP, linkMTU int, timeout time.Duration) (int, error) {
+	minMTU := minIPv4MTU
+	if ip.To4() == nil {
+		minMTU = minIPv6MTU
+	}
+	return searchMTU(func(size int) error {
+		return PingDF(ip, size, timeout)
+	}, minMTU, linkMTU)
+}
+
+// searchMTU does a binary search of the largest size that probe succeeds with
+func searchMTU(probe func(size int) error, min, max int) (int, error) {
+	if probe(max) == nil {
+		return max, nil
+	}
+	if err := probe(min); err != nil {
+		return 0, fmt.Errorf("no reply to packets of %d bytes: %s", min, err)
+	}
+	// probe(lo) succeeds and probe(hi) fails
+	lo, hi := min, max
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if probe(mid) == nil {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+func ping(ip net.IP, payload []byte, dontFragment bool, timeout time.Duration) error {
+	network, request, reply := "ip4:icmp", byte(icmpv4EchoRequest), byte(icmpv4EchoReply)
+	v6 := ip.To4() == nil
+	if v6 {
+		network, request, reply = "ip6:ipv6-icmp", icmpv6EchoRequest, icmpv6EchoReply
+	}
+	conn, err := net.ListenPacket(network, "")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if dontFragment {
+		if err := setDontFragment(conn.(*net.IPConn), v6); err != nil {
+			return err
+		}
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	id := os.Getpid() & 0xffff
+	msg := echoMessage(request, id, 1, payload)
+	if _, err := conn.WriteTo(msg, &net.IPAddr{IP: ip}); err != nil {
+		return err
+	}
+
+	buf := make([]byte, len(msg)+ipv6HeaderLen)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return errors.New("no reply")
+			}
+			return err
+		}
+		if !peer.(*net.IPAddr).IP.Equal(ip) || n < icmpHeaderLen {
+			continue
+		}
+		if buf[0] == reply && int(buf[4])<<8|int(buf[5]) == id && bytes.Equal(buf[icmpHeaderLen:n], payload) {
+			return nil
+		}
+	}
+}
+
+// setDontFragment sets the DF bit of IPv4 packets, and keeps the kernel from
+// fragmenting IPv6 packets
+func setDontFragment(conn *net.IPConn, v6 bool) error {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	err = rawConn.Control(func(fd uintptr) {
+		if v6 {
+			sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER, unix.IPV6_PMTUDISC_DO)
+		} else {
+			sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_DO)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// echoMessage builds an ICMP echo request. The kernel computes the checksum
+// of ICMPv6 messages.
+func echoMessage(typ byte, id, seq int, payload []byte) []byte {
+	msg := append([]byte{typ, 0, 0, 0, byte(id >> 8), byte(id), byte(seq >> 8), byte(seq)}, payload...)
+	if typ == icmpv4EchoRequest {
+		cs := checksum(msg)
+		msg[2], msg[3] = byte(cs>>8), byte(cs)
+	}
+	return msg
+}
+
+// checksum is the Internet checksum of RFC 1071
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,52 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEchoMessage(t *testing.T) {
+	msg := echoMessage(icmpv4EchoRequest, 0x1234, 1, pingPayload)
+	assert.Equal(t, []byte{icmpv4EchoRequest, 0, 0x12, 0x34, 0, 1}, []byte{msg[0], msg[1], msg[4], msg[5], msg[6], msg[7]})
+	// the checksum of a message with its checksum is zero
+	assert.Equal(t, uint16(0), checksum(msg))
+}
+
+func TestChecksum(t *testing.T) {
+	// example of RFC 1071
+	assert.Equal(t, ^uint16(0xddf2), checksum([]byte{0x00, 0x01, 0xf2, 0x03, 0xf4, 0xf5, 0xf6, 0xf7}))
+}
+
+func TestSearchMTU(t *testing.T) {
+	probe := func(pmtu int) func(int) error {
+		return func(size int) error {
+			if size > pmtu {
+				return errors.New("message too long")
+			}
+			return nil
+		}
+	}
+	mtu, err := searchMTU(probe(9000), minIPv4MTU, 9000)
+	assert.Nil(t, err)
+	assert.Equal(t, 9000, mtu)
+
+	mtu, err = searchMTU(probe(1500), minIPv4MTU, 9000)
+	assert.Nil(t, err)
+	assert.Equal(t, 1500, mtu)
+
+	_, err = searchMTU(probe(500), minIPv4MTU, 9000)
+	assert.NotNil(t, err)
+}
+
+func TestPing(t *testing.T) {
+	conn, err := net.ListenPacket("ip4:icmp", "")
+	if err != nil {
+		t.Skipf("raw sockets are not permitted: %s", err)
+	}
+	conn.Close()
+	assert.Nil(t, Ping(net.ParseIP("127.0.0.1"), time.Second))
+}
@@ -0,0 +1,155 @@
+package network
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+)
+
+// linkState is what a rollback restores of a link
+type linkState struct {
+	name   string
+	up     bool
+	master int
+	mtu    int
+	addrs  []netlink.Addr
+	routes []netlink.Route
+}
+
+type snapshot struct {
+	links []linkState
+	// created links are deleted on rollback
+	created     []string
+	resolvConf  []byte
+	connmanConf []byte
+}
+
+func (c *Configurator) takeSnapshot(network config.Network) (*snapshot, error) {
+	snap := &snapshot{}
+	for _, name := range Links(network) {
+		link, err := c.handle.LinkByName(name)
+		if err != nil {
+			// created by the configurator
+			continue
+		}
+		addrs, err := c.handle.AddrList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			return nil, &Error{Op: "list addresses", Link: name, Err: err}
+		}
+		routes, err := c.handle.RouteList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			return nil, &Error{Op: "list routes", Link: name, Err: err}
+		}
+		snap.links = append(snap.links, linkState{
+			name:   name,
+			up:     link.Attrs().Flags&net.FlagUp != 0,
+			master: link.Attrs().MasterIndex,
+			mtu:    link.Attrs().MTU,
+			addrs:  addrs,
+			routes: routes,
+		})
+	}
+	b, err := ioutil.ReadFile(c.ResolvConf)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	snap.resolvConf = b
+	if c.ConnmanConf != "" {
+		if snap.connmanConf, err = ioutil.ReadFile(c.ConnmanConf); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return snap, nil
+}
+
+// rollback restores a snapshot as far as possible and returns the first error
+func (c *Configurator) rollback(snap *snapshot) error {
+	var firstErr error
+	record := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if c.ConnmanConf != "" {
+		record(c.updateConnmanConf(snap.connmanConf))
+	}
+
+	for i := len(snap.created) - 1; i >= 0; i-- {
+		link, err := c.handle.LinkByName(snap.created[i])
+		if err != nil {
+			continue
+		}
+		record(errors.Wrapf(c.handle.LinkDel(link), "fail to delete %s", snap.created[i]))
+	}
+
+	for _, state := range snap.links {
+		link, err := c.handle.LinkByName(state.name)
+		if err != nil {
+			record(err)
+			continue
+		}
+		if state.master == 0 && link.Attrs().MasterIndex != 0 {
+			record(errors.Wrapf(c.handle.LinkSetNoMaster(link), "fail to release %s", state.name))
+		}
+		current, err := c.handle.AddrList(link, netlink.FAMILY_ALL)
+		record(err)
+		for i := range current {
+			if !containsAddr(state.addrs, current[i]) {
+				record(errors.Wrapf(c.handle.AddrDel(link, &current[i]), "fail to delete address of %s", state.name))
+			}
+		}
+		for i := range state.addrs {
+			record(errors.Wrapf(c.handle.AddrReplace(link, &state.addrs[i]), "fail to restore address of %s", state.name))
+		}
+		if state.mtu != 0 && link.Attrs().MTU != state.mtu {
+			record(errors.Wrapf(c.handle.LinkSetMTU(link, state.mtu), "fail to restore MTU of %s", state.name))
+		}
+		if state.up {
+			record(errors.Wrapf(c.handle.LinkSetUp(link), "fail to set %s up", state.name))
+		} else {
+			record(errors.Wrapf(c.handle.LinkSetDown(link), "fail to set %s down", state.name))
+		}
+		routes, err := c.handle.RouteList(link, netlink.FAMILY_ALL)
+		record(err)
+		for i := range routes {
+			if !containsRoute(state.routes, routes[i]) {
+				record(errors.Wrapf(c.handle.RouteDel(&routes[i]), "fail to delete route of %s", state.name))
+			}
+		}
+		for i := range state.routes {
+			record(errors.Wrapf(c.handle.RouteReplace(&state.routes[i]), "fail to restore route of %s", state.name))
+		}
+	}
+
+	if snap.resolvConf != nil {
+		if err := os.Remove(c.ResolvConf); err != nil && !os.IsNotExist(err) {
+			record(err)
+		}
+		record(ioutil.WriteFile(c.ResolvConf, snap.resolvConf, 0644))
+	}
+	return firstErr
+}
+
+func containsAddr(addrs []netlink.Addr, addr netlink.Addr) bool {
+	for _, a := range addrs {
+		if a.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsRoute(routes []netlink.Route, route netlink.Route) bool {
+	for _, r := range routes {
+		if r.Equal(route) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrInvalidSignature is returned when a signature does not match the signed data
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// ParseSigningKey parses an ed25519 public key, either base64 encoded or in
+// the OpenSSH authorized_keys format ("ssh-ed25519 AAAA...")
+func ParseSigningKey(s string) (ed25519.PublicKey, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, ssh.KeyAlgoED25519) {
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s))
+		if err != nil {
+			return nil, err
+		}
+		key, ok := pub.(ssh.CryptoPublicKey).CryptoPublicKey().(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("not an ed25519 key")
+		}
+		return key, nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %w", err)
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid signing key: expect %d bytes, got %d", ed25519.PublicKeySize, len(b))
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// VerifySignature verifies a detached ed25519 signature of data. The signature
+// is either raw or base64 encoded.
+func VerifySignature(key ed25519.PublicKey, data, sig []byte) error {
+	if len(sig) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+		}
+		sig = decoded
+	}
+	if !ed25519.Verify(key, data, sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package util
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestVerifySignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	_, otherPriv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	data := []byte("token: token\n")
+	sig := ed25519.Sign(priv, data)
+
+	testCases := []struct {
+		name  string
+		data  []byte
+		sig   []byte
+		valid bool
+	}{
+		{
+			name:  "raw signature",
+			data:  data,
+			sig:   sig,
+			valid: true,
+		},
+		{
+			name:  "base64 signature",
+			data:  data,
+			sig:   []byte(base64.StdEncoding.EncodeToString(sig) + "\n"),
+			valid: true,
+		},
+		{
+			name: "tampered data",
+			data: []byte("token: other\n"),
+			sig:  sig,
+		},
+		{
+			name: "signed by another key",
+			data: data,
+			sig:  ed25519.Sign(otherPriv, data),
+		},
+		{
+			name: "garbage signature",
+			data: data,
+			sig:  []byte("<html>not found</html>"),
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := VerifySignature(pub, testCase.data, testCase.sig)
+			if testCase.valid {
+				assert.Nil(t, err)
+			} else {
+				assert.True(t, errors.Is(err, ErrInvalidSignature))
+			}
+		})
+	}
+}
+
+func TestParseSigningKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	assert.Nil(t, err)
+
+	key, err := ParseSigningKey(base64.StdEncoding.EncodeToString(pub) + "\n")
+	assert.Nil(t, err)
+	assert.Equal(t, pub, key)
+
+	key, err = ParseSigningKey(string(ssh.MarshalAuthorizedKey(sshPub)))
+	assert.Nil(t, err)
+	assert.Equal(t, pub, key)
+
+	_, err = ParseSigningKey(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.EqualError(t, err, "invalid signing key: expect 32 bytes, got 5")
+}
@@ -50,3 +50,27 @@ func isAtEnd(v *gocui.View) bool {
 	}
 	return false
 }
+
+// ScrollUp scrolls the content of a view up by n lines
+func ScrollUp(v *gocui.View, n int) error {
+	ox, oy := v.Origin()
+	if oy -= n; oy < 0 {
+		oy = 0
+	}
+	return v.SetOrigin(ox, oy)
+}
+
+// ScrollDown scrolls the content of a view down by n lines, stopping when the
+// last line is visible
+func ScrollDown(v *gocui.View, n int) error {
+	ox, oy := v.Origin()
+	_, height := v.Size()
+	maxY := len(v.BufferLines()) - height
+	if maxY < 0 {
+		maxY = 0
+	}
+	if oy += n; oy > maxY {
+		oy = maxY
+	}
+	return v.SetOrigin(ox, oy)
+}